@@ -23,6 +23,7 @@ func main() {
 
 	db := database.InitDB()
 	defer db.Close()
+	custommiddleware.UserAccess = database.GetUserAccess
     e := echo.New()
 
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
@@ -34,16 +35,148 @@ func main() {
 	e.POST("/api/auth/register", database.RegisterHandler)
 	e.POST("/api/auth/login", database.LoginHandler)
 	e.GET("/api/users/me", database.GetMeHandler, custommiddleware.AuthMiddleware)
+	e.GET("/api/users/me/schedule", database.GetMyScheduleHandler, custommiddleware.AuthMiddleware)
+	e.POST("/api/users/me/calendar-token", database.CreateCalendarTokenHandler, custommiddleware.AuthMiddleware)
+	e.DELETE("/api/users/me/calendar-token", database.DeleteCalendarTokenHandler, custommiddleware.AuthMiddleware)
+	e.GET("/api/users/me/notification-preferences", database.GetMyNotificationPreferencesHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/api/users/me/notification-preferences", database.UpdateMyNotificationPreferencesHandler, custommiddleware.AuthMiddleware)
+	e.GET("/api/users/me/children", database.GetMyChildrenHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("guardian"))
+	e.GET("/api/users/me/notifications", database.GetMyNotificationsHandler, custommiddleware.AuthMiddleware)
+	e.GET("/api/users/me/notifications/unread-count", database.GetUnreadNotificationCountHandler, custommiddleware.AuthMiddleware)
+	e.POST("/api/users/me/notifications/read-all", database.MarkAllNotificationsReadHandler, custommiddleware.AuthMiddleware)
+	e.POST("/api/users/me/notifications/:id/read", database.MarkNotificationReadHandler, custommiddleware.AuthMiddleware)
 	e.GET("/api/users", database.GetAllUsersHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/api/users/:id", database.GetUserHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PATCH("/api/users/:id", database.UpdateUserHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/api/users/:id", database.DeleteUserHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/api/users/:id/anonymize", database.AnonymizeUserHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PUT("/api/users/:id/student", database.LinkUserStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/api/users/:id/student", database.UnlinkUserStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/api/users/:id/checkin-device", database.ResetCheckinDeviceHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/api/users/:id/children", database.GetUserChildrenHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/api/users/:id/children", database.LinkGuardianStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/api/users/:id/children/:studentId", database.UnlinkGuardianStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/api/audit-logs", database.GetAuditLogsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
 	e.GET("/students", database.GetAllStudentsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
 	e.POST("/students", database.CreateStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
 	e.POST("/students/from-user", database.CreateStudentFromUserHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
 	e.GET("/student/:id", database.GetStudentHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/students/:id", database.UpdateStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PATCH("/students/:id", database.PatchStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/students/:id", database.DeleteStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/students/:id/restore", database.RestoreStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/students/:id/status-history", database.GetStudentStatusHistoryHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.GET("/students/:id/grades", database.GetStudentGradesHandler, custommiddleware.AuthMiddleware)
+	e.GET("/students/:id/group-history", database.GetStudentGroupHistoryHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/students/:id/move", database.MoveStudentHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
 	e.GET("/groups", database.GetAllGroupsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/groups", database.CreateGroupHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/groups/:id", database.GetGroupHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/groups/:id", database.UpdateGroupHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/groups/:id", database.DeleteGroupHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/groups/:id/students", database.GetGroupStudentsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
 	e.GET("/subjects", database.GetAllSubjectsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/subjects", database.CreateSubjectHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/subjects/:id", database.GetSubjectHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/subjects/:id", database.UpdateSubjectHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/subjects/:id", database.DeleteSubjectHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/subjects/:id/prerequisites", database.GetPrerequisitesHandler, custommiddleware.AuthMiddleware)
+	e.POST("/subjects/:id/prerequisites", database.AddPrerequisiteHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/subjects/:id/prerequisites/:prerequisiteId", database.DeletePrerequisiteHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/subjects/:id/eligibility/:studentId", database.CheckEligibilityHandler, custommiddleware.AuthMiddleware)
     e.GET("/all_class_schedule", database.GetAllScheduleHandler, custommiddleware.AuthMiddleware)
     e.GET("/schedule/group/:id", database.GetScheduleByGroupHandler, custommiddleware.AuthMiddleware)
+	e.GET("/schedule/conflicts", database.GetScheduleConflictsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/schedule", database.CreateScheduleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/schedule/:id", database.GetScheduleHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/schedule/:id", database.UpdateScheduleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/schedule/:id", database.DeleteScheduleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/timetable/drafts", database.GenerateTimetableHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/timetable/drafts", database.GetTimetableDraftsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/timetable/drafts/:id", database.GetTimetableDraftHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/timetable/drafts/:id/commit", database.CommitTimetableDraftHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/timetable/drafts/:id", database.DeleteTimetableDraftHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/buildings", database.GetBuildingsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/buildings", database.CreateBuildingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PUT("/buildings/:id", database.UpdateBuildingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/buildings/:id", database.DeleteBuildingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/rooms", database.GetRoomsHandler, custommiddleware.AuthMiddleware)
+	e.GET("/rooms/free", database.GetFreeRoomsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/rooms", database.CreateRoomHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/rooms/:id", database.GetRoomHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/rooms/:id", database.UpdateRoomHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/rooms/:id", database.DeleteRoomHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/rooms/:id/timetable", database.GetRoomTimetableHandler, custommiddleware.AuthMiddleware)
+	e.GET("/rooms/:id/bookings", database.GetRoomBookingsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/rooms/:id/bookings", database.CreateRoomBookingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.DELETE("/rooms/bookings/:bookingId", database.DeleteRoomBookingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/sessions/generate", database.GenerateSessionsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/sessions", database.GetLessonSessionsHandler, custommiddleware.AuthMiddleware)
+	e.GET("/sessions/:id", database.GetLessonSessionHandler, custommiddleware.AuthMiddleware)
+	e.GET("/sessions/:id/exceptions", database.GetSessionExceptionsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/sessions/:id/cancel", database.CancelSessionHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/sessions/:id/move", database.MoveSessionHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/sessions/:id/substitute", database.SubstituteTeacherHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/sessions/:id/restore", database.RestoreSessionHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/sessions/:id/checkin", database.OpenCheckinHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.GET("/sessions/:id/checkin", database.GetCheckinHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.DELETE("/sessions/:id/checkin", database.CloseCheckinHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.GET("/schedule/exceptions", database.GetScheduleExceptionsHandler, custommiddleware.AuthMiddleware)
+	e.GET("/academic-years", database.GetAcademicYearsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/academic-years", database.CreateAcademicYearHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/semesters", database.GetSemestersHandler, custommiddleware.AuthMiddleware)
+	e.GET("/semesters/current", database.GetCurrentSemesterHandler, custommiddleware.AuthMiddleware)
+	e.POST("/semesters", database.CreateSemesterHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PUT("/semesters/:id", database.UpdateSemesterHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/semesters/:id", database.DeleteSemesterHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/holidays", database.GetHolidaysHandler, custommiddleware.AuthMiddleware)
+	e.POST("/holidays", database.CreateHolidayHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/holidays/:id", database.DeleteHolidayHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/exam-periods", database.GetExamPeriodsHandler, custommiddleware.AuthMiddleware)
+	e.POST("/exam-periods", database.CreateExamPeriodHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/exam-periods/:id", database.DeleteExamPeriodHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/exams", database.GetExamsHandler, custommiddleware.AuthMiddleware)
+	e.GET("/exams/clashes", database.GetExamClashesHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/exams", database.CreateExamHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/exams/:id", database.GetExamHandler, custommiddleware.AuthMiddleware)
+	e.PUT("/exams/:id", database.UpdateExamHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/exams/:id", database.DeleteExamHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/exams/:id/seating", database.GetExamSeatingHandler, custommiddleware.AuthMiddleware)
+	e.POST("/exams/:id/seating", database.GenerateExamSeatingHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/exams/:id/marks", database.GetExamMarksHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/exams/:id/marks", database.SubmitExamMarksHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.GET("/excuses", database.GetExcusesHandler, custommiddleware.AuthMiddleware)
+	e.POST("/excuses", database.CreateExcuseHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("student", "admin"))
+	e.GET("/excuses/:id", database.GetExcuseHandler, custommiddleware.AuthMiddleware)
+	e.DELETE("/excuses/:id", database.DeleteExcuseHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("student", "admin"))
+	e.GET("/excuses/:id/document", database.GetExcuseDocumentHandler, custommiddleware.AuthMiddleware)
+	e.POST("/excuses/:id/approve", database.ApproveExcuseHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.POST("/excuses/:id/reject", database.RejectExcuseHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+	e.PUT("/faculties/:id/dean", database.SetFacultyDeanHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/notification-rules", database.GetNotificationRulesHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.POST("/notification-rules", database.CreateNotificationRuleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.PUT("/notification-rules/:id", database.UpdateNotificationRuleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.DELETE("/notification-rules/:id", database.DeleteNotificationRuleHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/notification-deliveries", database.GetNotificationDeliveriesHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+	e.GET("/calendar/me.ics", database.GetMyCalendarHandler, database.CalendarAuth)
+	e.GET("/calendar/group/:file", database.GetGroupCalendarHandler, database.CalendarAuth)
+	e.GET("/calendar/teacher/:file", database.GetTeacherCalendarHandler, database.CalendarAuth)
+	e.GET("/calendar/room/:file", database.GetRoomCalendarHandler, database.CalendarAuth)
     e.POST("/attendance/subject", database.PostAttendanceHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.POST("/attendance/session", database.PostSessionAttendanceHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.POST("/attendance/checkin", database.CheckinHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("student"))
+    e.GET("/attendance/statistics", database.GetAttendanceStatisticsHandler, custommiddleware.AuthMiddleware)
+    e.GET("/attendance/statistics/students", database.GetStudentAttendanceStatsHandler, custommiddleware.AuthMiddleware)
+    e.GET("/attendance/statistics/groups", database.GetGroupAttendanceStatsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.GET("/attendance/statistics/faculties", database.GetFacultyAttendanceStatsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.GET("/attendance/statistics/trend", database.GetAttendanceTrendHandler, custommiddleware.AuthMiddleware)
+    e.GET("/attendance/at-risk", database.GetAtRiskStudentsHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.GET("/attendance/register", database.GetAttendanceRegisterHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.GET("/attendance/policy", database.GetAttendancePolicyHandler, custommiddleware.AuthMiddleware)
+    e.PUT("/attendance/policy", database.UpdateAttendancePolicyHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("admin"))
+    e.PUT("/attendance/:id", database.UpdateAttendanceHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.DELETE("/attendance/:id", database.DeleteAttendanceHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
+    e.GET("/attendance/:id/history", database.GetAttendanceHistoryHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
     e.GET("/attendanceByStudentId/:id", database.GetAttendanceByStudentIdHandler, custommiddleware.AuthMiddleware)
     e.GET("/attendanceBySubjectId/:id", database.GetAttendanceBySubjectIdHandler, custommiddleware.AuthMiddleware, custommiddleware.RequireRole("teacher", "admin"))
 	
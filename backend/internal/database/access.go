@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// getLinkedStudentID returns the students.id linked to a user account, or nil
+// when the account has no student profile.
+func getLinkedStudentID(userID int) (*int, error) {
+	var studentID *int
+	err := pool.QueryRow(context.Background(), "SELECT student_id FROM users WHERE id = $1", userID).Scan(&studentID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return studentID, nil
+}
+
+// getGuardianStudentIDs returns the students a guardian account is linked to.
+func getGuardianStudentIDs(userID int) ([]int, error) {
+	rows, err := pool.Query(context.Background(), `
+        SELECT student_id FROM guardian_students WHERE guardian_user_id = $1 ORDER BY student_id
+    `, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// scopedStudentIDs returns the students whose data the caller is limited
+// to: themselves for students, their children for guardians. restricted is
+// false for teachers and admins, who can read everyone.
+func scopedStudentIDs(c echo.Context) (ids []int, restricted bool, err error) {
+	userID := c.Get("user_id").(int)
+	switch c.Get("user_role").(string) {
+	case "student":
+		linked, err := getLinkedStudentID(userID)
+		if err != nil || linked == nil {
+			return []int{}, true, err
+		}
+		return []int{*linked}, true, nil
+	case "guardian":
+		ids, err := getGuardianStudentIDs(userID)
+		return ids, true, err
+	}
+	return nil, false, nil
+}
+
+// canViewStudent reports whether the caller may read data of the given
+// student. Teachers and admins can read everyone, students only themselves
+// and guardians only their children.
+func canViewStudent(c echo.Context, studentID int) (bool, error) {
+	ids, restricted, err := scopedStudentIDs(c)
+	if err != nil {
+		return false, err
+	}
+	if !restricted {
+		return true, nil
+	}
+	for _, id := range ids {
+		if id == studentID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// getLinkedTeacherID returns the teachers.id of a user account. Teacher
+// records are matched to accounts by email; nil means there is no match.
+func getLinkedTeacherID(userID int) (*int, error) {
+	var teacherID int
+	err := pool.QueryRow(context.Background(), `
+        SELECT t.id FROM teachers t
+        JOIN users u ON lower(t.email) = lower(u.email)
+        WHERE u.id = $1
+    `, userID).Scan(&teacherID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &teacherID, nil
+}
@@ -0,0 +1,630 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// AttendanceMark is one student's row in a bulk attendance request.
+type AttendanceMark struct {
+	StudentID    int     `json:"student_id"`
+	Status       string  `json:"status"`
+	MinutesLate  *int    `json:"minutes_late"`
+	StatusReason *string `json:"status_reason"`
+	Remarks      *string `json:"remarks"`
+}
+
+type SessionAttendanceRequest struct {
+	SubjectID int    `json:"subject_id"`
+	VisitDay  string `json:"visit_day"`
+	// SessionID pins the lesson when a subject meets twice on the same day.
+	SessionID *int             `json:"session_id"`
+	Records   []AttendanceMark `json:"records"`
+	// Reason is stored in the history of rows that already existed and is
+	// required when the submission changes one of their statuses.
+	Reason *string `json:"reason"`
+}
+
+// AttendanceMarkResult reports what happened to one row: "created",
+// "updated" or "error".
+type AttendanceMarkResult struct {
+	StudentID    int    `json:"student_id"`
+	Result       string `json:"result"`
+	AttendanceID int    `json:"attendance_id,omitempty"`
+	SessionID    int    `json:"session_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+type AttendanceUpdateRequest struct {
+	Status       string  `json:"status"`
+	MinutesLate  *int    `json:"minutes_late"`
+	StatusReason *string `json:"status_reason"`
+	Remarks      *string `json:"remarks"`
+	// Reason explains the correction and goes into the history.
+	Reason string `json:"reason"`
+}
+
+type AttendanceRevision struct {
+	ID            int             `json:"id"`
+	AttendanceID  int             `json:"attendance_id"`
+	Action        string          `json:"action"`
+	OldValues     json.RawMessage `json:"old_values"`
+	NewValues     json.RawMessage `json:"new_values"`
+	Reason        *string         `json:"reason"`
+	ChangedBy     *int            `json:"changed_by"`
+	ChangedByName *string         `json:"changed_by_name"`
+	ChangedAt     time.Time       `json:"changed_at"`
+}
+
+// AttendancePolicy says how a status counts in statistics.
+type AttendancePolicy struct {
+	Status            string  `json:"status"`
+	Credit            float64 `json:"credit"`
+	CountsTowardTotal bool    `json:"counts_toward_total"`
+}
+
+var attendanceStatuses = map[string]bool{"present": true, "absent": true, "late": true, "excused": true, "remote": true}
+
+const attendanceStatusList = "present, absent, late, excused or remote"
+
+// attendanceVisited maps a status onto the legacy visited flag.
+func attendanceVisited(status string) bool {
+	return status == "present" || status == "late" || status == "remote"
+}
+
+// normalizeAttendanceMark lowercases the status and checks minutes_late,
+// which only late arrivals may carry.
+func normalizeAttendanceMark(status *string, minutesLate **int) string {
+	*status = strings.ToLower(strings.TrimSpace(*status))
+	if !attendanceStatuses[*status] {
+		return "status must be " + attendanceStatusList
+	}
+	if *minutesLate != nil {
+		if *status != "late" {
+			return "minutes_late is only allowed with status late"
+		}
+		if **minutesLate < 0 {
+			return "minutes_late must not be negative"
+		}
+	}
+	return ""
+}
+
+const defaultAttendanceEditWindowDays = 7
+
+// attendanceEditWindowDays is how many days back teachers may still write
+// attendance, from ATTENDANCE_EDIT_WINDOW_DAYS. Admins are not limited.
+func attendanceEditWindowDays() int {
+	if v := os.Getenv("ATTENDANCE_EDIT_WINDOW_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil && days >= 0 {
+			return days
+		}
+		fmt.Printf("Invalid ATTENDANCE_EDIT_WINDOW_DAYS %q, using %d\n", v, defaultAttendanceEditWindowDays)
+	}
+	return defaultAttendanceEditWindowDays
+}
+
+// attendanceLocked reports whether the caller may no longer write attendance
+// for visitDay.
+func attendanceLocked(c echo.Context, visitDay string) bool {
+	if c.Get("user_role").(string) == "admin" {
+		return false
+	}
+	cutoff := time.Now().In(calendarLocation()).AddDate(0, 0, -attendanceEditWindowDays()).Format("2006-01-02")
+	return visitDay < cutoff
+}
+
+func attendanceLockedMessage() string {
+	return fmt.Sprintf("Attendance older than %d days is locked; ask an admin to change it", attendanceEditWindowDays())
+}
+
+const attendanceOwnershipMessage = "Access denied: you can only mark attendance for your own lessons"
+
+// teachesLessons reports whether the caller may write attendance of the
+// given lesson sessions: admins always, teachers only for lessons they teach.
+func teachesLessons(ctx context.Context, q queryRower, c echo.Context, sessionIDs []int) (bool, error) {
+	if c.Get("user_role").(string) != "teacher" {
+		return true, nil
+	}
+	teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+	if err != nil || teacherID == nil {
+		return false, err
+	}
+	var foreign int
+	err = q.QueryRow(ctx, "SELECT COUNT(*) FROM lesson_sessions WHERE id = ANY($1) AND teacher_id <> $2", sessionIDs, *teacherID).Scan(&foreign)
+	return foreign == 0, err
+}
+
+// teachesAttendance is teachesLessons for an existing row. Rows recorded
+// without a session count as the caller's when they taught the subject to
+// the student's group that day.
+func teachesAttendance(ctx context.Context, q queryRower, c echo.Context, a *Attendance) (bool, error) {
+	if a.SessionID != nil {
+		return teachesLessons(ctx, q, c, []int{*a.SessionID})
+	}
+	if c.Get("user_role").(string) != "teacher" {
+		return true, nil
+	}
+	teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+	if err != nil || teacherID == nil {
+		return false, err
+	}
+	var taught bool
+	err = q.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM lesson_sessions ls JOIN students s ON ls.group_id = s.group_id
+            WHERE s.id = $1 AND ls.subject_id = $2 AND ls.session_date = $3 AND ls.teacher_id = $4
+        )
+    `, a.StudentId, a.SubjectID, a.VisitDay, *teacherID).Scan(&taught)
+	return taught, err
+}
+
+// recordAttendanceRevision appends a row to the attendance history.
+func recordAttendanceRevision(ctx context.Context, db execer, attendanceID int, action string, oldValues, newValues interface{}, reason *string, changedBy *int) error {
+	var oldJSON, newJSON []byte
+	var err error
+	if oldValues != nil {
+		if oldJSON, err = json.Marshal(oldValues); err != nil {
+			return err
+		}
+	}
+	if newValues != nil {
+		if newJSON, err = json.Marshal(newValues); err != nil {
+			return err
+		}
+	}
+	_, err = db.Exec(ctx, `
+        INSERT INTO attendance_revisions (attendance_id, action, old_values, new_values, reason, changed_by)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `, attendanceID, action, oldJSON, newJSON, reason, changedBy)
+	return err
+}
+
+const attendanceSelectQuery = `
+    SELECT a.id, a.subject_id, a.visit_day::text, a.visited, a.status, a.minutes_late, a.status_reason,
+        a.student_id, a.session_id, a.remarks, a.marked_by, a.excuse_id
+    FROM attendance a
+`
+
+func scanAttendance(row pgx.Row) (*Attendance, error) {
+	a := &Attendance{}
+	err := row.Scan(&a.ID, &a.SubjectID, &a.VisitDay, &a.Visited, &a.Status, &a.MinutesLate, &a.StatusReason,
+		&a.StudentId, &a.SessionID, &a.Remarks, &a.MarkedBy, &a.ExcuseID)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// attendanceSessionsByGroup returns, per group, the lesson session of the
+// subject on the given day. A pinned session restricts the result to its
+// own group.
+func attendanceSessionsByGroup(ctx context.Context, tx pgx.Tx, req *SessionAttendanceRequest) (map[int]int, string, error) {
+	query := `
+        SELECT DISTINCT ON (group_id) group_id, id FROM lesson_sessions
+        WHERE subject_id = $1 AND session_date = $2 AND status = 'scheduled'
+    `
+	args := []interface{}{req.SubjectID, req.VisitDay}
+	if req.SessionID != nil {
+		query += ` AND id = $3`
+		args = append(args, *req.SessionID)
+	}
+	query += ` ORDER BY group_id, time_slot, id`
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	sessions := map[int]int{}
+	for rows.Next() {
+		var groupID, sessionID int
+		if err := rows.Scan(&groupID, &sessionID); err != nil {
+			return nil, "", err
+		}
+		sessions[groupID] = sessionID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(sessions) == 0 {
+		if req.SessionID != nil {
+			return nil, "Lesson session does not belong to this subject and day, or was cancelled", nil
+		}
+		return nil, "No lesson of this subject is scheduled on visit_day", nil
+	}
+	return sessions, "", nil
+}
+
+// PostSessionAttendanceHandler marks attendance for a whole class at once.
+// Rows are upserted, so a register can be submitted again to correct it;
+// changing the status of an existing row then needs a reason.
+// Either every row is written or, if any row is invalid, none is and the
+// per-row results explain why.
+func PostSessionAttendanceHandler(c echo.Context) error {
+	var req SessionAttendanceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.SubjectID <= 0 || len(req.Records) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "subject_id and records are required"})
+	}
+	if req.Reason != nil {
+		if reason := strings.TrimSpace(*req.Reason); reason != "" {
+			req.Reason = &reason
+		} else {
+			req.Reason = nil
+		}
+	}
+	if req.VisitDay == "" && req.SessionID != nil {
+		var date string
+		err := pool.QueryRow(context.Background(), "SELECT session_date::text FROM lesson_sessions WHERE id = $1", *req.SessionID).Scan(&date)
+		if err != nil && err != pgx.ErrNoRows {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		req.VisitDay = date
+	}
+	if _, err := parseDate(req.VisitDay); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "visit_day must be YYYY-MM-DD"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	sessions, msg, err := attendanceSessionsByGroup(ctx, tx, &req)
+	if err != nil {
+		fmt.Printf("PostSessionAttendanceHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	studentIDs := make([]int, 0, len(req.Records))
+	for _, r := range req.Records {
+		studentIDs = append(studentIDs, r.StudentID)
+	}
+	groups := map[int]*int{}
+	rows, err := tx.Query(ctx, "SELECT id, group_id FROM students WHERE id = ANY($1) AND deleted_at IS NULL", studentIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for rows.Next() {
+		var id int
+		var groupID *int
+		if err := rows.Scan(&id, &groupID); err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		groups[id] = groupID
+	}
+	rows.Close()
+
+	existing := map[int]*Attendance{}
+	rows, err = tx.Query(ctx, attendanceSelectQuery+` WHERE a.subject_id = $1 AND a.visit_day = $2 AND a.student_id = ANY($3) FOR UPDATE`,
+		req.SubjectID, req.VisitDay, studentIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for rows.Next() {
+		a, err := scanAttendance(rows)
+		if err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		existing[a.StudentId] = a
+	}
+	rows.Close()
+
+	if attendanceLocked(c, req.VisitDay) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceLockedMessage()})
+	}
+
+	results := make([]AttendanceMarkResult, len(req.Records))
+	seen := map[int]bool{}
+	failed := false
+	for i, r := range req.Records {
+		results[i].StudentID = r.StudentID
+		msg := normalizeAttendanceMark(&r.Status, &r.MinutesLate)
+		groupID, known := groups[r.StudentID]
+		switch {
+		case msg != "":
+			results[i].Error = msg
+		case seen[r.StudentID]:
+			results[i].Error = "student is listed more than once"
+		case !known:
+			results[i].Error = "student not found"
+		case groupID == nil || sessions[*groupID] == 0:
+			results[i].Error = "student's group has no lesson of this subject on visit_day"
+		default:
+			results[i].SessionID = sessions[*groupID]
+		}
+		seen[r.StudentID] = true
+		if results[i].Error != "" {
+			results[i].Result = "error"
+			failed = true
+		}
+		req.Records[i] = r
+	}
+	if failed {
+		return c.JSON(http.StatusBadRequest, map[string]interface{}{
+			"error":   "Some rows are invalid; nothing was saved",
+			"results": results,
+		})
+	}
+
+	sessionIDs := make([]int, len(results))
+	for i, r := range results {
+		sessionIDs[i] = r.SessionID
+	}
+	allowed, err := teachesLessons(ctx, tx, c, sessionIDs)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceOwnershipMessage})
+	}
+
+	markedBy := c.Get("user_id").(int)
+
+	var changed []int
+	for i, r := range req.Records {
+		sessionID := results[i].SessionID
+		saved := Attendance{
+			SubjectID: req.SubjectID, VisitDay: req.VisitDay, Visited: attendanceVisited(r.Status),
+			Status: r.Status, MinutesLate: r.MinutesLate, StatusReason: r.StatusReason,
+			StudentId: r.StudentID, SessionID: &sessionID, Remarks: r.Remarks, MarkedBy: &markedBy,
+		}
+		if err := applyApprovedExcuse(ctx, tx, &saved); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if old := existing[r.StudentID]; old != nil && old.Status != saved.Status && req.Reason == nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("reason is required to change the status of student %d", r.StudentID)})
+		}
+
+		var inserted bool
+		err := tx.QueryRow(ctx, `
+            INSERT INTO attendance (student_id, subject_id, visit_day, visited, status, minutes_late, status_reason, remarks, session_id, marked_by, excuse_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            ON CONFLICT ON CONSTRAINT unique_attendance DO UPDATE
+            SET visited = EXCLUDED.visited, status = EXCLUDED.status, minutes_late = EXCLUDED.minutes_late,
+                status_reason = EXCLUDED.status_reason, remarks = EXCLUDED.remarks, session_id = EXCLUDED.session_id,
+                marked_by = EXCLUDED.marked_by, excuse_id = EXCLUDED.excuse_id, updated_at = CURRENT_TIMESTAMP
+            RETURNING id, (xmax = 0)
+        `, r.StudentID, req.SubjectID, req.VisitDay, saved.Visited, saved.Status, saved.MinutesLate, saved.StatusReason,
+			r.Remarks, sessionID, markedBy, saved.ExcuseID).
+			Scan(&saved.ID, &inserted)
+		if err != nil {
+			fmt.Printf("Failed to save attendance for student %d: %v\n", r.StudentID, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save attendance"})
+		}
+		results[i].AttendanceID = saved.ID
+		results[i].Result = "updated"
+		if inserted {
+			results[i].Result = "created"
+		}
+
+		if old := existing[r.StudentID]; old == nil || old.Status != saved.Status {
+			changed = append(changed, saved.ID)
+		}
+		if old := existing[r.StudentID]; old != nil {
+			err = recordAttendanceRevision(ctx, tx, saved.ID, "update", old, saved, req.Reason, &markedBy)
+		} else {
+			err = recordAttendanceRevision(ctx, tx, saved.ID, "create", nil, saved, nil, &markedBy)
+		}
+		if err != nil {
+			fmt.Printf("Failed to record attendance revision: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save attendance"})
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save attendance"})
+	}
+	notifyAttendance(changed...)
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"subject_id": req.SubjectID,
+		"visit_day":  req.VisitDay,
+		"results":    results,
+	})
+}
+
+func lockedAttendanceRow(ctx context.Context, tx pgx.Tx, c echo.Context) (*Attendance, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, pgx.ErrNoRows
+	}
+	return scanAttendance(tx.QueryRow(ctx, attendanceSelectQuery+` WHERE a.id = $1 FOR UPDATE`, id))
+}
+
+// UpdateAttendanceHandler corrects a single attendance row. A reason is
+// required and kept in the row's history. Teachers can only correct rows of
+// their own lessons.
+func UpdateAttendanceHandler(c echo.Context) error {
+	var req AttendanceUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := lockedAttendanceRow(ctx, tx, c)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Attendance not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if attendanceLocked(c, old.VisitDay) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceLockedMessage()})
+	}
+	allowed, err := teachesAttendance(ctx, tx, c, old)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceOwnershipMessage})
+	}
+
+	updated := *old
+	if req.Status != "" {
+		updated.Status = req.Status
+		updated.MinutesLate = nil
+	}
+	if req.MinutesLate != nil {
+		updated.MinutesLate = req.MinutesLate
+	}
+	if msg := normalizeAttendanceMark(&updated.Status, &updated.MinutesLate); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	updated.Visited = attendanceVisited(updated.Status)
+	if req.StatusReason != nil {
+		updated.StatusReason = req.StatusReason
+	}
+	if req.Remarks != nil {
+		updated.Remarks = req.Remarks
+	}
+	markedBy := c.Get("user_id").(int)
+	updated.MarkedBy = &markedBy
+	if err := applyApprovedExcuse(ctx, tx, &updated); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE attendance
+        SET visited = $1, status = $2, minutes_late = $3, status_reason = $4, remarks = $5, marked_by = $6, excuse_id = $7,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $8
+    `, updated.Visited, updated.Status, updated.MinutesLate, updated.StatusReason, updated.Remarks, markedBy, updated.ExcuseID, old.ID)
+	if err != nil {
+		fmt.Printf("Failed to update attendance: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance"})
+	}
+	if err := recordAttendanceRevision(ctx, tx, old.ID, "update", old, updated, &req.Reason, &markedBy); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance"})
+	}
+	if updated.Status != old.Status {
+		notifyAttendance(old.ID)
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+// DeleteAttendanceHandler removes an attendance row of one of the caller's
+// lessons. The reason may be sent in the body or as ?reason=.
+func DeleteAttendanceHandler(c echo.Context) error {
+	var req AttendanceUpdateRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Reason == "" {
+		req.Reason = c.QueryParam("reason")
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := lockedAttendanceRow(ctx, tx, c)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Attendance not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if attendanceLocked(c, old.VisitDay) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceLockedMessage()})
+	}
+	allowed, err := teachesAttendance(ctx, tx, c, old)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceOwnershipMessage})
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM attendance WHERE id = $1", old.ID); err != nil {
+		fmt.Printf("Failed to delete attendance: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete attendance"})
+	}
+	userID := c.Get("user_id").(int)
+	if err := recordAttendanceRevision(ctx, tx, old.ID, "delete", old, nil, &req.Reason, &userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete attendance"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete attendance"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetAttendanceHistoryHandler lists every revision of an attendance row,
+// oldest first. It also works for rows that have since been deleted.
+func GetAttendanceHistoryHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid attendance ID"})
+	}
+
+	rows, err := pool.Query(context.Background(), `
+        SELECT r.id, r.attendance_id, r.action, r.old_values, r.new_values, r.reason, r.changed_by, u.full_name, r.changed_at
+        FROM attendance_revisions r
+        LEFT JOIN users u ON r.changed_by = u.id
+        WHERE r.attendance_id = $1
+        ORDER BY r.changed_at, r.id
+    `, id)
+	if err != nil {
+		fmt.Printf("GetAttendanceHistoryHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	revisions := []AttendanceRevision{}
+	for rows.Next() {
+		var r AttendanceRevision
+		err := rows.Scan(&r.ID, &r.AttendanceID, &r.Action, &r.OldValues, &r.NewValues, &r.Reason, &r.ChangedBy, &r.ChangedByName, &r.ChangedAt)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		revisions = append(revisions, r)
+	}
+	if len(revisions) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No history for this attendance record"})
+	}
+
+	return c.JSON(http.StatusOK, revisions)
+}
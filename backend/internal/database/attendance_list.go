@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AttendancePage is one page of an attendance listing. Total and ByStatus
+// count every row matching the filters, not just this page; NextCursor is
+// nil on the last page.
+type AttendancePage struct {
+	Items      []Attendance   `json:"items"`
+	Total      int            `json:"total"`
+	ByStatus   map[string]int `json:"by_status"`
+	Limit      int            `json:"limit"`
+	Sort       string         `json:"sort"`
+	NextCursor *string        `json:"next_cursor"`
+}
+
+const (
+	defaultAttendancePageSize = 50
+	maxAttendancePageSize     = 500
+)
+
+// attendanceSortColumns are the orders a listing can be sorted in, with the
+// type the cursor value is cast back to. Ties are broken by a.id.
+var attendanceSortColumns = map[string]struct{ expr, cast string }{
+	"visit_day":  {"a.visit_day", "date"},
+	"status":     {"a.status", "text"},
+	"subject_id": {"a.subject_id", "int"},
+	"student_id": {"a.student_id", "int"},
+}
+
+// attendanceCursor marks the last row of a page: its sort value and id.
+type attendanceCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeAttendanceCursor(cur attendanceCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeAttendanceCursor reads a cursor issued for sort, checking that its
+// value can be cast back to the column type.
+func decodeAttendanceCursor(s, sort string) (attendanceCursor, bool) {
+	var cur attendanceCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &cur) != nil || cur.Sort != sort {
+		return cur, false
+	}
+	switch attendanceSortColumns[strings.TrimPrefix(sort, "-")].cast {
+	case "date":
+		_, err = parseDate(cur.Value)
+	case "int":
+		_, err = strconv.Atoi(cur.Value)
+	}
+	return cur, err == nil
+}
+
+// listAttendance serves a paginated attendance listing. base restricts it
+// to one student or subject; the query adds from, to, semester, subject_id,
+// student_id, group_id and status (comma separated) filters, sort (a column,
+// "-" prefixed for descending, default -visit_day), limit and cursor.
+func listAttendance(c echo.Context, base string, baseID int) error {
+	filter := &attendanceFilter{}
+	filter.where(base, baseID)
+
+	for _, param := range []string{"subject_id", "student_id", "group_id"} {
+		v := c.QueryParam(param)
+		if v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + param})
+		}
+		switch param {
+		case "group_id":
+			filter.where("s.group_id = $%d", id)
+		default:
+			filter.where("a."+param+" = $%d", id)
+		}
+	}
+
+	if v := c.QueryParam("status"); v != "" {
+		var statuses []string
+		for _, status := range strings.Split(v, ",") {
+			status = strings.ToLower(strings.TrimSpace(status))
+			if !attendanceStatuses[status] {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be " + attendanceStatusList})
+			}
+			statuses = append(statuses, status)
+		}
+		filter.where("a.status = ANY($%d)", statuses)
+	}
+
+	semester, msg, err := semesterParam(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	if semester != nil {
+		filter.where("a.visit_day >= $%d::date", semester.StartDate)
+		filter.where("a.visit_day <= $%d::date", semester.EndDate)
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<="} {
+		if v := c.QueryParam(param); v != "" {
+			if _, err := parseDate(v); err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": param + " must be YYYY-MM-DD"})
+			}
+			filter.where("a.visit_day "+op+" $%d::date", v)
+		}
+	}
+
+	sort := c.QueryParam("sort")
+	if sort == "" {
+		sort = "-visit_day"
+	}
+	descending := strings.HasPrefix(sort, "-")
+	column, ok := attendanceSortColumns[strings.TrimPrefix(sort, "-")]
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "sort must be visit_day, status, subject_id or student_id, optionally prefixed with -"})
+	}
+
+	limit := defaultAttendancePageSize
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAttendancePageSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("limit must be between 1 and %d", maxAttendancePageSize)})
+		}
+		limit = n
+	}
+
+	var cursor *attendanceCursor
+	if v := c.QueryParam("cursor"); v != "" {
+		cur, ok := decodeAttendanceCursor(v, sort)
+		if !ok {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cursor"})
+		}
+		cursor = &cur
+	}
+
+	ctx := context.Background()
+	page := AttendancePage{Items: []Attendance{}, ByStatus: map[string]int{}, Limit: limit, Sort: sort}
+	for status := range attendanceStatuses {
+		page.ByStatus[status] = 0
+	}
+
+	const from = " FROM attendance a JOIN students s ON a.student_id = s.id"
+	rows, err := pool.Query(ctx, "SELECT a.status, COUNT(*)"+from+filter.sql()+" GROUP BY a.status", filter.args...)
+	if err != nil {
+		fmt.Printf("listAttendance count error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		page.ByStatus[status] = count
+		page.Total += count
+	}
+	rows.Close()
+
+	if cursor != nil {
+		op := ">"
+		if descending {
+			op = "<"
+		}
+		filter.args = append(filter.args, cursor.Value, cursor.ID)
+		filter.conditions = append(filter.conditions, fmt.Sprintf("(%s, a.id) %s ($%d::%s, $%d)",
+			column.expr, op, len(filter.args)-1, column.cast, len(filter.args)))
+	}
+
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	query := attendanceSelectQuery + " JOIN students s ON a.student_id = s.id" + filter.sql() +
+		fmt.Sprintf(" ORDER BY %s %s, a.id %s LIMIT %d", column.expr, direction, direction, limit+1)
+	rows, err = pool.Query(ctx, query, filter.args...)
+	if err != nil {
+		fmt.Printf("listAttendance error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAttendance(rows)
+		if err != nil {
+			fmt.Printf("Error scanning attendance row: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		page.Items = append(page.Items, *a)
+	}
+
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		value := map[string]string{
+			"visit_day":  last.VisitDay,
+			"status":     last.Status,
+			"subject_id": strconv.Itoa(last.SubjectID),
+			"student_id": strconv.Itoa(last.StudentId),
+		}[strings.TrimPrefix(sort, "-")]
+		next := encodeAttendanceCursor(attendanceCursor{Sort: sort, Value: value, ID: last.ID})
+		page.NextCursor = &next
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,496 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// queryer is satisfied by both the pool and a transaction.
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// AttendanceStats summarises attendance rows under the status policy.
+type AttendanceStats struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+	// CountedLessons are the lessons that count toward the rate; Credited is
+	// what the student earned for them.
+	CountedLessons int      `json:"counted_lessons"`
+	Credited       float64  `json:"credited"`
+	AttendanceRate *float64 `json:"attendance_rate"`
+	MinutesLate    int      `json:"minutes_late"`
+}
+
+func newAttendanceStats() *AttendanceStats {
+	byStatus := map[string]int{}
+	for status := range attendanceStatuses {
+		byStatus[status] = 0
+	}
+	return &AttendanceStats{ByStatus: byStatus}
+}
+
+func (s *AttendanceStats) add(status string, count, minutesLate int, policy map[string]AttendancePolicy) {
+	s.Total += count
+	s.ByStatus[status] += count
+	s.MinutesLate += minutesLate
+	p, ok := policy[status]
+	if !ok || !p.CountsTowardTotal {
+		return
+	}
+	s.CountedLessons += count
+	s.Credited += p.Credit * float64(count)
+}
+
+// finish computes the attendance rate as a percentage with two decimals.
+func (s *AttendanceStats) finish() {
+	s.Credited = math.Round(s.Credited*100) / 100
+	if s.CountedLessons == 0 {
+		s.AttendanceRate = nil
+		return
+	}
+	rate := math.Round(s.Credited/float64(s.CountedLessons)*10000) / 100
+	s.AttendanceRate = &rate
+}
+
+func loadAttendancePolicy(ctx context.Context, q queryer) (map[string]AttendancePolicy, error) {
+	rows, err := q.Query(ctx, "SELECT status, credit::float8, counts_toward_total FROM attendance_status_policy")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policy := map[string]AttendancePolicy{}
+	for rows.Next() {
+		var p AttendancePolicy
+		if err := rows.Scan(&p.Status, &p.Credit, &p.CountsTowardTotal); err != nil {
+			return nil, err
+		}
+		policy[p.Status] = p
+	}
+	return policy, rows.Err()
+}
+
+func GetAttendancePolicyHandler(c echo.Context) error {
+	policy, err := loadAttendancePolicy(context.Background(), pool)
+	if err != nil {
+		fmt.Printf("GetAttendancePolicyHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	list := []AttendancePolicy{}
+	for _, status := range []string{"present", "late", "remote", "excused", "absent"} {
+		if p, ok := policy[status]; ok {
+			list = append(list, p)
+		}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// UpdateAttendancePolicyHandler changes how statuses count. Statuses missing
+// from the body keep their current policy.
+func UpdateAttendancePolicyHandler(c echo.Context) error {
+	var req []AttendancePolicy
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one status policy is required"})
+	}
+	for i := range req {
+		req[i].Status = strings.ToLower(strings.TrimSpace(req[i].Status))
+		if !attendanceStatuses[req[i].Status] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "status must be " + attendanceStatusList})
+		}
+		if req[i].Credit < 0 || req[i].Credit > 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "credit must be between 0 and 1"})
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := loadAttendancePolicy(ctx, tx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for _, p := range req {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO attendance_status_policy (status, credit, counts_toward_total) VALUES ($1, $2, $3)
+            ON CONFLICT (status) DO UPDATE
+            SET credit = EXCLUDED.credit, counts_toward_total = EXCLUDED.counts_toward_total, updated_at = CURRENT_TIMESTAMP
+        `, p.Status, p.Credit, p.CountsTowardTotal)
+		if err != nil {
+			fmt.Printf("Failed to update attendance policy: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance policy"})
+		}
+	}
+	if err := writeAuditLog(ctx, tx, c, "update_attendance_policy", "attendance_status_policy", 0, before, req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance policy"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update attendance policy"})
+	}
+
+	return GetAttendancePolicyHandler(c)
+}
+
+// attendanceFilter is the WHERE clause shared by the statistics endpoints.
+// Queries join attendance a, students s, student_groups sg, faculties f and
+// subjects sub.
+type attendanceFilter struct {
+	conditions []string
+	args       []interface{}
+	semester   *Semester
+}
+
+func (f *attendanceFilter) where(expr string, value interface{}) {
+	f.args = append(f.args, value)
+	f.conditions = append(f.conditions, fmt.Sprintf(expr, len(f.args)))
+}
+
+func (f *attendanceFilter) sql() string {
+	if len(f.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conditions, " AND ")
+}
+
+// attendanceStatsFrom left-joins the group and faculty so attendance of
+// students who have left their group still counts.
+const attendanceStatsFrom = `
+    FROM attendance a
+    JOIN students s ON a.student_id = s.id
+    LEFT JOIN student_groups sg ON s.group_id = sg.id
+    LEFT JOIN faculties f ON sg.faculty_id = f.id
+    JOIN subjects sub ON a.subject_id = sub.id
+`
+
+// parseAttendanceFilter reads student_id, subject_id, group_id, faculty_id,
+// semester, from and to. Students are limited to their own attendance and
+// guardians to their children's. With defaultSemester and no period given,
+// the current semester is used.
+func parseAttendanceFilter(c echo.Context, defaultSemester bool) (*attendanceFilter, int, string) {
+	f := &attendanceFilter{}
+
+	ids := map[string]int{}
+	for _, param := range []string{"student_id", "subject_id", "group_id", "faculty_id"} {
+		if v := c.QueryParam(param); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, http.StatusBadRequest, "Invalid " + param
+			}
+			ids[param] = id
+		}
+	}
+
+	scoped, restricted, err := scopedStudentIDs(c)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if restricted {
+		if len(scoped) == 0 {
+			return nil, http.StatusForbidden, "Access denied: you can only view your own attendance"
+		}
+		if id := ids["student_id"]; id != 0 {
+			allowed := false
+			for _, s := range scoped {
+				allowed = allowed || s == id
+			}
+			if !allowed {
+				return nil, http.StatusForbidden, "Access denied: you can only view your own attendance"
+			}
+		} else {
+			f.where("a.student_id = ANY($%d)", scoped)
+		}
+	}
+
+	if id := ids["student_id"]; id != 0 {
+		f.where("a.student_id = $%d", id)
+	}
+	if id := ids["subject_id"]; id != 0 {
+		f.where("a.subject_id = $%d", id)
+	}
+	if id := ids["group_id"]; id != 0 {
+		f.where("s.group_id = $%d", id)
+	}
+	if id := ids["faculty_id"]; id != 0 {
+		f.where("sg.faculty_id = $%d", id)
+	}
+
+	semester, msg, err := semesterParam(c)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if msg != "" {
+		return nil, http.StatusBadRequest, msg
+	}
+	from, to := c.QueryParam("from"), c.QueryParam("to")
+	for _, d := range []string{from, to} {
+		if d != "" {
+			if _, err := parseDate(d); err != nil {
+				return nil, http.StatusBadRequest, "from and to must be YYYY-MM-DD"
+			}
+		}
+	}
+	if semester == nil && from == "" && to == "" && defaultSemester {
+		semester, err = resolveSemester(context.Background(), pool, "")
+		if err == pgx.ErrNoRows {
+			return nil, http.StatusBadRequest, "No current semester; pass ?semester= or from and to"
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Database error"
+		}
+	}
+	if semester != nil {
+		f.semester = semester
+		f.where("a.visit_day >= $%d::date", semester.StartDate)
+		f.where("a.visit_day <= $%d::date", semester.EndDate)
+	}
+	if from != "" {
+		f.where("a.visit_day >= $%d::date", from)
+	}
+	if to != "" {
+		f.where("a.visit_day <= $%d::date", to)
+	}
+	return f, 0, ""
+}
+
+// GetAttendanceStatisticsHandler counts attendance by status for a student,
+// subject, group or faculty (any combination), within ?semester= or
+// ?from=&to= if given. Students only get their own figures.
+func GetAttendanceStatisticsHandler(c echo.Context) error {
+	ctx := context.Background()
+	filter, status, msg := parseAttendanceFilter(c, false)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+
+	policy, err := loadAttendancePolicy(ctx, pool)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	query := "SELECT a.status, COUNT(*), COALESCE(SUM(a.minutes_late), 0)" + attendanceStatsFrom + filter.sql() + " GROUP BY a.status"
+	rows, err := pool.Query(ctx, query, filter.args...)
+	if err != nil {
+		fmt.Printf("GetAttendanceStatisticsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	stats := newAttendanceStats()
+	for rows.Next() {
+		var status string
+		var count, minutesLate int
+		if err := rows.Scan(&status, &count, &minutesLate); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		stats.add(status, count, minutesLate, policy)
+	}
+	stats.finish()
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// AttendanceBreakdown is the statistics of one student, subject, group,
+// faculty or week; only the fields of the requested grouping are set.
+type AttendanceBreakdown struct {
+	StudentID   *int    `json:"student_id,omitempty"`
+	StudentName *string `json:"student_name,omitempty"`
+	SubjectID   *int    `json:"subject_id,omitempty"`
+	SubjectName *string `json:"subject_name,omitempty"`
+	GroupID     *int    `json:"group_id,omitempty"`
+	GroupName   *string `json:"group_name,omitempty"`
+	FacultyID   *int    `json:"faculty_id,omitempty"`
+	FacultyName *string `json:"faculty_name,omitempty"`
+	WeekStart   *string `json:"week_start,omitempty"`
+	*AttendanceStats
+}
+
+// attendanceDimension is one column set statistics can be grouped by.
+type attendanceDimension struct {
+	columns []string
+	dests   func(b *AttendanceBreakdown) []interface{}
+}
+
+var attendanceDimensions = map[string]attendanceDimension{
+	"student": {[]string{"a.student_id", "s.full_name"}, func(b *AttendanceBreakdown) []interface{} {
+		return []interface{}{&b.StudentID, &b.StudentName}
+	}},
+	"subject": {[]string{"a.subject_id", "sub.subject_name"}, func(b *AttendanceBreakdown) []interface{} {
+		return []interface{}{&b.SubjectID, &b.SubjectName}
+	}},
+	"group": {[]string{"s.group_id", "sg.group_name"}, func(b *AttendanceBreakdown) []interface{} {
+		return []interface{}{&b.GroupID, &b.GroupName}
+	}},
+	"faculty": {[]string{"sg.faculty_id", "f.faculty_name"}, func(b *AttendanceBreakdown) []interface{} {
+		return []interface{}{&b.FacultyID, &b.FacultyName}
+	}},
+	"week": {[]string{"date_trunc('week', a.visit_day)::date::text"}, func(b *AttendanceBreakdown) []interface{} {
+		return []interface{}{&b.WeekStart}
+	}},
+}
+
+// loadAttendanceBreakdown computes statistics for every combination of the
+// given dimensions that has attendance, ordered by those dimensions.
+func loadAttendanceBreakdown(ctx context.Context, filter *attendanceFilter, dimensions ...string) ([]AttendanceBreakdown, error) {
+	policy, err := loadAttendancePolicy(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, d := range dimensions {
+		columns = append(columns, attendanceDimensions[d].columns...)
+	}
+	keys := strings.Join(columns, ", ")
+	query := "SELECT concat_ws('|', " + keys + "), " + keys + ", a.status, COUNT(*), COALESCE(SUM(a.minutes_late), 0)" +
+		attendanceStatsFrom + filter.sql() + " GROUP BY " + keys + ", a.status ORDER BY " + keys
+
+	rows, err := pool.Query(ctx, query, filter.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []AttendanceBreakdown{}
+	lastKey := ""
+	for rows.Next() {
+		b := AttendanceBreakdown{AttendanceStats: newAttendanceStats()}
+		var key, status string
+		var count, minutesLate int
+		dests := []interface{}{&key}
+		for _, d := range dimensions {
+			dests = append(dests, attendanceDimensions[d].dests(&b)...)
+		}
+		dests = append(dests, &status, &count, &minutesLate)
+		if err := rows.Scan(dests...); err != nil {
+			return nil, err
+		}
+		if len(result) == 0 || key != lastKey {
+			result = append(result, b)
+			lastKey = key
+		}
+		result[len(result)-1].add(status, count, minutesLate, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range result {
+		result[i].finish()
+	}
+	return result, nil
+}
+
+// attendanceBreakdown responds with statistics grouped by dimensions. The
+// current semester is used unless a period is given.
+func attendanceBreakdown(c echo.Context, dimensions ...string) error {
+	filter, status, msg := parseAttendanceFilter(c, true)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	result, err := loadAttendanceBreakdown(context.Background(), filter, dimensions...)
+	if err != nil {
+		fmt.Printf("attendanceBreakdown error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetStudentAttendanceStatsHandler gives the rate of each student in each
+// subject.
+func GetStudentAttendanceStatsHandler(c echo.Context) error {
+	return attendanceBreakdown(c, "student", "subject")
+}
+
+func GetGroupAttendanceStatsHandler(c echo.Context) error {
+	return attendanceBreakdown(c, "group")
+}
+
+func GetFacultyAttendanceStatsHandler(c echo.Context) error {
+	return attendanceBreakdown(c, "faculty")
+}
+
+// GetAttendanceTrendHandler gives the rate week by week, so a semester's
+// trend can be plotted for whatever the filters select.
+func GetAttendanceTrendHandler(c echo.Context) error {
+	return attendanceBreakdown(c, "week")
+}
+
+const defaultAtRiskThreshold = 70.0
+
+// atRiskThreshold is the attendance rate, in percent, below which a student
+// is reported at risk in a subject.
+func atRiskThreshold() float64 {
+	if v := os.Getenv("ATTENDANCE_AT_RISK_THRESHOLD"); v != "" {
+		if threshold, err := strconv.ParseFloat(v, 64); err == nil && threshold >= 0 && threshold <= 100 {
+			return threshold
+		}
+		fmt.Printf("Invalid ATTENDANCE_AT_RISK_THRESHOLD %q, using %g\n", v, defaultAtRiskThreshold)
+	}
+	return defaultAtRiskThreshold
+}
+
+// GetAtRiskStudentsHandler lists the students whose attendance rate in a
+// subject is below ?threshold= (ATTENDANCE_AT_RISK_THRESHOLD by default),
+// lowest first. ?min_lessons= skips subjects with too few counted lessons
+// to judge.
+func GetAtRiskStudentsHandler(c echo.Context) error {
+	threshold := atRiskThreshold()
+	if v := c.QueryParam("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t < 0 || t > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "threshold must be a percentage between 0 and 100"})
+		}
+		threshold = t
+	}
+	minLessons := 1
+	if v := c.QueryParam("min_lessons"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "min_lessons must be a positive integer"})
+		}
+		minLessons = n
+	}
+
+	filter, status, msg := parseAttendanceFilter(c, true)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	all, err := loadAttendanceBreakdown(context.Background(), filter, "student", "subject", "group")
+	if err != nil {
+		fmt.Printf("GetAtRiskStudentsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	students := []AttendanceBreakdown{}
+	for _, b := range all {
+		if b.AttendanceRate != nil && *b.AttendanceRate < threshold && b.CountedLessons >= minLessons {
+			students = append(students, b)
+		}
+	}
+	sort.SliceStable(students, func(i, j int) bool {
+		return *students[i].AttendanceRate < *students[j].AttendanceRate
+	})
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"threshold":   threshold,
+		"min_lessons": minLessons,
+		"semester":    filter.semester,
+		"students":    students,
+	})
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/labstack/echo/v4"
+)
+
+type AuditLog struct {
+	ID        int             `json:"id"`
+	UserID    *int            `json:"user_id"`
+	Action    string          `json:"action"`
+	TableName string          `json:"table_name"`
+	RecordID  *int            `json:"record_id"`
+	OldValues json.RawMessage `json:"old_values,omitempty"`
+	NewValues json.RawMessage `json:"new_values,omitempty"`
+	IPAddress string          `json:"ip_address"`
+	UserAgent string          `json:"user_agent"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// execer is satisfied by both the pool and a transaction, so audit entries
+// can be written as part of the change they describe.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func writeAuditLog(ctx context.Context, db execer, c echo.Context, action, tableName string, recordID int, oldValues, newValues interface{}) error {
+	var oldJSON, newJSON []byte
+	var err error
+	if oldValues != nil {
+		if oldJSON, err = json.Marshal(oldValues); err != nil {
+			return err
+		}
+	}
+	if newValues != nil {
+		if newJSON, err = json.Marshal(newValues); err != nil {
+			return err
+		}
+	}
+
+	var userID *int
+	if id, ok := c.Get("user_id").(int); ok {
+		userID = &id
+	}
+
+	query := `
+        INSERT INTO audit_logs (user_id, action, table_name, record_id, old_values, new_values, ip_address, user_agent)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err = db.Exec(ctx, query, userID, action, tableName, recordID, oldJSON, newJSON, c.RealIP(), c.Request().UserAgent())
+	return err
+}
+
+func GetAuditLogsHandler(c echo.Context) error {
+	query := `
+        SELECT id, user_id, action, table_name, record_id, old_values, new_values,
+            COALESCE(ip_address, ''), COALESCE(user_agent, ''), created_at
+        FROM audit_logs
+        WHERE ($1 = '' OR table_name = $1) AND ($2 = 0 OR record_id = $2) AND ($3 = 0 OR user_id = $3)
+        ORDER BY created_at DESC
+        LIMIT 200
+    `
+	recordID, _ := strconv.Atoi(c.QueryParam("record_id"))
+	userID, _ := strconv.Atoi(c.QueryParam("user_id"))
+
+	rows, err := pool.Query(context.Background(), query, c.QueryParam("table"), recordID, userID)
+	if err != nil {
+		fmt.Printf("GetAuditLogsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	logs := []AuditLog{}
+	for rows.Next() {
+		var log AuditLog
+		err := rows.Scan(&log.ID, &log.UserID, &log.Action, &log.TableName, &log.RecordID, &log.OldValues, &log.NewValues,
+			&log.IPAddress, &log.UserAgent, &log.CreatedAt)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		logs = append(logs, log)
+	}
+
+	return c.JSON(http.StatusOK, logs)
+}
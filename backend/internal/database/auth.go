@@ -2,10 +2,17 @@ package database
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -15,12 +22,16 @@ import (
 )
 
 type User struct {
-	ID        int       `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"-"`
-	Role      string    `json:"role"`
-	FullName  string    `json:"full_name,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+	ID        int        `json:"id"`
+	Email     string     `json:"email"`
+	Password  string     `json:"-"`
+	Role      string     `json:"role"`
+	FullName  string     `json:"full_name,omitempty"`
+	Phone     string     `json:"phone,omitempty"`
+	StudentID *int       `json:"student_id,omitempty"`
+	IsActive  bool       `json:"is_active"`
+	LastLogin *time.Time `json:"last_login,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 type RegisterRequest struct {
@@ -33,11 +44,16 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// DeviceToken is the token the device got at its last login, if any.
+	DeviceToken string `json:"device_token"`
 }
 
 type LoginResponse struct {
 	Token string `json:"token"`
-	User  User   `json:"user"`
+	// DeviceToken identifies this device for QR check-in. Clients keep it
+	// across logins and send it back on the next login.
+	DeviceToken string `json:"device_token"`
+	User        User   `json:"user"`
 }
 
 type JWTClaims struct {
@@ -87,6 +103,46 @@ func GenerateJWT(userID int, email string, role string) (string, error) {
 	return token.SignedString(jwtSecret)
 }
 
+func signDeviceToken(deviceID string, userID int) string {
+	mac := hmac.New(sha256.New, jwtSecret)
+	fmt.Fprintf(mac, "device.%s.%d", deviceID, userID)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseDeviceToken checks a "<device>.<user>.<signature>" token and returns
+// the device id and the user it was issued to.
+func parseDeviceToken(token string) (string, int, bool) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return "", 0, false
+	}
+	userID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, false
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(signDeviceToken(parts[0], userID))) {
+		return "", 0, false
+	}
+	return parts[0], userID, true
+}
+
+// issueDeviceToken signs a device token for userID. The device id comes from
+// previous when that is a valid token, so logging in to another account on
+// the same device keeps the device recognisable; otherwise a new id is drawn.
+// A client can always leave previous out, which is why check-in also
+// insists on the device registered to the account (see CheckinHandler).
+func issueDeviceToken(userID int, previous string) (string, error) {
+	deviceID, _, ok := parseDeviceToken(previous)
+	if !ok {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		deviceID = hex.EncodeToString(buf)
+	}
+	return fmt.Sprintf("%s.%d.%s", deviceID, userID, signDeviceToken(deviceID, userID)), nil
+}
+
 func RegisterHandler(c echo.Context) error {
 	var req RegisterRequest
 	if err := c.Bind(&req); err != nil {
@@ -104,8 +160,8 @@ func RegisterHandler(c echo.Context) error {
 	if req.Role == "" {
 		req.Role = "student"
 	}
-	if req.Role != "student" && req.Role != "teacher" && req.Role != "admin" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role. Must be student, teacher, or admin"})
+	if !isValidRole(req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role. Must be student, teacher, admin, or guardian"})
 	}
 
 	var existingUser User
@@ -131,14 +187,20 @@ func RegisterHandler(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 	}
+	deviceToken, err := issueDeviceToken(userID, "")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
 
 	return c.JSON(http.StatusCreated, LoginResponse{
-		Token: token,
+		Token:       token,
+		DeviceToken: deviceToken,
 		User: User{
 			ID:        userID,
 			Email:     req.Email,
 			Role:      role,
 			FullName:  req.FullName,
+			IsActive:  true,
 			CreatedAt: time.Now(),
 		},
 	})
@@ -151,8 +213,8 @@ func LoginHandler(c echo.Context) error {
 	}
 
 	var user User
-	query := `SELECT id, email, password, role, full_name, created_at FROM users WHERE email = $1`
-	err := pool.QueryRow(context.Background(), query, req.Email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.FullName, &user.CreatedAt)
+	query := `SELECT id, email, password, role, COALESCE(full_name, ''), COALESCE(is_active, true), created_at FROM users WHERE email = $1`
+	err := pool.QueryRow(context.Background(), query, req.Email).Scan(&user.ID, &user.Email, &user.Password, &user.Role, &user.FullName, &user.IsActive, &user.CreatedAt)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
@@ -164,18 +226,32 @@ func LoginHandler(c echo.Context) error {
 		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid email or password"})
 	}
 
+	if !user.IsActive {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Account is deactivated"})
+	}
+
+	if _, err := pool.Exec(context.Background(), "UPDATE users SET last_login = CURRENT_TIMESTAMP WHERE id = $1", user.ID); err != nil {
+		fmt.Printf("Failed to update last_login: %v\n", err)
+	}
+
 	token, err := GenerateJWT(user.ID, user.Email, user.Role)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 	}
+	deviceToken, err := issueDeviceToken(user.ID, req.DeviceToken)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
 
 	return c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
+		Token:       token,
+		DeviceToken: deviceToken,
 		User: User{
 			ID:        user.ID,
 			Email:     user.Email,
 			Role:      user.Role,
 			FullName:  user.FullName,
+			IsActive:  user.IsActive,
 			CreatedAt: user.CreatedAt,
 		},
 	})
@@ -184,9 +260,7 @@ func LoginHandler(c echo.Context) error {
 func GetMeHandler(c echo.Context) error {
 	userID := c.Get("user_id").(int)
 
-	var user User
-	query := `SELECT id, email, COALESCE(role, 'student') as role, COALESCE(full_name, '') as full_name, created_at FROM users WHERE id = $1`
-	err := pool.QueryRow(context.Background(), query, userID).Scan(&user.ID, &user.Email, &user.Role, &user.FullName, &user.CreatedAt)
+	user, err := getUserById(userID)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
@@ -197,32 +271,3 @@ func GetMeHandler(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, user)
 }
-
-func GetAllUsersHandler(c echo.Context) error {
-	fmt.Println("GetAllUsersHandler called")
-	query := `SELECT id, email, COALESCE(role, 'student') as role, COALESCE(full_name, '') as full_name, created_at FROM users ORDER BY created_at DESC`
-	rows, err := pool.Query(context.Background(), query)
-	if err != nil {
-		fmt.Printf("Database query error: %v\n", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-	}
-	defer rows.Close()
-
-	var users []User
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Email, &user.Role, &user.FullName, &user.CreatedAt)
-		if err != nil {
-			fmt.Printf("Row scan error: %v\n", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-		}
-		users = append(users, user)
-	}
-
-	if err = rows.Err(); err != nil {
-		fmt.Printf("Rows iteration error: %v\n", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-	}
-
-	return c.JSON(http.StatusOK, users)
-}
@@ -0,0 +1,615 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type AcademicYear struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+type Semester struct {
+	ID             int    `json:"id"`
+	Name           string `json:"name"`
+	AcademicYearID int    `json:"academic_year_id"`
+	AcademicYear   string `json:"academic_year"`
+	StartDate      string `json:"start_date"`
+	EndDate        string `json:"end_date"`
+	IsCurrent      bool   `json:"is_current"`
+}
+
+type SemesterRequest struct {
+	Name         string `json:"name"`
+	AcademicYear string `json:"academic_year"`
+	StartDate    string `json:"start_date"`
+	EndDate      string `json:"end_date"`
+}
+
+type Holiday struct {
+	ID          int    `json:"id"`
+	HolidayDate string `json:"holiday_date"`
+	Name        string `json:"name"`
+}
+
+type ExamPeriod struct {
+	ID         int    `json:"id"`
+	SemesterID int    `json:"semester_id"`
+	Semester   string `json:"semester"`
+	Name       string `json:"name"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+}
+
+type ExamPeriodRequest struct {
+	SemesterID int    `json:"semester_id"`
+	Name       string `json:"name"`
+	StartDate  string `json:"start_date"`
+	EndDate    string `json:"end_date"`
+}
+
+// queryRower is satisfied by both the pool and a transaction.
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// currentSemesterName is accepted wherever a semester name is expected and
+// stands for whatever semester the calendar says is current.
+const currentSemesterName = "current"
+
+const semesterSelectQuery = `
+    SELECT sem.id, sem.name, sem.academic_year_id, ay.name, sem.start_date::text, sem.end_date::text,
+        CURRENT_DATE BETWEEN sem.start_date AND sem.end_date
+    FROM semesters sem
+    JOIN academic_years ay ON sem.academic_year_id = ay.id
+`
+
+func scanSemester(row pgx.Row) (*Semester, error) {
+	sem := &Semester{}
+	err := row.Scan(&sem.ID, &sem.Name, &sem.AcademicYearID, &sem.AcademicYear, &sem.StartDate, &sem.EndDate, &sem.IsCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return sem, nil
+}
+
+// getCurrentSemester returns the semester containing today. Between
+// semesters it falls back to the next one to start, and after the last
+// one to the most recent.
+func getCurrentSemester(ctx context.Context, q queryRower) (*Semester, error) {
+	return scanSemester(q.QueryRow(ctx, semesterSelectQuery+`
+        ORDER BY
+            CASE
+                WHEN CURRENT_DATE BETWEEN sem.start_date AND sem.end_date THEN 0
+                WHEN sem.start_date > CURRENT_DATE THEN 1
+                ELSE 2
+            END,
+            CASE WHEN sem.start_date > CURRENT_DATE THEN sem.start_date END,
+            sem.end_date DESC
+        LIMIT 1
+    `))
+}
+
+// resolveSemester looks a semester up by name; an empty name or "current"
+// resolves to the current semester. pgx.ErrNoRows means it does not exist.
+func resolveSemester(ctx context.Context, q queryRower, name string) (*Semester, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || name == currentSemesterName {
+		return getCurrentSemester(ctx, q)
+	}
+	return scanSemester(q.QueryRow(ctx, semesterSelectQuery+` WHERE sem.name = $1`, name))
+}
+
+// errOutsideCalendar means a date falls in no semester of the academic
+// calendar, so no weekly schedule applies to it.
+var errOutsideCalendar = errors.New("date is outside the academic calendar")
+
+// semesterNameForDate returns the name of the calendar semester containing
+// date, or errOutsideCalendar if none does.
+func semesterNameForDate(ctx context.Context, q queryRower, date time.Time) (string, error) {
+	var name string
+	err := q.QueryRow(ctx, "SELECT name FROM semesters WHERE $1::date BETWEEN start_date AND end_date ORDER BY start_date LIMIT 1",
+		date.Format("2006-01-02")).Scan(&name)
+	if err == pgx.ErrNoRows {
+		return "", errOutsideCalendar
+	}
+	return name, err
+}
+
+func resolveAcademicYear(ctx context.Context, q queryRower, name string) (*AcademicYear, error) {
+	if name == "" {
+		sem, err := getCurrentSemester(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		name = sem.AcademicYear
+	}
+	ay := &AcademicYear{}
+	err := q.QueryRow(ctx, "SELECT id, name, start_date::text, end_date::text FROM academic_years WHERE name = $1", name).
+		Scan(&ay.ID, &ay.Name, &ay.StartDate, &ay.EndDate)
+	if err != nil {
+		return nil, err
+	}
+	return ay, nil
+}
+
+// semesterParam resolves the optional ?semester= query parameter, which may
+// be a semester name or "current". It returns nil when the parameter is
+// absent and a non-empty message when the semester is unknown.
+func semesterParam(c echo.Context) (*Semester, string, error) {
+	name := c.QueryParam("semester")
+	if name == "" {
+		return nil, "", nil
+	}
+	sem, err := resolveSemester(context.Background(), pool, name)
+	if err == pgx.ErrNoRows {
+		return nil, "Unknown semester", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return sem, "", nil
+}
+
+// nonTeachingDays returns the holidays and exam period days between from
+// and to, i.e. the dates on which regular lessons do not take place.
+func nonTeachingDays(ctx context.Context, tx pgx.Tx, from, to time.Time) (map[string]bool, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT holiday_date::text FROM holidays WHERE holiday_date BETWEEN $1 AND $2
+        UNION
+        SELECT d::date::text
+        FROM exam_periods ep, generate_series(ep.start_date, ep.end_date, interval '1 day') d
+        WHERE ep.end_date >= $1 AND ep.start_date <= $2
+    `, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	days := map[string]bool{}
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			return nil, err
+		}
+		days[day] = true
+	}
+	return days, rows.Err()
+}
+
+func GetAcademicYearsHandler(c echo.Context) error {
+	rows, err := pool.Query(context.Background(), "SELECT id, name, start_date::text, end_date::text FROM academic_years ORDER BY start_date DESC")
+	if err != nil {
+		fmt.Printf("GetAcademicYearsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	years := []AcademicYear{}
+	for rows.Next() {
+		var ay AcademicYear
+		if err := rows.Scan(&ay.ID, &ay.Name, &ay.StartDate, &ay.EndDate); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		years = append(years, ay)
+	}
+
+	return c.JSON(http.StatusOK, years)
+}
+
+func CreateAcademicYearHandler(c echo.Context) error {
+	var req AcademicYear
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if !validateAcademicYear(req.Name) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name must look like 2025-2026"})
+	}
+	from, err1 := parseDate(req.StartDate)
+	to, err2 := parseDate(req.EndDate)
+	if err1 != nil || err2 != nil || !to.After(from) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "start_date and end_date must be YYYY-MM-DD and end after start"})
+	}
+
+	err := pool.QueryRow(context.Background(), "INSERT INTO academic_years (name, start_date, end_date) VALUES ($1, $2, $3) RETURNING id",
+		req.Name, req.StartDate, req.EndDate).Scan(&req.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Academic year already exists"})
+		}
+		fmt.Printf("Failed to create academic year: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create academic year"})
+	}
+
+	return c.JSON(http.StatusCreated, req)
+}
+
+func GetSemestersHandler(c echo.Context) error {
+	query := semesterSelectQuery
+	var args []interface{}
+	if v := c.QueryParam("academic_year"); v != "" {
+		query += " WHERE ay.name = $1"
+		args = append(args, v)
+	}
+	query += " ORDER BY sem.start_date DESC"
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("GetSemestersHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	semesters := []Semester{}
+	for rows.Next() {
+		sem, err := scanSemester(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		semesters = append(semesters, *sem)
+	}
+
+	return c.JSON(http.StatusOK, semesters)
+}
+
+func GetCurrentSemesterHandler(c echo.Context) error {
+	sem, err := getCurrentSemester(context.Background(), pool)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "No semesters in the academic calendar"})
+		}
+		fmt.Printf("GetCurrentSemesterHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, sem)
+}
+
+// validateSemesterRequest checks the request and returns the academic year
+// the semester belongs to. Semesters must lie within their academic year
+// and must not overlap each other, so that "current" is unambiguous.
+func validateSemesterRequest(ctx context.Context, id int, req *SemesterRequest) (*AcademicYear, string, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if !semesterRegex.MatchString(req.Name) {
+		return nil, "name must look like Spring 2026", nil
+	}
+	from, err1 := parseDate(req.StartDate)
+	to, err2 := parseDate(req.EndDate)
+	if err1 != nil || err2 != nil || !to.After(from) {
+		return nil, "start_date and end_date must be YYYY-MM-DD and end after start", nil
+	}
+
+	ay, err := resolveAcademicYear(ctx, pool, req.AcademicYear)
+	if err == pgx.ErrNoRows {
+		return nil, "Unknown academic_year", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if req.StartDate < ay.StartDate || req.EndDate > ay.EndDate {
+		return nil, fmt.Sprintf("Semester must lie within academic year %s (%s to %s)", ay.Name, ay.StartDate, ay.EndDate), nil
+	}
+
+	var overlapping string
+	err = pool.QueryRow(ctx, "SELECT name FROM semesters WHERE id <> $1 AND start_date <= $3 AND end_date >= $2 LIMIT 1",
+		id, req.StartDate, req.EndDate).Scan(&overlapping)
+	if err == nil {
+		return nil, fmt.Sprintf("Semester overlaps %s", overlapping), nil
+	}
+	if err != pgx.ErrNoRows {
+		return nil, "", err
+	}
+	return ay, "", nil
+}
+
+func CreateSemesterHandler(c echo.Context) error {
+	var req SemesterRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := context.Background()
+	ay, msg, err := validateSemesterRequest(ctx, 0, &req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	var id int
+	err = pool.QueryRow(ctx, "INSERT INTO semesters (academic_year_id, name, start_date, end_date) VALUES ($1, $2, $3, $4) RETURNING id",
+		ay.ID, req.Name, req.StartDate, req.EndDate).Scan(&id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Semester already exists"})
+		}
+		fmt.Printf("Failed to create semester: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create semester"})
+	}
+
+	sem, err := scanSemester(pool.QueryRow(ctx, semesterSelectQuery+` WHERE sem.id = $1`, id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Semester created but failed to load it"})
+	}
+	return c.JSON(http.StatusCreated, sem)
+}
+
+// UpdateSemesterHandler also moves the schedule entries of the semester to
+// its academic year's name, which they store as a label.
+func UpdateSemesterHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid semester ID"})
+	}
+
+	var req SemesterRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := context.Background()
+	ay, msg, err := validateSemesterRequest(ctx, id, &req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+        UPDATE semesters SET academic_year_id = $1, name = $2, start_date = $3, end_date = $4, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $5
+    `, ay.ID, req.Name, req.StartDate, req.EndDate, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Semester already exists"})
+		}
+		fmt.Printf("Failed to update semester: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update semester"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Semester not found"})
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE schedule SET academic_year = $1 WHERE semester_id = $2", ay.Name, id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update semester"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update semester"})
+	}
+
+	sem, err := scanSemester(pool.QueryRow(ctx, semesterSelectQuery+` WHERE sem.id = $1`, id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Semester updated but failed to load it"})
+	}
+	return c.JSON(http.StatusOK, sem)
+}
+
+func DeleteSemesterHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid semester ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM semesters WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Semester is still referenced by schedule, grades or drafts"})
+		}
+		fmt.Printf("Failed to delete semester: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete semester"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Semester not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func GetHolidaysHandler(c echo.Context) error {
+	query := "SELECT id, holiday_date::text, name FROM holidays"
+	var conditions []string
+	var args []interface{}
+	if v := c.QueryParam("from"); v != "" {
+		args = append(args, v)
+		conditions = append(conditions, fmt.Sprintf("holiday_date >= $%d", len(args)))
+	}
+	if v := c.QueryParam("to"); v != "" {
+		args = append(args, v)
+		conditions = append(conditions, fmt.Sprintf("holiday_date <= $%d", len(args)))
+	}
+	for _, v := range args {
+		if _, err := parseDate(v.(string)); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "from and to must be YYYY-MM-DD"})
+		}
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY holiday_date"
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("GetHolidaysHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	holidays := []Holiday{}
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.ID, &h.HolidayDate, &h.Name); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		holidays = append(holidays, h)
+	}
+
+	return c.JSON(http.StatusOK, holidays)
+}
+
+func CreateHolidayHandler(c echo.Context) error {
+	var req Holiday
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if _, err := parseDate(req.HolidayDate); err != nil || req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "holiday_date (YYYY-MM-DD) and name are required"})
+	}
+
+	err := pool.QueryRow(context.Background(), "INSERT INTO holidays (holiday_date, name) VALUES ($1, $2) RETURNING id",
+		req.HolidayDate, req.Name).Scan(&req.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A holiday already exists on this date"})
+		}
+		fmt.Printf("Failed to create holiday: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create holiday"})
+	}
+
+	return c.JSON(http.StatusCreated, req)
+}
+
+func DeleteHolidayHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid holiday ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM holidays WHERE id = $1", id)
+	if err != nil {
+		fmt.Printf("Failed to delete holiday: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete holiday"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Holiday not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+const examPeriodSelectQuery = `
+    SELECT ep.id, ep.semester_id, sem.name, ep.name, ep.start_date::text, ep.end_date::text
+    FROM exam_periods ep
+    JOIN semesters sem ON ep.semester_id = sem.id
+`
+
+func scanExamPeriod(row pgx.Row) (*ExamPeriod, error) {
+	ep := &ExamPeriod{}
+	if err := row.Scan(&ep.ID, &ep.SemesterID, &ep.Semester, &ep.Name, &ep.StartDate, &ep.EndDate); err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+func GetExamPeriodsHandler(c echo.Context) error {
+	query := examPeriodSelectQuery
+	var args []interface{}
+	if v := c.QueryParam("semester"); v != "" {
+		sem, err := resolveSemester(context.Background(), pool, v)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		query += " WHERE ep.semester_id = $1"
+		args = append(args, sem.ID)
+	}
+	query += " ORDER BY ep.start_date"
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("GetExamPeriodsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	periods := []ExamPeriod{}
+	for rows.Next() {
+		ep, err := scanExamPeriod(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		periods = append(periods, *ep)
+	}
+
+	return c.JSON(http.StatusOK, periods)
+}
+
+func CreateExamPeriodHandler(c echo.Context) error {
+	var req ExamPeriodRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.SemesterID <= 0 || req.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "semester_id and name are required"})
+	}
+	from, err1 := parseDate(req.StartDate)
+	to, err2 := parseDate(req.EndDate)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "start_date and end_date must be YYYY-MM-DD and not end before start"})
+	}
+
+	ctx := context.Background()
+	sem, err := scanSemester(pool.QueryRow(ctx, semesterSelectQuery+` WHERE sem.id = $1`, req.SemesterID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid semester_id"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if req.StartDate < sem.StartDate || req.EndDate > sem.EndDate {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Exam period must lie within %s (%s to %s)", sem.Name, sem.StartDate, sem.EndDate)})
+	}
+
+	var id int
+	err = pool.QueryRow(ctx, "INSERT INTO exam_periods (semester_id, name, start_date, end_date) VALUES ($1, $2, $3, $4) RETURNING id",
+		req.SemesterID, req.Name, req.StartDate, req.EndDate).Scan(&id)
+	if err != nil {
+		fmt.Printf("Failed to create exam period: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create exam period"})
+	}
+
+	return c.JSON(http.StatusCreated, ExamPeriod{ID: id, SemesterID: sem.ID, Semester: sem.Name, Name: req.Name, StartDate: req.StartDate, EndDate: req.EndDate})
+}
+
+func DeleteExamPeriodHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam period ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM exam_periods WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Exam period is still in use"})
+		}
+		fmt.Printf("Failed to delete exam period: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete exam period"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam period not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	custommiddleware "github.com/yungkhann/echo-server/internal/middleware"
+)
+
+type CalendarTokenResponse struct {
+	Token   string `json:"token"`
+	FeedURL string `json:"feed_url"`
+}
+
+// calendarLocation is the time zone schedule time slots are expressed in,
+// taken from CALENDAR_TIMEZONE.
+func calendarLocation() *time.Location {
+	name := os.Getenv("CALENDAR_TIMEZONE")
+	if name == "" {
+		name = "Asia/Almaty"
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		fmt.Printf("Unknown CALENDAR_TIMEZONE %q, using UTC\n", name)
+		return time.UTC
+	}
+	return loc
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CalendarAuth authenticates calendar feed requests. Calendar apps pass the
+// secret ?token= from the feed URL; other clients may use a normal JWT.
+func CalendarAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := c.QueryParam("token")
+		if token == "" {
+			return custommiddleware.AuthMiddleware(next)(c)
+		}
+
+		var userID int
+		var role string
+		err := pool.QueryRow(context.Background(),
+			"SELECT id, role FROM users WHERE calendar_token_hash = $1 AND is_active", hashCalendarToken(token)).Scan(&userID, &role)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid calendar token"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+
+		c.Set("user_id", userID)
+		c.Set("user_role", role)
+		return next(c)
+	}
+}
+
+// CreateCalendarTokenHandler issues a new secret feed token for the caller,
+// revoking the previous one. The token is only shown once.
+func CreateCalendarTokenHandler(c echo.Context) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+	token := hex.EncodeToString(raw)
+
+	_, err := pool.Exec(context.Background(), "UPDATE users SET calendar_token_hash = $1 WHERE id = $2",
+		hashCalendarToken(token), c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("Failed to store calendar token: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+	}
+
+	return c.JSON(http.StatusCreated, CalendarTokenResponse{Token: token, FeedURL: "/calendar/me.ics?token=" + token})
+}
+
+func DeleteCalendarTokenHandler(c echo.Context) error {
+	_, err := pool.Exec(context.Background(), "UPDATE users SET calendar_token_hash = NULL WHERE id = $1", c.Get("user_id").(int))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to revoke token"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// feedID parses the ":file" route parameter, e.g. "12.ics".
+func feedID(c echo.Context) (int, bool) {
+	id, err := strconv.Atoi(strings.TrimSuffix(c.Param("file"), ".ics"))
+	return id, err == nil
+}
+
+func GetGroupCalendarHandler(c echo.Context) error {
+	id, ok := feedID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+	return serveCalendarFeed(c, ScheduleFilter{GroupID: id}, fmt.Sprintf("Group %d", id))
+}
+
+func GetTeacherCalendarHandler(c echo.Context) error {
+	id, ok := feedID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid teacher ID"})
+	}
+	return serveCalendarFeed(c, ScheduleFilter{TeacherID: id}, fmt.Sprintf("Teacher %d", id))
+}
+
+func GetRoomCalendarHandler(c echo.Context) error {
+	id, ok := feedID(c)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+	return serveCalendarFeed(c, ScheduleFilter{RoomID: id}, fmt.Sprintf("Room %d", id))
+}
+
+// GetMyCalendarHandler serves the caller's own timetable: their group's for
+// students, their child's group's for guardians, their lessons for teachers.
+func GetMyCalendarHandler(c echo.Context) error {
+	filter, msg, err := timetableOwner(c)
+	if err != nil {
+		fmt.Printf("GetMyCalendarHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": msg})
+	}
+	return serveCalendarFeed(c, ScheduleFilter{GroupID: filter.GroupID, TeacherID: filter.TeacherID}, "My timetable")
+}
+
+// changedSession is a lesson session that deviates from its weekly schedule
+// entry: cancelled, moved, or with another teacher or room.
+type changedSession struct {
+	ID           int
+	ScheduleID   int
+	OriginalDate string
+	SessionDate  string
+	TimeSlot     string
+	Status       string
+	SubjectName  string
+	SubjectCode  string
+	GroupName    string
+	TeacherID    int
+	TeacherName  string
+	RoomNumber   string
+	GroupID      int
+	RoomID       int
+}
+
+const changedSessionQuery = `
+    SELECT ls.id, ls.schedule_id, ls.original_date::text, ls.session_date::text, ls.time_slot, ls.status,
+        sub.subject_name, sub.subject_code, sg.group_name, ls.teacher_id, t.full_name, COALESCE(ls.room_number, ''),
+        ls.group_id, COALESCE(ls.room_id, 0)
+    FROM lesson_sessions ls
+    JOIN schedule s ON ls.schedule_id = s.id
+    JOIN subjects sub ON ls.subject_id = sub.id
+    JOIN student_groups sg ON ls.group_id = sg.id
+    JOIN teachers t ON ls.teacher_id = t.id
+    WHERE s.semester_id = $1
+        AND (ls.status = 'cancelled' OR ls.session_date <> ls.original_date OR ls.time_slot <> s.time_slot
+            OR ls.teacher_id <> s.teacher_id OR COALESCE(ls.room_number, '') <> COALESCE(s.room_number, ''))
+`
+
+func loadChangedSessions(ctx context.Context, semesterID int) ([]changedSession, error) {
+	rows, err := pool.Query(ctx, changedSessionQuery, semesterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []changedSession
+	for rows.Next() {
+		var s changedSession
+		err := rows.Scan(&s.ID, &s.ScheduleID, &s.OriginalDate, &s.SessionDate, &s.TimeSlot, &s.Status,
+			&s.SubjectName, &s.SubjectCode, &s.GroupName, &s.TeacherID, &s.TeacherName, &s.RoomNumber, &s.GroupID, &s.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (s changedSession) matches(filter ScheduleFilter) bool {
+	return (filter.GroupID == 0 || s.GroupID == filter.GroupID) &&
+		(filter.TeacherID == 0 || s.TeacherID == filter.TeacherID) &&
+		(filter.RoomID == 0 || s.RoomID == filter.RoomID)
+}
+
+// atSlot returns the start and end of a time slot on a date in loc.
+func atSlot(date string, timeSlot string, loc *time.Location) (time.Time, time.Time, error) {
+	d, err := parseDate(date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	r, err := parseTimeSlot(timeSlot)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+	return day.Add(time.Duration(r.Start) * time.Minute), day.Add(time.Duration(r.End) * time.Minute), nil
+}
+
+// serveCalendarFeed renders the weekly schedule rows matching filter as
+// recurring events over the semester. Holidays, exam periods and changed
+// sessions are excluded with EXDATE; moved or reassigned sessions are added
+// back as standalone events.
+func serveCalendarFeed(c echo.Context, filter ScheduleFilter, name string) error {
+	ctx := context.Background()
+	sem, err := resolveSemester(ctx, pool, c.QueryParam("semester"))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Unknown semester"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	filter.Semester = sem.Name
+
+	schedules, err := getSchedules(pool, filter)
+	if err != nil {
+		fmt.Printf("serveCalendarFeed error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	changed, err := loadChangedSessions(ctx, sem.ID)
+	if err != nil {
+		fmt.Printf("serveCalendarFeed error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	from, _ := parseDate(sem.StartDate)
+	to, _ := parseDate(sem.EndDate)
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	closed, err := nonTeachingDays(ctx, tx, from, to)
+	tx.Rollback(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	emails := map[int]string{}
+	rows, err := pool.Query(ctx, "SELECT id, email FROM teachers")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err == nil {
+			emails[id] = email
+		}
+	}
+	rows.Close()
+
+	loc := calendarLocation()
+	stamp := icsUTCTime(time.Now())
+	until := time.Date(to.Year(), to.Month(), to.Day(), 23, 59, 59, 0, loc)
+
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//University Management API//Timetable//EN")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", escapeICSText(name+" - "+sem.Name))
+	w.line("X-WR-TIMEZONE", loc.String())
+	writeVTimezone(&w, loc, from.AddDate(0, 0, -1), to.AddDate(0, 0, 1))
+
+	organizer := func(teacherID int, teacherName string) {
+		if email := emails[teacherID]; email != "" {
+			w.line(fmt.Sprintf("ORGANIZER;CN=\"%s\"", strings.ReplaceAll(teacherName, `"`, "'")), "mailto:"+email)
+		}
+	}
+
+	for _, s := range schedules {
+		first := from
+		for first.Weekday().String() != s.DayOfWeek && !first.After(to) {
+			first = first.AddDate(0, 0, 1)
+		}
+		if first.After(to) {
+			continue
+		}
+		start, end, err := atSlot(first.Format("2006-01-02"), s.TimeSlot, loc)
+		if err != nil {
+			continue
+		}
+
+		var exdates []string
+		for d := first; !d.After(to); d = d.AddDate(0, 0, 7) {
+			if closed[d.Format("2006-01-02")] {
+				exStart, _, _ := atSlot(d.Format("2006-01-02"), s.TimeSlot, loc)
+				exdates = append(exdates, icsLocalTime(exStart))
+			}
+		}
+		for _, cs := range changed {
+			if cs.ScheduleID == s.ID {
+				if exStart, _, err := atSlot(cs.OriginalDate, s.TimeSlot, loc); err == nil {
+					exdates = append(exdates, icsLocalTime(exStart))
+				}
+			}
+		}
+
+		tzid := ";TZID=" + loc.String()
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("schedule-%d@university-api", s.ID))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART"+tzid, icsLocalTime(start))
+		w.line("DTEND"+tzid, icsLocalTime(end))
+		w.line("RRULE", "FREQ=WEEKLY;UNTIL="+icsUTCTime(until))
+		for _, ex := range exdates {
+			w.line("EXDATE"+tzid, ex)
+		}
+		w.line("SUMMARY", escapeICSText(fmt.Sprintf("%s (%s)", s.SubjectName, s.SubjectCode)))
+		if s.RoomNumber != "" {
+			location := s.RoomNumber
+			if s.BuildingName != "" {
+				location += ", " + s.BuildingName
+			}
+			w.line("LOCATION", escapeICSText(location))
+		}
+		organizer(s.TeacherID, s.TeacherName)
+		w.line("DESCRIPTION", escapeICSText(fmt.Sprintf("Group: %s\nTeacher: %s", s.GroupName, s.TeacherName)))
+		w.line("END", "VEVENT")
+	}
+
+	for _, cs := range changed {
+		if cs.Status != "scheduled" || !cs.matches(filter) {
+			continue
+		}
+		start, end, err := atSlot(cs.SessionDate, cs.TimeSlot, loc)
+		if err != nil {
+			continue
+		}
+		tzid := ";TZID=" + loc.String()
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("session-%d@university-api", cs.ID))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART"+tzid, icsLocalTime(start))
+		w.line("DTEND"+tzid, icsLocalTime(end))
+		w.line("SUMMARY", escapeICSText(fmt.Sprintf("%s (%s)", cs.SubjectName, cs.SubjectCode)))
+		if cs.RoomNumber != "" {
+			w.line("LOCATION", escapeICSText(cs.RoomNumber))
+		}
+		organizer(cs.TeacherID, cs.TeacherName)
+		w.line("DESCRIPTION", escapeICSText(fmt.Sprintf("Group: %s\nTeacher: %s\nRescheduled lesson", cs.GroupName, cs.TeacherName)))
+		w.line("END", "VEVENT")
+	}
+
+	w.line("END", "VCALENDAR")
+
+	c.Response().Header().Set("Content-Disposition", "inline; filename=\"timetable.ics\"")
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(w.String()))
+}
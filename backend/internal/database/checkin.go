@@ -0,0 +1,453 @@
+package database
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// CheckinWindow is an open QR check-in for a lesson session. Code is the
+// payload to render as a QR code; it is only valid until CodeExpiresAt.
+type CheckinWindow struct {
+	ID            int        `json:"id"`
+	SessionID     int        `json:"session_id"`
+	OpenedBy      *int       `json:"opened_by"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	ClosedAt      *time.Time `json:"closed_at,omitempty"`
+	CheckedIn     int        `json:"checked_in"`
+	Code          string     `json:"code,omitempty"`
+	CodeExpiresAt *time.Time `json:"code_expires_at,omitempty"`
+}
+
+type OpenCheckinRequest struct {
+	DurationMinutes int `json:"duration_minutes"`
+}
+
+type CheckinRequest struct {
+	Code string `json:"code"`
+	// DeviceToken is the device_token returned at login.
+	DeviceToken string `json:"device_token"`
+}
+
+const (
+	defaultCheckinRotationSeconds = 15
+	defaultCheckinMinutes         = 10
+	maxCheckinMinutes             = 90
+)
+
+// checkinRotation is how long one QR code stays current. The code of the
+// previous step is still accepted, so a scan has up to two steps to arrive.
+func checkinRotation() time.Duration {
+	if v := os.Getenv("ATTENDANCE_QR_ROTATION_SECONDS"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 5 {
+			return time.Duration(seconds) * time.Second
+		}
+		fmt.Printf("Invalid ATTENDANCE_QR_ROTATION_SECONDS %q, using %d\n", v, defaultCheckinRotationSeconds)
+	}
+	return defaultCheckinRotationSeconds * time.Second
+}
+
+func checkinStep(t time.Time) int64 {
+	return t.Unix() / int64(checkinRotation()/time.Second)
+}
+
+func signCheckinCode(secret string, windowID int, step int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.%d", windowID, step)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
+
+// checkinCode returns the code for the current step as
+// "<window>.<step>.<signature>" and the time it stops being current.
+func checkinCode(secret string, windowID int, now time.Time) (string, time.Time) {
+	step := checkinStep(now)
+	expires := time.Unix((step+1)*int64(checkinRotation()/time.Second), 0)
+	return fmt.Sprintf("%d.%d.%s", windowID, step, signCheckinCode(secret, windowID, step)), expires
+}
+
+// parseCheckinCode splits a scanned code into its window and step.
+func parseCheckinCode(code string) (int, int64, string, bool) {
+	parts := strings.Split(strings.TrimSpace(code), ".")
+	if len(parts) != 3 {
+		return 0, 0, "", false
+	}
+	windowID, err1 := strconv.Atoi(parts[0])
+	step, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, "", false
+	}
+	return windowID, step, parts[2], true
+}
+
+// loadCheckinSession loads the session in :id and checks that a teacher
+// caller is the one teaching it.
+func loadCheckinSession(ctx context.Context, c echo.Context) (*LessonSession, int, string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid session ID"
+	}
+	session, err := getLessonSessionById(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, http.StatusNotFound, "Lesson session not found"
+		}
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if c.Get("user_role").(string) == "teacher" {
+		teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+		if err != nil {
+			return nil, http.StatusInternalServerError, "Database error"
+		}
+		if teacherID == nil || *teacherID != session.TeacherID {
+			return nil, http.StatusForbidden, "Access denied: you can only open check-in for your own lessons"
+		}
+	}
+	return session, 0, ""
+}
+
+const checkinWindowSelectQuery = `
+    SELECT w.id, w.session_id, w.opened_by, w.opened_at, w.expires_at, w.closed_at,
+        (SELECT COUNT(*) FROM attendance_checkins ch WHERE ch.window_id = w.id), w.secret
+    FROM attendance_checkin_windows w
+`
+
+func scanCheckinWindow(row pgx.Row) (*CheckinWindow, string, error) {
+	w := &CheckinWindow{}
+	var secret string
+	err := row.Scan(&w.ID, &w.SessionID, &w.OpenedBy, &w.OpenedAt, &w.ExpiresAt, &w.ClosedAt, &w.CheckedIn, &secret)
+	if err != nil {
+		return nil, "", err
+	}
+	return w, secret, nil
+}
+
+// withCurrentCode fills in the QR payload for the current rotation step.
+func (w *CheckinWindow) withCurrentCode(secret string) *CheckinWindow {
+	code, expires := checkinCode(secret, w.ID, time.Now())
+	w.Code = code
+	w.CodeExpiresAt = &expires
+	return w
+}
+
+// OpenCheckinHandler opens a QR check-in window for a lesson taking place
+// today, closing any window still open for it.
+func OpenCheckinHandler(c echo.Context) error {
+	var req OpenCheckinRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.DurationMinutes == 0 {
+		req.DurationMinutes = defaultCheckinMinutes
+	}
+	if req.DurationMinutes < 1 || req.DurationMinutes > maxCheckinMinutes {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("duration_minutes must be between 1 and %d", maxCheckinMinutes)})
+	}
+
+	ctx := context.Background()
+	session, status, msg := loadCheckinSession(ctx, c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	if session.Status != "scheduled" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Lesson session is cancelled"})
+	}
+	if session.SessionDate != time.Now().In(calendarLocation()).Format("2006-01-02") {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Check-in can only be opened on the day of the lesson"})
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open check-in"})
+	}
+	secret := hex.EncodeToString(raw)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+        UPDATE attendance_checkin_windows SET closed_at = CURRENT_TIMESTAMP
+        WHERE session_id = $1 AND closed_at IS NULL
+    `, session.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open check-in"})
+	}
+	var id int
+	err = tx.QueryRow(ctx, `
+        INSERT INTO attendance_checkin_windows (session_id, secret, opened_by, expires_at)
+        VALUES ($1, $2, $3, CURRENT_TIMESTAMP + make_interval(mins => $4))
+        RETURNING id
+    `, session.ID, secret, c.Get("user_id").(int), req.DurationMinutes).Scan(&id)
+	if err != nil {
+		fmt.Printf("Failed to open check-in: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open check-in"})
+	}
+	window, _, err := scanCheckinWindow(tx.QueryRow(ctx, checkinWindowSelectQuery+` WHERE w.id = $1`, id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open check-in"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to open check-in"})
+	}
+
+	return c.JSON(http.StatusCreated, window.withCurrentCode(secret))
+}
+
+// GetCheckinHandler returns the open window of a session with the code to
+// show right now. The teacher's screen polls it to rotate the QR code.
+func GetCheckinHandler(c echo.Context) error {
+	ctx := context.Background()
+	session, status, msg := loadCheckinSession(ctx, c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+
+	window, secret, err := scanCheckinWindow(pool.QueryRow(ctx, checkinWindowSelectQuery+`
+        WHERE w.session_id = $1 AND w.closed_at IS NULL AND w.expires_at > CURRENT_TIMESTAMP
+        ORDER BY w.opened_at DESC LIMIT 1
+    `, session.ID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "No check-in is open for this lesson"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, window.withCurrentCode(secret))
+}
+
+func CloseCheckinHandler(c echo.Context) error {
+	ctx := context.Background()
+	session, status, msg := loadCheckinSession(ctx, c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+
+	tag, err := pool.Exec(ctx, `
+        UPDATE attendance_checkin_windows SET closed_at = CURRENT_TIMESTAMP
+        WHERE session_id = $1 AND closed_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+    `, session.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to close check-in"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No check-in is open for this lesson"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CheckinHandler records the calling student present from a scanned code.
+// The code must be signed for an open window and be from the current or the
+// previous rotation step. Each student checks in once per window.
+//
+// Devices are told apart by the signed device token issued at login. The
+// first check-in registers the caller's device, and later check-ins are only
+// accepted from it, so logging in to a classmate's account on one's own
+// phone does not work once that classmate has checked in before. A device
+// also checks in only one student per window. None of this stops a student
+// who is away from scanning a forwarded code on their own registered phone.
+func CheckinHandler(c echo.Context) error {
+	var req CheckinRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	userID := c.Get("user_id").(int)
+	deviceID, tokenUserID, ok := parseDeviceToken(req.DeviceToken)
+	if !ok || tokenUserID != userID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "device_token is missing or invalid; log in again on this device"})
+	}
+	windowID, step, signature, ok := parseCheckinCode(req.Code)
+	if !ok {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid check-in code"})
+	}
+
+	ctx := context.Background()
+	studentID, err := getLinkedStudentID(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if studentID == nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Account is not linked to a student"})
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var secret string
+	var sessionID, subjectID, groupID int
+	var sessionDate, sessionStatus string
+	var open bool
+	err = tx.QueryRow(ctx, `
+        SELECT w.secret, w.closed_at IS NULL AND w.expires_at > CURRENT_TIMESTAMP,
+            ls.id, ls.subject_id, ls.group_id, ls.session_date::text, ls.status
+        FROM attendance_checkin_windows w
+        JOIN lesson_sessions ls ON w.session_id = ls.id
+        WHERE w.id = $1
+        FOR UPDATE OF w
+    `, windowID).Scan(&secret, &open, &sessionID, &subjectID, &groupID, &sessionDate, &sessionStatus)
+	if err != nil && err != pgx.ErrNoRows {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if err == pgx.ErrNoRows || !hmac.Equal([]byte(signature), []byte(signCheckinCode(secret, windowID, step))) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid check-in code"})
+	}
+	if current := checkinStep(time.Now()); step != current && step != current-1 {
+		return c.JSON(http.StatusGone, map[string]string{"error": "Check-in code has expired; scan the code again"})
+	}
+	if !open || sessionStatus != "scheduled" {
+		return c.JSON(http.StatusGone, map[string]string{"error": "Check-in for this lesson is closed"})
+	}
+
+	var studentGroupID *int
+	var active bool
+	err = tx.QueryRow(ctx, `
+        SELECT group_id, COALESCE(status, 'Active') = 'Active' AND deleted_at IS NULL FROM students WHERE id = $1
+    `, *studentID).Scan(&studentGroupID, &active)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if studentGroupID == nil || *studentGroupID != groupID || !active {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "You are not enrolled in the group of this lesson"})
+	}
+
+	var registered string
+	err = tx.QueryRow(ctx, `
+        INSERT INTO checkin_devices (user_id, device_id) VALUES ($1, $2)
+        ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+        RETURNING device_id
+    `, userID, deviceID).Scan(&registered)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This device is registered to another account"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if registered != deviceID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Check in from the device registered to your account, or ask an admin to reset it"})
+	}
+
+	var studentDone, deviceUsed bool
+	err = tx.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM attendance_checkins WHERE window_id = $1 AND student_id = $2),
+            EXISTS (SELECT 1 FROM attendance_checkins WHERE window_id = $1 AND device_id = $3)
+    `, windowID, *studentID, deviceID).Scan(&studentDone, &deviceUsed)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if studentDone {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "You have already checked in to this lesson"})
+	}
+	if deviceUsed {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "This device has already been used to check in another student"})
+	}
+
+	old, err := scanAttendance(tx.QueryRow(ctx, attendanceSelectQuery+`
+        WHERE a.student_id = $1 AND a.subject_id = $2 AND a.visit_day = $3
+        FOR UPDATE
+    `, *studentID, subjectID, sessionDate))
+	if err != nil && err != pgx.ErrNoRows {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if old != nil && old.Status != "absent" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Attendance is already recorded for this lesson"})
+	}
+
+	saved := Attendance{
+		SubjectID: subjectID, VisitDay: sessionDate, Visited: true, Status: "present",
+		StudentId: *studentID, SessionID: &sessionID, MarkedBy: &userID,
+	}
+	reason := fmt.Sprintf("QR check-in %d", windowID)
+	if old == nil {
+		err = tx.QueryRow(ctx, `
+            INSERT INTO attendance (student_id, subject_id, visit_day, visited, status, session_id, marked_by)
+            VALUES ($1, $2, $3, true, 'present', $4, $5)
+            RETURNING id
+        `, *studentID, subjectID, sessionDate, sessionID, userID).Scan(&saved.ID)
+		if err == nil {
+			err = recordAttendanceRevision(ctx, tx, saved.ID, "create", nil, saved, &reason, &userID)
+		}
+	} else {
+		saved.ID = old.ID
+		saved.Remarks = old.Remarks
+		_, err = tx.Exec(ctx, `
+            UPDATE attendance
+            SET visited = true, status = 'present', minutes_late = NULL, status_reason = NULL, excuse_id = NULL,
+                session_id = $1, marked_by = $2, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $3
+        `, sessionID, userID, old.ID)
+		if err == nil {
+			err = recordAttendanceRevision(ctx, tx, saved.ID, "update", old, saved, &reason, &userID)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to record check-in attendance: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check in"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO attendance_checkins (window_id, student_id, attendance_id, code_step, device_id, ip_address, user_agent)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `, windowID, *studentID, saved.ID, step, deviceID, c.RealIP(), c.Request().UserAgent())
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This check-in has already been used"})
+		}
+		fmt.Printf("Failed to record check-in: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check in"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to check in"})
+	}
+
+	return c.JSON(http.StatusCreated, saved)
+}
+
+// ResetCheckinDeviceHandler forgets the device registered to a user, so the
+// next check-in registers a new one.
+func ResetCheckinDeviceHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var deviceID string
+	err = tx.QueryRow(ctx, "DELETE FROM checkin_devices WHERE user_id = $1 RETURNING device_id", id).Scan(&deviceID)
+	if err == pgx.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No device is registered to this user"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reset device"})
+	}
+	if err := writeAuditLog(ctx, tx, c, "reset_checkin_device", "users", id, map[string]interface{}{"device_id": deviceID}, nil); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reset device"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to reset device"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
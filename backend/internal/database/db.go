@@ -8,6 +8,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,33 +16,44 @@ import (
 )
 
 type Student struct{
-    ID        int    `json:"id,omitempty"`
-    FullName  string `json:"full_name"`
-    Gender    string `json:"gender"`
-    BirthDate string `json:"birth_date"`
-    GroupID   int    `json:"group_id"`
-    GroupName string `json:"group_name"`
+    ID              int        `json:"id,omitempty"`
+    FullName        string     `json:"full_name"`
+    Gender          string     `json:"gender"`
+    BirthDate       string     `json:"birth_date"`
+    GroupID         int        `json:"group_id"`
+    GroupName       string     `json:"group_name"`
+    Email           string     `json:"email"`
+    Phone           string     `json:"phone"`
+    StudentIDNumber string     `json:"student_id_number"`
+    EnrollmentDate  string     `json:"enrollment_date"`
+    Status          string     `json:"status"`
+    DeletedAt       *time.Time `json:"deleted_at,omitempty"`
 }
 
 type Group struct{
-    ID        int    `json:"id"`
-    GroupName string `json:"group_name"`
-    FacultyID int    `json:"faculty_id"`
+    ID           int    `json:"id"`
+    GroupName    string `json:"group_name"`
+    FacultyID    int    `json:"faculty_id"`
+    FacultyName  string `json:"faculty_name"`
+    CourseYear   int    `json:"course_year"`
+    AcademicYear string `json:"academic_year"`
+    StudentCount int    `json:"student_count"`
 }
-type Schedule struct{
-    ID          int    `json:"id"`
-    SubjectName string `json:"subject_name"`
-    TimeSlot    string `json:"time_slot"`
-    GroupID     int    `json:"group_id"`
-    GroupName   string `json:"group_name"`
-}
-
 type Attendance struct{
-    ID          int    `json:"id"`
-    SubjectID   int    `json:"subject_id"`
-    VisitDay    string `json:"visit_day"`
-    Visited     bool   `json:"visited"`
-    StudentId   int    `json:"student_id"`
+    ID           int     `json:"id"`
+    SubjectID    int     `json:"subject_id"`
+    VisitDay     string  `json:"visit_day"`
+    // Visited is kept for older clients; it is derived from Status.
+    Visited      bool    `json:"visited"`
+    Status       string  `json:"status"`
+    MinutesLate  *int    `json:"minutes_late,omitempty"`
+    StatusReason *string `json:"status_reason,omitempty"`
+    StudentId    int     `json:"student_id"`
+    SessionID    *int    `json:"session_id,omitempty"`
+    Remarks      *string `json:"remarks"`
+    MarkedBy     *int    `json:"marked_by"`
+    // ExcuseID is the approved excuse an excused absence came from.
+    ExcuseID     *int    `json:"excuse_id,omitempty"`
 }
 
 var pool *pgxpool.Pool
@@ -78,15 +90,9 @@ func GetStudentHandler(c echo.Context) error{
         return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
     }
 
-    userRole := c.Get("user_role").(string)
-    userID := c.Get("user_id").(int)
-    
-    if userRole == "student" {
-        var studentID int
-        err := pool.QueryRow(context.Background(), "SELECT student_id FROM users WHERE id = $1", userID).Scan(&studentID)
-        if err != nil || studentID != id {
-            return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own profile"})
-        }
+    allowed, err := canViewStudent(c, id)
+    if err != nil || !allowed {
+        return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own profile"})
     }
 
     student, err := getStudentById(pool, id)
@@ -96,26 +102,18 @@ func GetStudentHandler(c echo.Context) error{
         }
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
     }
+    // Soft-deleted students are gone unless an admin asks for them.
+    if student.DeletedAt != nil && !(c.Get("user_role").(string) == "admin" && c.QueryParam("include_deleted") == "true") {
+        return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+    }
     return c.JSON(http.StatusOK, student)
 }
 
 func getStudentById(pool *pgxpool.Pool, id int) (*Student, error) {
-    student := &Student{}
-
-    query := `
-        SELECT s.id, s.full_name, s.gender, s.birth_date::text, s.group_id, sg.group_name 
-        FROM students s
-        LEFT JOIN student_groups sg ON s.group_id = sg.id
+    query := studentSelectQuery + `
         WHERE s.id = $1
     `
-    row := pool.QueryRow(context.Background(), query, id)
-
-    err := row.Scan(&student.ID, &student.FullName, &student.Gender, &student.BirthDate, &student.GroupID, &student.GroupName)
-    if err != nil {
-        return nil, err
-    }
-
-    return student, nil
+    return scanStudent(pool.QueryRow(context.Background(), query, id))
 }
 
 func GetAllStudentsHandler(c echo.Context) error {
@@ -126,11 +124,16 @@ func GetAllStudentsHandler(c echo.Context) error {
             COALESCE(s.gender, 'Unknown') as gender,
             COALESCE(s.birth_date::text, '') as birth_date,
             COALESCE(s.group_id, 0) as group_id,
-            COALESCE(sg.group_name, 'No Group') as group_name
+            COALESCE(sg.group_name, 'No Group') as group_name,
+            COALESCE(s.email, u.email) as email,
+            COALESCE(s.phone, '') as phone,
+            COALESCE(s.student_id_number, '') as student_id_number,
+            COALESCE(s.enrollment_date::text, '') as enrollment_date,
+            COALESCE(s.status, 'Active') as status
         FROM users u
         LEFT JOIN students s ON u.student_id = s.id
         LEFT JOIN student_groups sg ON s.group_id = sg.id
-        WHERE u.role = 'student'
+        WHERE u.role = 'student' AND (s.id IS NULL OR s.deleted_at IS NULL)
         
         UNION
         
@@ -138,12 +141,18 @@ func GetAllStudentsHandler(c echo.Context) error {
             s.id,
             s.full_name,
             s.gender,
-            s.birth_date::text,
-            s.group_id,
-            COALESCE(sg.group_name, 'No Group') as group_name
+            COALESCE(s.birth_date::text, '') as birth_date,
+            COALESCE(s.group_id, 0) as group_id,
+            COALESCE(sg.group_name, 'No Group') as group_name,
+            COALESCE(s.email, '') as email,
+            COALESCE(s.phone, '') as phone,
+            COALESCE(s.student_id_number, '') as student_id_number,
+            COALESCE(s.enrollment_date::text, '') as enrollment_date,
+            COALESCE(s.status, 'Active') as status
         FROM students s
         LEFT JOIN student_groups sg ON s.group_id = sg.id
         WHERE s.id NOT IN (SELECT student_id FROM users WHERE student_id IS NOT NULL)
+            AND s.deleted_at IS NULL
         
         ORDER BY id DESC
     `
@@ -157,7 +166,8 @@ func GetAllStudentsHandler(c echo.Context) error {
     var students []Student
     for rows.Next() {
         var student Student
-        err := rows.Scan(&student.ID, &student.FullName, &student.Gender, &student.BirthDate, &student.GroupID, &student.GroupName)
+        err := rows.Scan(&student.ID, &student.FullName, &student.Gender, &student.BirthDate, &student.GroupID, &student.GroupName,
+            &student.Email, &student.Phone, &student.StudentIDNumber, &student.EnrollmentDate, &student.Status)
         if err != nil {
             fmt.Printf("Row scan error: %v\n", err)
             return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
@@ -169,11 +179,14 @@ func GetAllStudentsHandler(c echo.Context) error {
 }
 
 type CreateStudentRequest struct {
-    FullName  string `json:"full_name"`
-    Gender    string `json:"gender"`
-    BirthDate string `json:"birth_date"`
-    GroupID   int    `json:"group_id"`
-    UserID    int    `json:"user_id,omitempty"`
+    FullName        string `json:"full_name"`
+    Gender          string `json:"gender"`
+    BirthDate       string `json:"birth_date"`
+    GroupID         int    `json:"group_id"`
+    UserID          int    `json:"user_id,omitempty"`
+    Email           string `json:"email,omitempty"`
+    Phone           string `json:"phone,omitempty"`
+    StudentIDNumber string `json:"student_id_number,omitempty"`
 }
 
 func CreateStudentHandler(c echo.Context) error {
@@ -187,9 +200,17 @@ func CreateStudentHandler(c echo.Context) error {
     }
 
     var studentID int
-    query := `INSERT INTO students (full_name, gender, birth_date, group_id) VALUES ($1, $2, $3, $4) RETURNING id`
-    err := pool.QueryRow(context.Background(), query, req.FullName, req.Gender, req.BirthDate, req.GroupID).Scan(&studentID)
+    query := `
+        INSERT INTO students (full_name, gender, birth_date, group_id, email, phone, student_id_number)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''))
+        RETURNING id
+    `
+    err := pool.QueryRow(context.Background(), query, req.FullName, req.Gender, req.BirthDate, req.GroupID,
+        req.Email, req.Phone, req.StudentIDNumber).Scan(&studentID)
     if err != nil {
+        if isUniqueViolation(err) {
+            return c.JSON(http.StatusConflict, map[string]string{"error": "Email or student ID number is already taken"})
+        }
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create student"})
     }
 
@@ -201,11 +222,14 @@ func CreateStudentHandler(c echo.Context) error {
     }
 
     return c.JSON(http.StatusCreated, map[string]interface{}{
-        "id":         studentID,
-        "full_name":  req.FullName,
-        "gender":     req.Gender,
-        "birth_date": req.BirthDate,
-        "group_id":   req.GroupID,
+        "id":                studentID,
+        "full_name":         req.FullName,
+        "gender":            req.Gender,
+        "birth_date":        req.BirthDate,
+        "group_id":          req.GroupID,
+        "email":             req.Email,
+        "phone":             req.Phone,
+        "student_id_number": req.StudentIDNumber,
     })
 }
 
@@ -274,183 +298,124 @@ func CreateStudentFromUserHandler(c echo.Context) error {
 }
 
 func GetAllGroupsHandler(c echo.Context) error {
-    query := `SELECT id, group_name, faculty_id, course_year FROM student_groups ORDER BY group_name`
-    rows, err := pool.Query(context.Background(), query)
+    groups, err := getAllGroups(pool)
     if err != nil {
         fmt.Printf("Failed to get groups: %v\n", err)
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch groups"})
     }
-    defer rows.Close()
-
-    var groups []map[string]interface{}
-    for rows.Next() {
-        var id, facultyID, courseYear int
-        var groupName string
-        err := rows.Scan(&id, &groupName, &facultyID, &courseYear)
-        if err != nil {
-            fmt.Printf("Failed to scan group: %v\n", err)
-            continue
-        }
-        groups = append(groups, map[string]interface{}{
-            "id":          id,
-            "group_name":  groupName,
-            "faculty_id":  facultyID,
-            "course_year": courseYear,
-        })
-    }
 
     return c.JSON(http.StatusOK, groups)
 }
 
-func GetAllSubjectsHandler(c echo.Context) error {
-    query := `SELECT id, subject_name, subject_code, credits FROM subjects ORDER BY subject_name`
-    rows, err := pool.Query(context.Background(), query)
-    if err != nil {
-        fmt.Printf("Failed to get subjects: %v\n", err)
-        return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch subjects"})
+func PostAttendanceHandler(c echo.Context) error{
+    var attendance Attendance
+    if err := c.Bind(&attendance); err!=nil{
+        fmt.Printf("Bind error: %v\n", err)
+        return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+    }
+    
+    fmt.Printf("Received attendance: StudentId=%d, SubjectID=%d, VisitDay=%s, Visited=%v\n", 
+        attendance.StudentId, attendance.SubjectID, attendance.VisitDay, attendance.Visited)
+    
+    if !(attendance.StudentId > 0) || !(attendance.SubjectID > 0) || (attendance.VisitDay == "" && attendance.SessionID == nil) {
+        fmt.Printf("Validation failed: StudentId=%d, SubjectID=%d, VisitDay=%s\n", 
+            attendance.StudentId, attendance.SubjectID, attendance.VisitDay)
+        return c.JSON(http.StatusBadRequest, map[string]string{"error": "Bad request: missing required fields"})
     }
-    defer rows.Close()
 
-    var subjects []map[string]interface{}
-    for rows.Next() {
-        var id, credits int
-        var subjectName, subjectCode string
-        err := rows.Scan(&id, &subjectName, &subjectCode, &credits)
-        if err != nil {
-            fmt.Printf("Failed to scan subject: %v\n", err)
-            continue
+    if attendance.Status == "" {
+        attendance.Status = "absent"
+        if attendance.Visited {
+            attendance.Status = "present"
         }
-        subjects = append(subjects, map[string]interface{}{
-            "id":           id,
-            "subject_name": subjectName,
-            "subject_code": subjectCode,
-            "credits":      credits,
-        })
     }
+    if msg := normalizeAttendanceMark(&attendance.Status, &attendance.MinutesLate); msg != "" {
+        return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+    }
+    attendance.Visited = attendanceVisited(attendance.Status)
 
-    return c.JSON(http.StatusOK, subjects)
-}
+    markedBy := c.Get("user_id").(int)
+    attendance.MarkedBy = &markedBy
 
-func GetAllScheduleHandler(c echo.Context) error{
-    schedules, err := getAllSchedules(pool)
+    msg, err := resolveAttendanceSession(context.Background(), &attendance)
     if err != nil {
+        fmt.Printf("Database error resolving lesson session: %v\n", err)
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
     }
-    return c.JSON(http.StatusOK, schedules)
-}
-
-func getAllSchedules(pool *pgxpool.Pool) ([]Schedule, error) {
-    query := `
-        SELECT s.id, s.subject_name, s.time_slot, s.group_id, sg.group_name
-        FROM schedule s
-        LEFT JOIN student_groups sg ON s.group_id = sg.id
-        ORDER BY s.id
-    `
-    rows, err := pool.Query(context.Background(), query)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var schedules []Schedule
-    for rows.Next() {
-        var schedule Schedule
-        err := rows.Scan(&schedule.ID, &schedule.SubjectName, &schedule.TimeSlot, &schedule.GroupID, &schedule.GroupName)
-        if err != nil {
-            return nil, err
-        }
-        schedules = append(schedules, schedule)
+    if msg != "" {
+        return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
     }
 
-    return schedules, nil
-}
-
-func GetScheduleByGroupHandler(c echo.Context) error{
-    idStr := c.Param("id")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+    if attendanceLocked(c, attendance.VisitDay) {
+        return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceLockedMessage()})
     }
-
-    schedules, err := getScheduleByGroupId(pool, id)
+    allowed, err := teachesLessons(context.Background(), pool, c, []int{*attendance.SessionID})
     if err != nil {
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
     }
-    return c.JSON(http.StatusOK, schedules)
-}
-
-func getScheduleByGroupId(pool *pgxpool.Pool, groupId int) ([]Schedule, error) {
-    query := `
-        SELECT s.id, s.subject_name, s.time_slot, s.group_id, sg.group_name
-        FROM schedule s
-        LEFT JOIN student_groups sg ON s.group_id = sg.id
-        WHERE s.group_id = $1
-    `
-    rows, err := pool.Query(context.Background(), query, groupId)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var schedules []Schedule
-    for rows.Next() {
-        var schedule Schedule
-        err := rows.Scan(&schedule.ID, &schedule.SubjectName, &schedule.TimeSlot, &schedule.GroupID, &schedule.GroupName)
-        if err != nil {
-            return nil, err
-        }
-        schedules = append(schedules, schedule)
-    }
-
-    return schedules, nil
-}
-
-func PostAttendanceHandler(c echo.Context) error{
-    var attendance Attendance
-    if err := c.Bind(&attendance); err!=nil{
-        fmt.Printf("Bind error: %v\n", err)
-        return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
-    }
-    
-    fmt.Printf("Received attendance: StudentId=%d, SubjectID=%d, VisitDay=%s, Visited=%v\n", 
-        attendance.StudentId, attendance.SubjectID, attendance.VisitDay, attendance.Visited)
-    
-    if !(attendance.StudentId > 0) || !(attendance.SubjectID > 0) || (attendance.VisitDay == "") {
-        fmt.Printf("Validation failed: StudentId=%d, SubjectID=%d, VisitDay=%s\n", 
-            attendance.StudentId, attendance.SubjectID, attendance.VisitDay)
-        return c.JSON(http.StatusBadRequest, map[string]string{"error": "Bad request: missing required fields"})
+    if !allowed {
+        return c.JSON(http.StatusForbidden, map[string]string{"error": attendanceOwnershipMessage})
     }
 
     createdAttendance, err := createAttendance(pool, &attendance)
      if err != nil {
+        if isUniqueViolation(err) {
+            return c.JSON(http.StatusConflict, map[string]string{"error": "Attendance is already recorded for this student, subject and day; use POST /attendance/session to change it"})
+        }
         fmt.Printf("Database error creating attendance: %v\n", err)
         return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error", "details": err.Error()})
     }
+    notifyAttendance(createdAttendance.ID)
 
     return c.JSON(http.StatusCreated, createdAttendance)
 }
 
 
 func createAttendance(pool *pgxpool.Pool, attendance *Attendance) (*Attendance, error) {
+    ctx := context.Background()
+    tx, err := pool.Begin(ctx)
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback(ctx)
+
+    if err := applyApprovedExcuse(ctx, tx, attendance); err != nil {
+        return nil, err
+    }
+
     query := `
-        INSERT INTO attendance (subject_id, visit_day, visited, student_id)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO attendance (subject_id, visit_day, visited, status, minutes_late, status_reason, student_id, session_id, remarks, marked_by, excuse_id)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
         RETURNING id
     `
     
-    err := pool.QueryRow(
-        context.Background(),
+    err = tx.QueryRow(
+        ctx,
         query,
         attendance.SubjectID,
         attendance.VisitDay,
         attendance.Visited,
+        attendance.Status,
+        attendance.MinutesLate,
+        attendance.StatusReason,
         attendance.StudentId,
+        attendance.SessionID,
+        attendance.Remarks,
+        attendance.MarkedBy,
+        attendance.ExcuseID,
     ).Scan(&attendance.ID)
     
     if err != nil {
         return nil, err
     }
 
+    if err := recordAttendanceRevision(ctx, tx, attendance.ID, "create", nil, attendance, nil, attendance.MarkedBy); err != nil {
+        return nil, err
+    }
+    if err := tx.Commit(ctx); err != nil {
+        return nil, err
+    }
+
     return attendance, nil
 }
 
@@ -461,57 +426,16 @@ func GetAttendanceByStudentIdHandler(c echo.Context) error {
         return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
     }
 
-    userRole := c.Get("user_role").(string)
-    userID := c.Get("user_id").(int)
-    
-    if userRole == "student" {
-        var studentIDFromUser *int
-        err := pool.QueryRow(context.Background(), "SELECT student_id FROM users WHERE id = $1", userID).Scan(&studentIDFromUser)
-        if err != nil {
-            fmt.Printf("Error getting student_id from users: %v\n", err)
-            return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: unable to verify student"})
-        }
-        if studentIDFromUser == nil || *studentIDFromUser != studentId {
-            return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own attendance"})
-        }
-    }
-
-    attendances, err := getAttendanceByStudentId(pool, studentId)
-    if err != nil {
-        fmt.Printf("Error getting attendance by student ID %d: %v\n", studentId, err)
-        return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-    }
-
-    return c.JSON(http.StatusOK, attendances)
-}
-
-func getAttendanceByStudentId(pool *pgxpool.Pool, id int) ([]Attendance, error) {
-    query := `
-        SELECT a.id, a.subject_id, a.visit_day::text, a.visited, a.student_id
-        FROM attendance a
-        WHERE a.student_id = $1
-        ORDER BY a.visit_day DESC
-        LIMIT 50
-    `
-    
-    rows, err := pool.Query(context.Background(), query, id)
+    allowed, err := canViewStudent(c, studentId)
     if err != nil {
-        return nil, err
+        fmt.Printf("Error verifying access to student %d: %v\n", studentId, err)
+        return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: unable to verify student"})
     }
-    defer rows.Close()
-
-    var attendances []Attendance
-    for rows.Next() {
-        var attendance Attendance
-        err := rows.Scan(&attendance.ID, &attendance.SubjectID, &attendance.VisitDay, &attendance.Visited, &attendance.StudentId)
-        if err != nil {
-            fmt.Printf("Error scanning attendance row: %v\n", err)
-            return nil, err
-        }
-        attendances = append(attendances, attendance)
+    if !allowed {
+        return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own attendance"})
     }
 
-    return attendances, nil
+    return listAttendance(c, "a.student_id = $%d", studentId)
 }
 
 func GetAttendanceBySubjectIdHandler(c echo.Context) error {
@@ -520,40 +444,6 @@ func GetAttendanceBySubjectIdHandler(c echo.Context) error {
         return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
     }
 
-    attendances, err := getAttendanceBySubjectId(pool, subjectId)
-    if err != nil {
-        return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
-    }
-
-    return c.JSON(http.StatusOK, attendances)
-}
-
-func getAttendanceBySubjectId(pool *pgxpool.Pool, id int) ([]Attendance, error) {
-    query := `
-        SELECT a.id, a.subject_id, a.visit_day::text, a.visited, a.student_id
-        FROM attendance a
-        WHERE a.subject_id = $1
-        ORDER BY a.visit_day DESC
-        LIMIT 50
-    `
-
-    rows, err := pool.Query(context.Background(), query, id)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var attendances []Attendance
-    for rows.Next() {
-        var attendance Attendance
-        err := rows.Scan(&attendance.ID, &attendance.SubjectID, &attendance.VisitDay, &attendance.Visited, &attendance.StudentId)
-        if err != nil {
-            fmt.Printf("Error scanning attendance row: %v\n", err)
-            return nil, err
-        }
-        attendances = append(attendances, attendance)
-    }
-
-    return attendances, nil
+    return listAttendance(c, "a.subject_id = $%d", subjectId)
 }
 
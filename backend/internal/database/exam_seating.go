@@ -0,0 +1,401 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type ExamSeat struct {
+	StudentID       int     `json:"student_id"`
+	StudentName     string  `json:"student_name"`
+	StudentIDNumber *string `json:"student_id_number"`
+	RoomID          int     `json:"room_id"`
+	RoomNumber      string  `json:"room_number"`
+	SeatNumber      int     `json:"seat_number"`
+}
+
+type SeatingRequest struct {
+	// Order is "alphabetical" (default) or "random".
+	Order string `json:"order"`
+	// Spacing leaves that many empty seats between students when the rooms
+	// are large enough; it is reduced automatically otherwise.
+	Spacing int `json:"spacing"`
+}
+
+type ExamMark struct {
+	StudentID  int     `json:"student_id"`
+	GradeValue float64 `json:"grade_value"`
+	Remarks    *string `json:"remarks"`
+}
+
+type ExamMarksRequest struct {
+	MaxGrade *float64   `json:"max_grade"`
+	Marks    []ExamMark `json:"marks"`
+}
+
+type examSeatRoom struct {
+	ID         int
+	RoomNumber string
+	Capacity   int
+}
+
+// assignSeats places students room by room, leaving spacing empty seats
+// between neighbours. It returns nil when they do not fit.
+func assignSeats(students []int, rooms []examSeatRoom, spacing int) []ExamSeat {
+	seats := make([]ExamSeat, 0, len(students))
+	next := 0
+	for _, room := range rooms {
+		for seat := 1; seat <= room.Capacity && next < len(students); seat += spacing + 1 {
+			seats = append(seats, ExamSeat{StudentID: students[next], RoomID: room.ID, RoomNumber: room.RoomNumber, SeatNumber: seat})
+			next++
+		}
+	}
+	if next < len(students) {
+		return nil
+	}
+	return seats
+}
+
+const examSeatSelectQuery = `
+    SELECT es.student_id, s.full_name, s.student_id_number, es.room_id, r.room_number, es.seat_number
+    FROM exam_seats es
+    JOIN students s ON es.student_id = s.id
+    JOIN rooms r ON es.room_id = r.id
+`
+
+// getExamSeats returns the seats of an exam, only those of studentIDs when
+// it is not nil.
+func getExamSeats(ctx context.Context, examID int, studentIDs []int) ([]ExamSeat, error) {
+	query := examSeatSelectQuery + ` WHERE es.exam_id = $1`
+	args := []interface{}{examID}
+	if studentIDs != nil {
+		query += ` AND es.student_id = ANY($2)`
+		args = append(args, studentIDs)
+	}
+	query += ` ORDER BY r.room_number, es.seat_number`
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seats := []ExamSeat{}
+	for rows.Next() {
+		var s ExamSeat
+		if err := rows.Scan(&s.StudentID, &s.StudentName, &s.StudentIDNumber, &s.RoomID, &s.RoomNumber, &s.SeatNumber); err != nil {
+			return nil, err
+		}
+		seats = append(seats, s)
+	}
+	return seats, rows.Err()
+}
+
+// GetExamSeatingHandler returns the seating plan. Students only see their
+// own seat and guardians those of their children.
+func GetExamSeatingHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	studentIDs, restricted, err := scopedStudentIDs(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if restricted && len(studentIDs) == 0 {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Account is not linked to a student"})
+	}
+
+	seats, err := getExamSeats(context.Background(), id, studentIDs)
+	if err != nil {
+		fmt.Printf("GetExamSeatingHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, seats)
+}
+
+// GenerateExamSeatingHandler (re)builds the seating plan of an exam from the
+// active students of its group and the rooms assigned to it.
+func GenerateExamSeatingHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	var req SeatingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.Order == "" {
+		req.Order = "alphabetical"
+	}
+	if req.Order != "alphabetical" && req.Order != "random" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "order must be alphabetical or random"})
+	}
+	if req.Spacing < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "spacing must not be negative"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var groupID int
+	if err := tx.QueryRow(ctx, "SELECT group_id FROM exams WHERE id = $1 FOR UPDATE", id).Scan(&groupID); err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	rows, err := tx.Query(ctx, `
+        SELECT id FROM students
+        WHERE group_id = $1 AND deleted_at IS NULL AND status = 'Active'
+        ORDER BY full_name, id
+    `, groupID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	students := []int{}
+	for rows.Next() {
+		var studentID int
+		if err := rows.Scan(&studentID); err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		students = append(students, studentID)
+	}
+	rows.Close()
+	if req.Order == "random" {
+		rand.Shuffle(len(students), func(i, j int) { students[i], students[j] = students[j], students[i] })
+	}
+
+	rows, err = tx.Query(ctx, `
+        SELECT r.id, r.room_number, r.capacity
+        FROM exam_rooms er
+        JOIN rooms r ON er.room_id = r.id
+        JOIN buildings b ON r.building_id = b.id
+        WHERE er.exam_id = $1
+        ORDER BY b.building_name, r.room_number
+    `, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	var rooms []examSeatRoom
+	for rows.Next() {
+		var room examSeatRoom
+		if err := rows.Scan(&room.ID, &room.RoomNumber, &room.Capacity); err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		rooms = append(rooms, room)
+	}
+	rows.Close()
+
+	var seats []ExamSeat
+	for spacing := req.Spacing; spacing >= 0 && seats == nil; spacing-- {
+		seats = assignSeats(students, rooms, spacing)
+	}
+	if seats == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": fmt.Sprintf("The exam rooms do not have enough seats for %d students", len(students))})
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM exam_seats WHERE exam_id = $1", id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save seating plan"})
+	}
+	for _, s := range seats {
+		_, err := tx.Exec(ctx, "INSERT INTO exam_seats (exam_id, student_id, room_id, seat_number) VALUES ($1, $2, $3, $4)",
+			id, s.StudentID, s.RoomID, s.SeatNumber)
+		if err != nil {
+			fmt.Printf("Failed to save exam seat: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save seating plan"})
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save seating plan"})
+	}
+
+	plan, err := getExamSeats(ctx, id, nil)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Seating plan saved but failed to load it"})
+	}
+	return c.JSON(http.StatusCreated, plan)
+}
+
+// canMarkExam reports whether a teacher may enter marks for an exam: they
+// invigilate it or teach the subject to the group.
+func canMarkExam(ctx context.Context, exam *Exam, teacherID int) (bool, error) {
+	for _, inv := range exam.Invigilators {
+		if inv.TeacherID == teacherID {
+			return true, nil
+		}
+	}
+	var teaches bool
+	err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM schedule WHERE subject_id = $1 AND group_id = $2 AND teacher_id = $3)",
+		exam.SubjectID, exam.GroupID, teacherID).Scan(&teaches)
+	return teaches, err
+}
+
+// SubmitExamMarksHandler records exam results as grades of the exam's type
+// (Midterm or Final). Submitting again for a student updates their grade.
+func SubmitExamMarksHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	var req ExamMarksRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if len(req.Marks) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "marks must not be empty"})
+	}
+	maxGrade := 100.0
+	if req.MaxGrade != nil {
+		maxGrade = *req.MaxGrade
+	}
+	if maxGrade <= 0 || maxGrade > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_grade must be between 0 and 100"})
+	}
+
+	ctx := context.Background()
+	exam, err := getExamById(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if c.Get("user_role").(string) == "teacher" {
+		allowed := false
+		if teacherID != nil {
+			if allowed, err = canMarkExam(ctx, exam, *teacherID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+		}
+		if !allowed {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you neither teach nor invigilate this exam"})
+		}
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	participants, err := examParticipants(ctx, tx, exam.ID, exam.GroupID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	sits := map[int]bool{}
+	for _, studentID := range participants {
+		sits[studentID] = true
+	}
+
+	seen := map[int]bool{}
+	for _, m := range req.Marks {
+		switch {
+		case !sits[m.StudentID]:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Student %d does not sit this exam", m.StudentID)})
+		case seen[m.StudentID]:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Student %d is listed twice", m.StudentID)})
+		case m.GradeValue < 0 || m.GradeValue > maxGrade:
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Mark of student %d must be between 0 and %g", m.StudentID, maxGrade)})
+		}
+		seen[m.StudentID] = true
+	}
+
+	for _, m := range req.Marks {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO grades (student_id, subject_id, grade_type, grade_value, max_grade, exam_date, remarks, graded_by, semester_id, exam_id)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+            ON CONFLICT (exam_id, student_id) WHERE exam_id IS NOT NULL DO UPDATE
+            SET grade_value = EXCLUDED.grade_value, max_grade = EXCLUDED.max_grade, remarks = EXCLUDED.remarks,
+                graded_by = EXCLUDED.graded_by, updated_at = CURRENT_TIMESTAMP
+        `, m.StudentID, exam.SubjectID, exam.ExamType, m.GradeValue, maxGrade, exam.ExamDate, m.Remarks, teacherID,
+			exam.SemesterID, exam.ID)
+		if err != nil {
+			fmt.Printf("Failed to save exam mark: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save marks"})
+		}
+	}
+
+	if err := writeAuditLog(ctx, tx, c, "submit_exam_marks", "exams", exam.ID, nil, req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save marks"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save marks"})
+	}
+
+	grades, err := getExamGrades(ctx, exam.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Marks saved but failed to load them"})
+	}
+
+	var notices []inAppNotice
+	for _, g := range grades {
+		if !seen[g.StudentID] {
+			continue
+		}
+		notices = append(notices, inAppNotice{
+			Event:      "grade",
+			StudentIDs: []int{g.StudentID},
+			Title:      "New grade in " + g.SubjectName,
+			Body:       fmt.Sprintf("%g/%g for the %s on %s.", g.GradeValue, g.MaxGrade, g.GradeType, exam.ExamDate),
+			Data:       map[string]interface{}{"grade_id": g.ID, "exam_id": exam.ID, "student_id": g.StudentID, "subject_id": g.SubjectID},
+		})
+	}
+	notifyInApp(notices...)
+
+	return c.JSON(http.StatusOK, grades)
+}
+
+func getExamGrades(ctx context.Context, examID int) ([]Grade, error) {
+	rows, err := pool.Query(ctx, gradeSelectQuery+` WHERE g.exam_id = $1 ORDER BY g.student_id`, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grades := []Grade{}
+	for rows.Next() {
+		g, err := scanGrade(rows)
+		if err != nil {
+			return nil, err
+		}
+		grades = append(grades, *g)
+	}
+	return grades, rows.Err()
+}
+
+func GetExamMarksHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	grades, err := getExamGrades(context.Background(), id)
+	if err != nil {
+		fmt.Printf("GetExamMarksHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, grades)
+}
@@ -0,0 +1,802 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type ExamRoom struct {
+	RoomID       int    `json:"room_id"`
+	RoomNumber   string `json:"room_number"`
+	BuildingName string `json:"building_name"`
+	Capacity     int    `json:"capacity"`
+}
+
+type ExamInvigilator struct {
+	TeacherID   int    `json:"teacher_id"`
+	TeacherName string `json:"teacher_name"`
+}
+
+type Exam struct {
+	ID            int               `json:"id"`
+	ExamPeriodID  int               `json:"exam_period_id"`
+	ExamPeriod    string            `json:"exam_period"`
+	SemesterID    int               `json:"semester_id"`
+	Semester      string            `json:"semester"`
+	SubjectID     int               `json:"subject_id"`
+	SubjectName   string            `json:"subject_name"`
+	SubjectCode   string            `json:"subject_code"`
+	GroupID       int               `json:"group_id"`
+	GroupName     string            `json:"group_name"`
+	ExamType      string            `json:"exam_type"`
+	ExamDate      string            `json:"exam_date"`
+	StartTime     string            `json:"start_time"`
+	EndTime       string            `json:"end_time"`
+	Notes         *string           `json:"notes"`
+	Rooms         []ExamRoom        `json:"rooms"`
+	Invigilators  []ExamInvigilator `json:"invigilators"`
+	SeatsAssigned int               `json:"seats_assigned"`
+	CreatedBy     *int              `json:"created_by"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type ExamRequest struct {
+	ExamPeriodID   int     `json:"exam_period_id"`
+	SubjectID      int     `json:"subject_id"`
+	GroupID        int     `json:"group_id"`
+	ExamType       string  `json:"exam_type"`
+	ExamDate       string  `json:"exam_date"`
+	StartTime      string  `json:"start_time"`
+	EndTime        string  `json:"end_time"`
+	Notes          *string `json:"notes"`
+	RoomIDs        []int   `json:"room_ids"`
+	InvigilatorIDs []int   `json:"invigilator_ids"`
+}
+
+// ExamConflict describes a clash of an exam with another exam, a room
+// booking or a lesson. StudentIDs lists the students sitting both exams.
+type ExamConflict struct {
+	Type                string `json:"type"`
+	ExamID              int    `json:"exam_id,omitempty"`
+	ConflictingID       int    `json:"conflicting_id"`
+	ExamDate            string `json:"exam_date"`
+	TimeSlot            string `json:"time_slot"`
+	ConflictingTimeSlot string `json:"conflicting_time_slot"`
+	Resource            string `json:"resource"`
+	StudentIDs          []int  `json:"student_ids,omitempty"`
+}
+
+var validExamTypes = map[string]bool{"Midterm": true, "Final": true}
+
+// examParticipantsCTE lists who sits each exam: the seating plan once it has
+// been generated, the active students of the group before that.
+const examParticipantsCTE = `
+    WITH participants AS (
+        SELECT e.id AS exam_id, s.id AS student_id
+        FROM exams e
+        JOIN students s ON s.group_id = e.group_id AND s.deleted_at IS NULL AND s.status = 'Active'
+        WHERE NOT EXISTS (SELECT 1 FROM exam_seats es WHERE es.exam_id = e.id)
+        UNION
+        SELECT exam_id, student_id FROM exam_seats
+    )
+`
+
+const examSelectQuery = `
+    SELECT e.id, e.exam_period_id, ep.name, ep.semester_id, sem.name, e.subject_id, sub.subject_name, sub.subject_code,
+        e.group_id, sg.group_name, e.exam_type, e.exam_date::text, to_char(e.start_time, 'HH24:MI'), to_char(e.end_time, 'HH24:MI'),
+        e.notes, (SELECT COUNT(*) FROM exam_seats es WHERE es.exam_id = e.id), e.created_by, e.created_at
+    FROM exams e
+    JOIN exam_periods ep ON e.exam_period_id = ep.id
+    JOIN semesters sem ON ep.semester_id = sem.id
+    JOIN subjects sub ON e.subject_id = sub.id
+    JOIN student_groups sg ON e.group_id = sg.id
+`
+
+func scanExam(row pgx.Row) (*Exam, error) {
+	e := &Exam{Rooms: []ExamRoom{}, Invigilators: []ExamInvigilator{}}
+	err := row.Scan(&e.ID, &e.ExamPeriodID, &e.ExamPeriod, &e.SemesterID, &e.Semester, &e.SubjectID, &e.SubjectName, &e.SubjectCode,
+		&e.GroupID, &e.GroupName, &e.ExamType, &e.ExamDate, &e.StartTime, &e.EndTime,
+		&e.Notes, &e.SeatsAssigned, &e.CreatedBy, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// attachExamResources fills in the rooms and invigilators of the exams.
+func attachExamResources(ctx context.Context, exams []Exam) error {
+	if len(exams) == 0 {
+		return nil
+	}
+	index := map[int]*Exam{}
+	ids := make([]int, 0, len(exams))
+	for i := range exams {
+		index[exams[i].ID] = &exams[i]
+		ids = append(ids, exams[i].ID)
+	}
+
+	rows, err := pool.Query(ctx, `
+        SELECT er.exam_id, r.id, r.room_number, b.building_name, r.capacity
+        FROM exam_rooms er
+        JOIN rooms r ON er.room_id = r.id
+        JOIN buildings b ON r.building_id = b.id
+        WHERE er.exam_id = ANY($1)
+        ORDER BY b.building_name, r.room_number
+    `, ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var examID int
+		var room ExamRoom
+		if err := rows.Scan(&examID, &room.RoomID, &room.RoomNumber, &room.BuildingName, &room.Capacity); err != nil {
+			rows.Close()
+			return err
+		}
+		index[examID].Rooms = append(index[examID].Rooms, room)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = pool.Query(ctx, `
+        SELECT ei.exam_id, t.id, t.full_name
+        FROM exam_invigilators ei
+        JOIN teachers t ON ei.teacher_id = t.id
+        WHERE ei.exam_id = ANY($1)
+        ORDER BY t.full_name
+    `, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var examID int
+		var inv ExamInvigilator
+		if err := rows.Scan(&examID, &inv.TeacherID, &inv.TeacherName); err != nil {
+			return err
+		}
+		index[examID].Invigilators = append(index[examID].Invigilators, inv)
+	}
+	return rows.Err()
+}
+
+func getExamById(ctx context.Context, id int) (*Exam, error) {
+	exam, err := scanExam(pool.QueryRow(ctx, examSelectQuery+` WHERE e.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+	exams := []Exam{*exam}
+	if err := attachExamResources(ctx, exams); err != nil {
+		return nil, err
+	}
+	return &exams[0], nil
+}
+
+func GetExamsHandler(c echo.Context) error {
+	ctx := context.Background()
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	for _, f := range []struct{ param, column string }{
+		{"exam_period_id", "e.exam_period_id"},
+		{"subject_id", "e.subject_id"},
+		{"group_id", "e.group_id"},
+	} {
+		if v := c.QueryParam(f.param); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + f.param})
+			}
+			where(f.column+" = $%d", id)
+		}
+	}
+	if v := c.QueryParam("teacher_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid teacher_id"})
+		}
+		where("EXISTS (SELECT 1 FROM exam_invigilators ei WHERE ei.exam_id = e.id AND ei.teacher_id = $%d)", id)
+	}
+	if v := c.QueryParam("semester"); v != "" {
+		sem, err := resolveSemester(ctx, pool, v)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		where("ep.semester_id = $%d", sem.ID)
+	}
+	if v := c.QueryParam("exam_type"); v != "" {
+		where("e.exam_type = $%d", v)
+	}
+
+	query := examSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY e.exam_date, e.start_time, e.id"
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		fmt.Printf("GetExamsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	exams := []Exam{}
+	for rows.Next() {
+		exam, err := scanExam(rows)
+		if err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		exams = append(exams, *exam)
+	}
+	rows.Close()
+
+	if err := attachExamResources(ctx, exams); err != nil {
+		fmt.Printf("GetExamsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, exams)
+}
+
+func GetExamHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	exam, err := getExamById(context.Background(), id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, exam)
+}
+
+func uniqueIDs(ids []int) []int {
+	seen := map[int]bool{}
+	out := []int{}
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// examParticipants returns the students sitting an exam. A new exam (id 0)
+// or one without a seating plan is sat by the active students of its group.
+func examParticipants(ctx context.Context, tx pgx.Tx, examID, groupID int) ([]int, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT student_id FROM exam_seats WHERE exam_id = $1
+        UNION
+        SELECT id FROM students
+        WHERE group_id = $2 AND deleted_at IS NULL AND status = 'Active'
+            AND NOT EXISTS (SELECT 1 FROM exam_seats WHERE exam_id = $1)
+        ORDER BY 1
+    `, examID, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		students = append(students, id)
+	}
+	return students, rows.Err()
+}
+
+// validateExamRequest checks the request against the calendar and the
+// referenced rows. It returns the exam's time range and a message for a 400
+// response.
+func validateExamRequest(ctx context.Context, tx pgx.Tx, id int, req *ExamRequest) (TimeRange, string, error) {
+	req.RoomIDs = uniqueIDs(req.RoomIDs)
+	req.InvigilatorIDs = uniqueIDs(req.InvigilatorIDs)
+
+	if req.ExamPeriodID <= 0 || req.SubjectID <= 0 || req.GroupID <= 0 {
+		return TimeRange{}, "exam_period_id, subject_id and group_id are required", nil
+	}
+	if !validExamTypes[req.ExamType] {
+		return TimeRange{}, "exam_type must be Midterm or Final", nil
+	}
+	date, err := parseDate(req.ExamDate)
+	if err != nil {
+		return TimeRange{}, "exam_date must be YYYY-MM-DD", nil
+	}
+	r, err := parseTimeSlot(req.StartTime + "-" + req.EndTime)
+	if err != nil {
+		return TimeRange{}, "start_time and end_time must look like 09:00 and end after start", nil
+	}
+	if len(req.RoomIDs) == 0 {
+		return TimeRange{}, "At least one room is required", nil
+	}
+
+	var period ExamPeriod
+	err = tx.QueryRow(ctx, "SELECT name, start_date::text, end_date::text FROM exam_periods WHERE id = $1", req.ExamPeriodID).
+		Scan(&period.Name, &period.StartDate, &period.EndDate)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return r, "Invalid exam_period_id", nil
+		}
+		return r, "", err
+	}
+	if req.ExamDate < period.StartDate || req.ExamDate > period.EndDate {
+		return r, fmt.Sprintf("exam_date must lie within %s (%s to %s)", period.Name, period.StartDate, period.EndDate), nil
+	}
+	var isHoliday bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM holidays WHERE holiday_date = $1)", date).Scan(&isHoliday); err != nil {
+		return r, "", err
+	}
+	if isHoliday {
+		return r, "exam_date is a holiday", nil
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM subjects WHERE id = $1)", req.SubjectID).Scan(&exists); err != nil {
+		return r, "", err
+	}
+	if !exists {
+		return r, "Invalid subject_id", nil
+	}
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM student_groups WHERE id = $1)", req.GroupID).Scan(&exists); err != nil {
+		return r, "", err
+	}
+	if !exists {
+		return r, "Invalid group_id", nil
+	}
+
+	capacity := 0
+	rows, err := tx.Query(ctx, "SELECT id, room_number, capacity, is_active FROM rooms WHERE id = ANY($1)", req.RoomIDs)
+	if err != nil {
+		return r, "", err
+	}
+	found := 0
+	for rows.Next() {
+		var roomID, roomCapacity int
+		var roomNumber string
+		var active bool
+		if err := rows.Scan(&roomID, &roomNumber, &roomCapacity, &active); err != nil {
+			rows.Close()
+			return r, "", err
+		}
+		if !active {
+			rows.Close()
+			return r, fmt.Sprintf("Room %s is not active", roomNumber), nil
+		}
+		capacity += roomCapacity
+		found++
+	}
+	rows.Close()
+	if found != len(req.RoomIDs) {
+		return r, "room_ids contains an unknown room", nil
+	}
+
+	students, err := examParticipants(ctx, tx, id, req.GroupID)
+	if err != nil {
+		return r, "", err
+	}
+	if len(students) > capacity {
+		return r, fmt.Sprintf("The rooms seat %d but %d students sit this exam", capacity, len(students)), nil
+	}
+
+	if len(req.InvigilatorIDs) > 0 {
+		var active int
+		err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM teachers WHERE id = ANY($1) AND status = 'Active'", req.InvigilatorIDs).Scan(&active)
+		if err != nil {
+			return r, "", err
+		}
+		if active != len(req.InvigilatorIDs) {
+			return r, "invigilator_ids must reference active teachers", nil
+		}
+	}
+
+	return r, "", nil
+}
+
+// checkExamConflicts looks for other exams at an overlapping time on the same
+// day that share a room, an invigilator or a student, and for room bookings
+// and lessons in the way. Weekly lessons are not materialized during exam
+// periods, so only lesson sessions are considered.
+func checkExamConflicts(ctx context.Context, tx pgx.Tx, id int, req *ExamRequest, r TimeRange) ([]ExamConflict, error) {
+	conflicts := []ExamConflict{}
+	base := ExamConflict{ExamID: id, ExamDate: req.ExamDate, TimeSlot: r.String()}
+
+	rows, err := tx.Query(ctx, `
+        SELECT id, group_id, to_char(start_time, 'HH24:MI') || '-' || to_char(end_time, 'HH24:MI')
+        FROM exams WHERE exam_date = $1 AND id <> $2
+    `, req.ExamDate, id)
+	if err != nil {
+		return nil, err
+	}
+	overlapping := map[int]string{}
+	var overlappingIDs []int
+	for rows.Next() {
+		var otherID, groupID int
+		var slot string
+		if err := rows.Scan(&otherID, &groupID, &slot); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		other, err := parseTimeSlot(slot)
+		if err != nil || !other.Overlaps(r) {
+			continue
+		}
+		overlapping[otherID] = other.String()
+		overlappingIDs = append(overlappingIDs, otherID)
+		if groupID == req.GroupID {
+			c := base
+			c.Type = "group"
+			c.ConflictingID = otherID
+			c.ConflictingTimeSlot = other.String()
+			c.Resource = fmt.Sprintf("group %d", groupID)
+			conflicts = append(conflicts, c)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(overlappingIDs) > 0 {
+		rows, err = tx.Query(ctx, `
+            SELECT er.exam_id, 'room', r.room_number FROM exam_rooms er JOIN rooms r ON er.room_id = r.id
+            WHERE er.exam_id = ANY($1) AND er.room_id = ANY($2)
+            UNION ALL
+            SELECT ei.exam_id, 'invigilator', t.full_name FROM exam_invigilators ei JOIN teachers t ON ei.teacher_id = t.id
+            WHERE ei.exam_id = ANY($1) AND ei.teacher_id = ANY($3)
+        `, overlappingIDs, req.RoomIDs, req.InvigilatorIDs)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			c := base
+			if err := rows.Scan(&c.ConflictingID, &c.Type, &c.Resource); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			c.ConflictingTimeSlot = overlapping[c.ConflictingID]
+			conflicts = append(conflicts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		students, err := examParticipants(ctx, tx, id, req.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		rows, err = tx.Query(ctx, examParticipantsCTE+`
+            SELECT exam_id, array_agg(student_id ORDER BY student_id)
+            FROM participants
+            WHERE exam_id = ANY($1) AND student_id = ANY($2)
+            GROUP BY exam_id
+        `, overlappingIDs, students)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			c := base
+			c.Type = "student"
+			if err := rows.Scan(&c.ConflictingID, &c.StudentIDs); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			c.ConflictingTimeSlot = overlapping[c.ConflictingID]
+			c.Resource = fmt.Sprintf("%d students", len(c.StudentIDs))
+			conflicts = append(conflicts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = tx.Query(ctx, roomBookingSelectQuery+` WHERE b.room_id = ANY($1) AND b.booking_date = $2`, req.RoomIDs, req.ExamDate)
+	if err != nil {
+		return nil, err
+	}
+	bookings, err := scanRoomBookings(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range bookings {
+		if br, err := bookingRange(b); err == nil && br.Overlaps(r) {
+			c := base
+			c.Type = "booking"
+			c.ConflictingID = b.ID
+			c.ConflictingTimeSlot = br.String()
+			c.Resource = fmt.Sprintf("%s: %s", b.RoomNumber, b.Purpose)
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	rows, err = tx.Query(ctx, `
+        SELECT id, time_slot, group_id, teacher_id, COALESCE(room_id, 0), COALESCE(room_number, '')
+        FROM lesson_sessions
+        WHERE session_date = $1 AND status = 'scheduled'
+            AND (group_id = $2 OR room_id = ANY($3) OR teacher_id = ANY($4))
+    `, req.ExamDate, req.GroupID, req.RoomIDs, req.InvigilatorIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rooms := map[int]bool{}
+	for _, roomID := range req.RoomIDs {
+		rooms[roomID] = true
+	}
+	invigilators := map[int]bool{}
+	for _, teacherID := range req.InvigilatorIDs {
+		invigilators[teacherID] = true
+	}
+	for rows.Next() {
+		var sessionID, groupID, teacherID, roomID int
+		var slot, roomNumber string
+		if err := rows.Scan(&sessionID, &slot, &groupID, &teacherID, &roomID, &roomNumber); err != nil {
+			return nil, err
+		}
+		sr, err := parseTimeSlot(slot)
+		if err != nil || !sr.Overlaps(r) {
+			continue
+		}
+		c := base
+		c.Type = "session"
+		c.ConflictingID = sessionID
+		c.ConflictingTimeSlot = sr.String()
+		switch {
+		case groupID == req.GroupID:
+			c.Resource = fmt.Sprintf("group %d", groupID)
+		case rooms[roomID]:
+			c.Resource = roomNumber
+		case invigilators[teacherID]:
+			c.Resource = fmt.Sprintf("teacher %d", teacherID)
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+func writeExamResources(ctx context.Context, tx pgx.Tx, id int, req *ExamRequest) error {
+	if _, err := tx.Exec(ctx, "DELETE FROM exam_rooms WHERE exam_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM exam_invigilators WHERE exam_id = $1", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO exam_rooms (exam_id, room_id) SELECT $1, unnest($2::int[])", id, req.RoomIDs); err != nil {
+		return err
+	}
+	if len(req.InvigilatorIDs) > 0 {
+		if _, err := tx.Exec(ctx, "INSERT INTO exam_invigilators (exam_id, teacher_id) SELECT $1, unnest($2::int[])", id, req.InvigilatorIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveExam validates and writes an exam in one transaction. It responds with
+// 409 and the conflict list when the exam clashes with anything.
+func saveExam(c echo.Context, id int) error {
+	var req ExamRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	// Exams compete with bookings and lessons for rooms.
+	if err := lockSchedule(ctx, tx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	var oldGroupID int
+	if id > 0 {
+		err := tx.QueryRow(ctx, "SELECT group_id FROM exams WHERE id = $1 FOR UPDATE", id).Scan(&oldGroupID)
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam not found"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if oldGroupID != req.GroupID {
+			// The seating plan belongs to the old group.
+			if _, err := tx.Exec(ctx, "DELETE FROM exam_seats WHERE exam_id = $1", id); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+		}
+	}
+
+	r, msg, err := validateExamRequest(ctx, tx, id, &req)
+	if err != nil {
+		fmt.Printf("validateExamRequest error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	conflicts, err := checkExamConflicts(ctx, tx, id, &req, r)
+	if err != nil {
+		fmt.Printf("checkExamConflicts error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":     "Exam clashes with other commitments",
+			"conflicts": conflicts,
+		})
+	}
+
+	status := http.StatusOK
+	if id == 0 {
+		err = tx.QueryRow(ctx, `
+            INSERT INTO exams (exam_period_id, subject_id, group_id, exam_type, exam_date, start_time, end_time, notes, created_by)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+            RETURNING id
+        `, req.ExamPeriodID, req.SubjectID, req.GroupID, req.ExamType, req.ExamDate, req.StartTime, req.EndTime, req.Notes,
+			c.Get("user_id").(int)).Scan(&id)
+		status = http.StatusCreated
+	} else {
+		_, err = tx.Exec(ctx, `
+            UPDATE exams
+            SET exam_period_id = $1, subject_id = $2, group_id = $3, exam_type = $4, exam_date = $5,
+                start_time = $6, end_time = $7, notes = $8, updated_at = CURRENT_TIMESTAMP
+            WHERE id = $9
+        `, req.ExamPeriodID, req.SubjectID, req.GroupID, req.ExamType, req.ExamDate, req.StartTime, req.EndTime, req.Notes, id)
+	}
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "This group already has an exam of this type for the subject in the exam period"})
+		}
+		fmt.Printf("Failed to save exam: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save exam"})
+	}
+
+	if err := writeExamResources(ctx, tx, id, &req); err != nil {
+		fmt.Printf("Failed to save exam rooms: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save exam"})
+	}
+	// Seats in rooms the exam no longer uses are void.
+	if _, err := tx.Exec(ctx, "DELETE FROM exam_seats WHERE exam_id = $1 AND room_id <> ALL($2)", id, req.RoomIDs); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save exam"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save exam"})
+	}
+
+	exam, err := getExamById(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Exam saved but failed to load it"})
+	}
+	return c.JSON(status, exam)
+}
+
+func CreateExamHandler(c echo.Context) error {
+	return saveExam(c, 0)
+}
+
+func UpdateExamHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+	return saveExam(c, id)
+}
+
+// DeleteExamHandler removes an exam that has no marks yet.
+func DeleteExamHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam ID"})
+	}
+
+	ctx := context.Background()
+	var marked bool
+	if err := pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM grades WHERE exam_id = $1)", id).Scan(&marked); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if marked {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Exam already has marks"})
+	}
+
+	tag, err := pool.Exec(ctx, "DELETE FROM exams WHERE id = $1", id)
+	if err != nil {
+		fmt.Printf("Failed to delete exam: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete exam"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Exam not found"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// StudentExamClash is a student sitting two exams whose times overlap.
+type StudentExamClash struct {
+	StudentID   int    `json:"student_id"`
+	StudentName string `json:"student_name"`
+	ExamID      int    `json:"exam_id"`
+	OtherExamID int    `json:"other_exam_id"`
+	ExamDate    string `json:"exam_date"`
+}
+
+// GetExamClashesHandler reports every student with two exams at once in an
+// exam period (?exam_period_id=) or semester (?semester=, default current).
+func GetExamClashesHandler(c echo.Context) error {
+	ctx := context.Background()
+	var filter string
+	var arg int
+	if v := c.QueryParam("exam_period_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid exam_period_id"})
+		}
+		filter, arg = "ep.id = $1", id
+	} else {
+		sem, err := resolveSemester(ctx, pool, c.QueryParam("semester"))
+		if err != nil {
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester"})
+			}
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		filter, arg = "ep.semester_id = $1", sem.ID
+	}
+
+	rows, err := pool.Query(ctx, examParticipantsCTE+`,
+        ex AS (
+            SELECT e.id, e.exam_date, e.start_time, e.end_time
+            FROM exams e JOIN exam_periods ep ON e.exam_period_id = ep.id
+            WHERE `+filter+`
+        )
+        SELECT p1.student_id, st.full_name, a.id, b.id, a.exam_date::text
+        FROM ex a
+        JOIN ex b ON a.id < b.id AND a.exam_date = b.exam_date AND a.start_time < b.end_time AND b.start_time < a.end_time
+        JOIN participants p1 ON p1.exam_id = a.id
+        JOIN participants p2 ON p2.exam_id = b.id AND p2.student_id = p1.student_id
+        JOIN students st ON st.id = p1.student_id
+        ORDER BY a.exam_date, st.full_name, a.id, b.id
+    `, arg)
+	if err != nil {
+		fmt.Printf("GetExamClashesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	clashes := []StudentExamClash{}
+	for rows.Next() {
+		var cl StudentExamClash
+		if err := rows.Scan(&cl.StudentID, &cl.StudentName, &cl.ExamID, &cl.OtherExamID, &cl.ExamDate); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		clashes = append(clashes, cl)
+	}
+	return c.JSON(http.StatusOK, clashes)
+}
@@ -0,0 +1,553 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type AbsenceExcuse struct {
+	ID            int        `json:"id"`
+	StudentID     int        `json:"student_id"`
+	StudentName   string     `json:"student_name"`
+	GroupID       *int       `json:"group_id"`
+	StartDate     string     `json:"start_date"`
+	EndDate       string     `json:"end_date"`
+	Reason        string     `json:"reason"`
+	Status        string     `json:"status"`
+	DocumentName  *string    `json:"document_name"`
+	DocumentType  *string    `json:"document_type"`
+	SubmittedBy   *int       `json:"submitted_by"`
+	ReviewedBy    *int       `json:"reviewed_by"`
+	ReviewComment *string    `json:"review_comment"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ExcuseReviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+type FacultyDeanRequest struct {
+	TeacherID *int `json:"teacher_id"`
+}
+
+const maxExcuseDocumentSize = 5 << 20
+
+var excuseDocumentTypes = map[string]bool{"application/pdf": true, "image/jpeg": true, "image/png": true}
+
+const excuseSelectQuery = `
+    SELECT e.id, e.student_id, s.full_name, s.group_id, e.start_date::text, e.end_date::text, e.reason, e.status,
+        e.document_name, e.document_type, e.submitted_by, e.reviewed_by, e.review_comment, e.reviewed_at, e.created_at
+    FROM absence_excuses e
+    JOIN students s ON e.student_id = s.id
+`
+
+func scanExcuse(row pgx.Row) (*AbsenceExcuse, error) {
+	e := &AbsenceExcuse{}
+	err := row.Scan(&e.ID, &e.StudentID, &e.StudentName, &e.GroupID, &e.StartDate, &e.EndDate, &e.Reason, &e.Status,
+		&e.DocumentName, &e.DocumentType, &e.SubmittedBy, &e.ReviewedBy, &e.ReviewComment, &e.ReviewedAt, &e.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func getExcuseById(ctx context.Context, id int) (*AbsenceExcuse, error) {
+	return scanExcuse(pool.QueryRow(ctx, excuseSelectQuery+` WHERE e.id = $1`, id))
+}
+
+// approvedExcuseFor returns the approved excuse covering a student's day, so
+// that absences recorded after approval are stored as excused right away.
+func approvedExcuseFor(ctx context.Context, q queryRower, studentID int, visitDay string) (*int, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+        SELECT id FROM absence_excuses
+        WHERE student_id = $1 AND status = 'approved' AND $2::date BETWEEN start_date AND end_date
+        ORDER BY reviewed_at DESC LIMIT 1
+    `, studentID, visitDay).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// applyApprovedExcuse stores an absence covered by an approved excuse as
+// excused, and drops the excuse link once a row is no longer excused.
+func applyApprovedExcuse(ctx context.Context, q queryRower, a *Attendance) error {
+	if a.Status != "absent" {
+		if a.Status != "excused" {
+			a.ExcuseID = nil
+		}
+		return nil
+	}
+	id, err := approvedExcuseFor(ctx, q, a.StudentId, a.VisitDay)
+	if err != nil || id == nil {
+		a.ExcuseID = nil
+		return err
+	}
+	a.Status = "excused"
+	a.Visited = false
+	a.ExcuseID = id
+	return nil
+}
+
+// excuseDeanCondition matches excuses (e, joined to their student s) of
+// students in a faculty whose dean is teacher $n.
+const excuseDeanCondition = `EXISTS (
+    SELECT 1 FROM student_groups sg JOIN faculties f ON sg.faculty_id = f.id
+    WHERE sg.id = s.group_id AND f.dean_teacher_id = $%[1]d
+)`
+
+// excuseTeacherCondition matches excuses teacher $n may see: those of the
+// faculty they are dean of, and those of groups they teach during the
+// excused days.
+const excuseTeacherCondition = `(` + excuseDeanCondition + ` OR EXISTS (
+    SELECT 1 FROM lesson_sessions ls
+    WHERE ls.group_id = s.group_id AND ls.teacher_id = $%[1]d AND ls.session_date BETWEEN e.start_date AND e.end_date
+) OR EXISTS (
+    SELECT 1 FROM schedule sc
+    WHERE sc.group_id = s.group_id AND sc.teacher_id = $%[1]d
+        AND sc.day_of_week IN (
+            SELECT to_char(d, 'FMDay') FROM generate_series(e.start_date, e.end_date, interval '1 day') d
+        )
+))`
+
+// teacherMatchesExcuse reports whether the caller is a teacher for whom
+// condition holds on excuse e.
+func teacherMatchesExcuse(ctx context.Context, c echo.Context, e *AbsenceExcuse, condition string) (bool, error) {
+	if c.Get("user_role").(string) != "teacher" {
+		return false, nil
+	}
+	teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+	if err != nil || teacherID == nil {
+		return false, err
+	}
+	var matches bool
+	err = pool.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM absence_excuses e JOIN students s ON e.student_id = s.id
+            WHERE e.id = $2 AND `+fmt.Sprintf(condition, 1)+`
+        )
+    `, *teacherID, e.ID).Scan(&matches)
+	return matches, err
+}
+
+// canReviewExcuse reports whether the caller may approve or reject an
+// excuse. Approval excuses absences in every subject, so only admins and the
+// dean of the student's faculty may review.
+func canReviewExcuse(ctx context.Context, c echo.Context, e *AbsenceExcuse) (bool, error) {
+	if c.Get("user_role").(string) == "admin" {
+		return true, nil
+	}
+	return teacherMatchesExcuse(ctx, c, e, excuseDeanCondition)
+}
+
+// canViewExcuse lets students and their guardians see the student's excuses,
+// admins all, and teachers those of their faculty as dean or of groups they
+// teach during the excused days.
+func canViewExcuse(ctx context.Context, c echo.Context, e *AbsenceExcuse) (bool, error) {
+	switch c.Get("user_role").(string) {
+	case "student", "guardian":
+		return canViewStudent(c, e.StudentID)
+	case "admin":
+		return true, nil
+	}
+	return teacherMatchesExcuse(ctx, c, e, excuseTeacherCondition)
+}
+
+// CreateExcuseHandler takes a multipart form with start_date, end_date,
+// reason and an optional document (PDF, JPEG or PNG up to 5 MB). Students
+// submit for themselves; admins pass student_id.
+func CreateExcuseHandler(c echo.Context) error {
+	ctx := context.Background()
+
+	var studentID int
+	if c.Get("user_role").(string) == "student" {
+		linked, err := getLinkedStudentID(c.Get("user_id").(int))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if linked == nil {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Account is not linked to a student"})
+		}
+		studentID = *linked
+	} else {
+		id, err := strconv.Atoi(c.FormValue("student_id"))
+		if err != nil || id <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "student_id is required"})
+		}
+		studentID = id
+	}
+
+	startDate, endDate := c.FormValue("start_date"), c.FormValue("end_date")
+	if endDate == "" {
+		endDate = startDate
+	}
+	from, err1 := parseDate(startDate)
+	to, err2 := parseDate(endDate)
+	if err1 != nil || err2 != nil || to.Before(from) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "start_date and end_date must be YYYY-MM-DD and not end before start"})
+	}
+	if to.Sub(from) > maxSessionRangeDays*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "An excuse may span at most a year"})
+	}
+	reason := strings.TrimSpace(c.FormValue("reason"))
+	if reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	var docName, docType *string
+	var doc []byte
+	if header, err := c.FormFile("document"); err == nil {
+		if header.Size > maxExcuseDocumentSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "document must not exceed 5 MB"})
+		}
+		f, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read document"})
+		}
+		doc, err = io.ReadAll(io.LimitReader(f, maxExcuseDocumentSize+1))
+		f.Close()
+		if err != nil || len(doc) > maxExcuseDocumentSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Failed to read document"})
+		}
+		detected := http.DetectContentType(doc)
+		if !excuseDocumentTypes[detected] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "document must be a PDF, JPEG or PNG file"})
+		}
+		name := header.Filename
+		docName, docType = &name, &detected
+	} else if err != http.ErrMissingFile {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid multipart form"})
+	}
+
+	var id int
+	err := pool.QueryRow(ctx, `
+        INSERT INTO absence_excuses (student_id, start_date, end_date, reason, document_name, document_type, document, submitted_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        RETURNING id
+    `, studentID, startDate, endDate, reason, docName, docType, doc, c.Get("user_id").(int)).Scan(&id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student_id"})
+		}
+		fmt.Printf("Failed to create excuse: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to submit excuse"})
+	}
+
+	excuse, err := getExcuseById(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Excuse submitted but failed to load it"})
+	}
+	return c.JSON(http.StatusCreated, excuse)
+}
+
+// GetExcusesHandler lists excuses: students see their own, guardians their
+// children's, teachers those of their faculty as dean or of groups they
+// teach in the excused days, admins all. Filter with ?status= and
+// ?student_id=.
+func GetExcusesHandler(c echo.Context) error {
+	ctx := context.Background()
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if v := c.QueryParam("status"); v != "" {
+		where("e.status = $%d", v)
+	}
+	if v := c.QueryParam("student_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student_id"})
+		}
+		where("e.student_id = $%d", id)
+	}
+	scoped, restricted, err := scopedStudentIDs(c)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if restricted {
+		where("e.student_id = ANY($%d)", scoped)
+	}
+	if c.Get("user_role").(string) == "teacher" {
+		teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if teacherID == nil {
+			return c.JSON(http.StatusOK, []AbsenceExcuse{})
+		}
+		where(excuseTeacherCondition, *teacherID)
+	}
+
+	query := excuseSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY e.created_at DESC, e.id DESC"
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		fmt.Printf("GetExcusesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	excuses := []AbsenceExcuse{}
+	for rows.Next() {
+		e, err := scanExcuse(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		excuses = append(excuses, *e)
+	}
+	return c.JSON(http.StatusOK, excuses)
+}
+
+// loadVisibleExcuse loads the excuse in :id and checks the caller may see it.
+// It returns a status and message to respond with when not.
+func loadVisibleExcuse(ctx context.Context, c echo.Context) (*AbsenceExcuse, int, string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, http.StatusBadRequest, "Invalid excuse ID"
+	}
+	excuse, err := getExcuseById(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, http.StatusNotFound, "Excuse not found"
+		}
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	allowed, err := canViewExcuse(ctx, c, excuse)
+	if err != nil {
+		return nil, http.StatusInternalServerError, "Database error"
+	}
+	if !allowed {
+		return nil, http.StatusForbidden, "Access denied"
+	}
+	return excuse, 0, ""
+}
+
+func GetExcuseHandler(c echo.Context) error {
+	excuse, status, msg := loadVisibleExcuse(context.Background(), c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	return c.JSON(http.StatusOK, excuse)
+}
+
+func GetExcuseDocumentHandler(c echo.Context) error {
+	ctx := context.Background()
+	excuse, status, msg := loadVisibleExcuse(ctx, c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	if excuse.DocumentName == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Excuse has no document"})
+	}
+
+	var doc []byte
+	if err := pool.QueryRow(ctx, "SELECT document FROM absence_excuses WHERE id = $1", excuse.ID).Scan(&doc); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", *excuse.DocumentName))
+	return c.Blob(http.StatusOK, *excuse.DocumentType, doc)
+}
+
+// DeleteExcuseHandler withdraws an excuse that has not been reviewed yet.
+func DeleteExcuseHandler(c echo.Context) error {
+	ctx := context.Background()
+	excuse, status, msg := loadVisibleExcuse(ctx, c)
+	if msg != "" {
+		return c.JSON(status, map[string]string{"error": msg})
+	}
+	if c.Get("user_role").(string) == "teacher" {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the student or an admin can withdraw an excuse"})
+	}
+
+	tag, err := pool.Exec(ctx, "DELETE FROM absence_excuses WHERE id = $1 AND status = 'pending'", excuse.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to withdraw excuse"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Only pending excuses can be withdrawn"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func ApproveExcuseHandler(c echo.Context) error {
+	return reviewExcuse(c, "approved")
+}
+
+func RejectExcuseHandler(c echo.Context) error {
+	return reviewExcuse(c, "rejected")
+}
+
+// reviewExcuse records the decision on a pending excuse. Approval turns the
+// student's absences in the excused days into excused ones; absences
+// recorded later are excused when they are written.
+func reviewExcuse(c echo.Context, decision string) error {
+	var req ExcuseReviewRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if decision == "rejected" && req.Comment == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "comment is required when rejecting"})
+	}
+
+	ctx := context.Background()
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid excuse ID"})
+	}
+	excuse, err := getExcuseById(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Excuse not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	allowed, err := canReviewExcuse(ctx, c, excuse)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: only the dean of the student's faculty or an admin can review excuses"})
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	userID := c.Get("user_id").(int)
+	var comment *string
+	if req.Comment != "" {
+		comment = &req.Comment
+	}
+	tag, err := tx.Exec(ctx, `
+        UPDATE absence_excuses
+        SET status = $1, reviewed_by = $2, review_comment = $3, reviewed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $4 AND status = 'pending'
+    `, decision, userID, comment, id)
+	if err != nil {
+		fmt.Printf("Failed to review excuse: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Excuse has already been reviewed"})
+	}
+
+	converted := 0
+	if decision == "approved" {
+		rows, err := tx.Query(ctx, attendanceSelectQuery+`
+            WHERE a.student_id = $1 AND a.visit_day BETWEEN $2::date AND $3::date AND a.status = 'absent'
+            FOR UPDATE
+        `, excuse.StudentID, excuse.StartDate, excuse.EndDate)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+		}
+		var absences []*Attendance
+		for rows.Next() {
+			a, err := scanAttendance(rows)
+			if err != nil {
+				rows.Close()
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+			}
+			absences = append(absences, a)
+		}
+		rows.Close()
+
+		reason := fmt.Sprintf("Excuse %d approved", id)
+		for _, old := range absences {
+			updated := *old
+			updated.Status = "excused"
+			updated.Visited = false
+			updated.ExcuseID = &id
+			_, err := tx.Exec(ctx, `
+                UPDATE attendance SET status = 'excused', visited = false, excuse_id = $1, updated_at = CURRENT_TIMESTAMP
+                WHERE id = $2
+            `, id, old.ID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+			}
+			if err := recordAttendanceRevision(ctx, tx, old.ID, "update", old, updated, &reason, &userID); err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+			}
+		}
+		converted = len(absences)
+	}
+
+	if err := writeAuditLog(ctx, tx, c, "review_excuse", "absence_excuses", id, map[string]string{"status": "pending"},
+		map[string]interface{}{"status": decision, "comment": comment, "attendance_excused": converted}); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to review excuse"})
+	}
+
+	excuse, err = getExcuseById(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Excuse reviewed but failed to load it"})
+	}
+
+	if decision == "approved" {
+		notice := inAppNotice{
+			Event:      "excuse_approved",
+			StudentIDs: []int{excuse.StudentID},
+			Title:      "Absence excuse approved",
+			Body:       fmt.Sprintf("The excuse for %s to %s was approved; %d absences are now excused.", excuse.StartDate, excuse.EndDate, converted),
+			Data:       map[string]interface{}{"excuse_id": id, "student_id": excuse.StudentID, "attendance_excused": converted},
+		}
+		if excuse.SubmittedBy != nil {
+			notice.UserIDs = []int{*excuse.SubmittedBy}
+		}
+		notifyInApp(notice)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"excuse":             excuse,
+		"attendance_excused": converted,
+	})
+}
+
+// SetFacultyDeanHandler names the teacher who acts as dean of a faculty.
+// A null teacher_id clears it.
+func SetFacultyDeanHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid faculty ID"})
+	}
+	var req FacultyDeanRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "UPDATE faculties SET dean_teacher_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.TeacherID, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid teacher_id"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to set dean"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Faculty not found"})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"faculty_id": id, "dean_teacher_id": req.TeacherID})
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type Grade struct {
+	ID          int       `json:"id"`
+	StudentID   int       `json:"student_id"`
+	SubjectID   int       `json:"subject_id"`
+	SubjectName string    `json:"subject_name"`
+	SubjectCode string    `json:"subject_code"`
+	GradeType   string    `json:"grade_type"`
+	GradeValue  float64   `json:"grade_value"`
+	MaxGrade    float64   `json:"max_grade"`
+	Weight      *float64  `json:"weight"`
+	ExamDate    *string   `json:"exam_date"`
+	Remarks     *string   `json:"remarks"`
+	GradedBy    *int      `json:"graded_by"`
+	SemesterID  int       `json:"semester_id"`
+	Semester    string    `json:"semester"`
+	ExamID      *int      `json:"exam_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const gradeSelectQuery = `
+    SELECT g.id, g.student_id, g.subject_id, sub.subject_name, sub.subject_code, g.grade_type, g.grade_value::float8,
+        g.max_grade::float8, g.weight::float8, g.exam_date::text, g.remarks, g.graded_by, g.semester_id, sem.name, g.exam_id, g.created_at
+    FROM grades g
+    JOIN subjects sub ON g.subject_id = sub.id
+    JOIN semesters sem ON g.semester_id = sem.id
+`
+
+func scanGrade(row pgx.Row) (*Grade, error) {
+	g := &Grade{}
+	err := row.Scan(&g.ID, &g.StudentID, &g.SubjectID, &g.SubjectName, &g.SubjectCode, &g.GradeType, &g.GradeValue,
+		&g.MaxGrade, &g.Weight, &g.ExamDate, &g.Remarks, &g.GradedBy, &g.SemesterID, &g.Semester, &g.ExamID, &g.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// GetStudentGradesHandler lists a student's grades for the current semester,
+// or for ?semester=<name>. Pass semester=all for the whole record.
+func GetStudentGradesHandler(c echo.Context) error {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	allowed, err := canViewStudent(c, studentID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: unable to verify student"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own grades"})
+	}
+
+	ctx := context.Background()
+	query := gradeSelectQuery + ` WHERE g.student_id = $1`
+	args := []interface{}{studentID}
+	if name := c.QueryParam("semester"); name != "all" {
+		sem, err := resolveSemester(ctx, pool, name)
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		query += ` AND g.semester_id = $2`
+		args = append(args, sem.ID)
+	}
+	query += ` ORDER BY g.exam_date DESC NULLS LAST, g.id DESC`
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		fmt.Printf("GetStudentGradesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	grades := []Grade{}
+	for rows.Next() {
+		g, err := scanGrade(rows)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		grades = append(grades, *g)
+	}
+
+	return c.JSON(http.StatusOK, grades)
+}
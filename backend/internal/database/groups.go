@@ -0,0 +1,440 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+type GroupRequest struct {
+	GroupName    string `json:"group_name"`
+	FacultyID    int    `json:"faculty_id"`
+	CourseYear   int    `json:"course_year"`
+	AcademicYear string `json:"academic_year"`
+}
+
+type MoveStudentRequest struct {
+	GroupID int    `json:"group_id"`
+	Reason  string `json:"reason"`
+}
+
+type GroupHistoryEntry struct {
+	ID            int       `json:"id"`
+	StudentID     int       `json:"student_id"`
+	FromGroupID   *int      `json:"from_group_id"`
+	FromGroupName *string   `json:"from_group_name"`
+	ToGroupID     *int      `json:"to_group_id"`
+	ToGroupName   *string   `json:"to_group_name"`
+	Reason        string    `json:"reason"`
+	MovedBy       *int      `json:"moved_by"`
+	MovedAt       time.Time `json:"moved_at"`
+}
+
+var academicYearRegex = regexp.MustCompile(`^(\d{4})-(\d{4})$`)
+
+func validateAcademicYear(academicYear string) bool {
+	m := academicYearRegex.FindStringSubmatch(academicYear)
+	if m == nil {
+		return false
+	}
+	start, _ := strconv.Atoi(m[1])
+	end, _ := strconv.Atoi(m[2])
+	return end == start+1
+}
+
+func validateGroupRequest(req *GroupRequest) string {
+	req.GroupName = strings.TrimSpace(req.GroupName)
+	if req.GroupName == "" {
+		return "group_name is required"
+	}
+	if req.FacultyID <= 0 {
+		return "faculty_id is required"
+	}
+	if req.CourseYear == 0 {
+		req.CourseYear = 1
+	}
+	if req.CourseYear < 1 || req.CourseYear > 6 {
+		return "course_year must be between 1 and 6"
+	}
+	if req.AcademicYear != "" && !validateAcademicYear(req.AcademicYear) {
+		return "academic_year must look like 2025-2026"
+	}
+	return ""
+}
+
+// resolveGroupAcademicYear looks up the requested academic year, defaulting
+// to the one of the current semester.
+func resolveGroupAcademicYear(ctx context.Context, req *GroupRequest) (int, string, error) {
+	ay, err := resolveAcademicYear(ctx, pool, req.AcademicYear)
+	if err == pgx.ErrNoRows {
+		return 0, "Unknown academic_year. Add it to the academic calendar first", nil
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	req.AcademicYear = ay.Name
+	return ay.ID, "", nil
+}
+
+const groupSelectQuery = `
+    SELECT sg.id, sg.group_name, sg.faculty_id, COALESCE(f.faculty_name, ''), sg.course_year, sg.academic_year,
+        (SELECT COUNT(*) FROM students s WHERE s.group_id = sg.id AND s.deleted_at IS NULL)
+    FROM student_groups sg
+    LEFT JOIN faculties f ON sg.faculty_id = f.id
+`
+
+func scanGroup(row pgx.Row) (*Group, error) {
+	group := &Group{}
+	err := row.Scan(&group.ID, &group.GroupName, &group.FacultyID, &group.FacultyName, &group.CourseYear, &group.AcademicYear, &group.StudentCount)
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func getAllGroups(pool *pgxpool.Pool) ([]Group, error) {
+	rows, err := pool.Query(context.Background(), groupSelectQuery+` ORDER BY sg.group_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+	}
+
+	return groups, rows.Err()
+}
+
+func getGroupById(pool *pgxpool.Pool, id int) (*Group, error) {
+	return scanGroup(pool.QueryRow(context.Background(), groupSelectQuery+` WHERE sg.id = $1`, id))
+}
+
+func GetGroupHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+
+	group, err := getGroupById(pool, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+		}
+		fmt.Printf("GetGroupHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, group)
+}
+
+func CreateGroupHandler(c echo.Context) error {
+	var req GroupRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateGroupRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	academicYearID, msg, err := resolveGroupAcademicYear(context.Background(), &req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	var id int
+	query := `INSERT INTO student_groups (group_name, faculty_id, course_year, academic_year, academic_year_id) VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	err = pool.QueryRow(context.Background(), query, req.GroupName, req.FacultyID, req.CourseYear, req.AcademicYear, academicYearID).Scan(&id)
+	if err != nil {
+		return groupWriteError(c, err)
+	}
+
+	group, err := getGroupById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Group created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, group)
+}
+
+func UpdateGroupHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+
+	var req GroupRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateGroupRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	academicYearID, msg, err := resolveGroupAcademicYear(context.Background(), &req)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	query := `
+        UPDATE student_groups
+        SET group_name = $1, faculty_id = $2, course_year = $3, academic_year = $4, academic_year_id = $5, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $6
+    `
+	tag, err := pool.Exec(context.Background(), query, req.GroupName, req.FacultyID, req.CourseYear, req.AcademicYear, academicYearID, id)
+	if err != nil {
+		return groupWriteError(c, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	}
+
+	group, err := getGroupById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Group updated but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, group)
+}
+
+func groupWriteError(c echo.Context, err error) error {
+	if isUniqueViolation(err) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A group with this name already exists"})
+	}
+	if isForeignKeyViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid faculty_id"})
+	}
+	fmt.Printf("Failed to save group: %v\n", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save group"})
+}
+
+// DeleteGroupHandler refuses to delete a group that still has students, since
+// students.group_id is ON DELETE RESTRICT. Move the students out first.
+// Soft-deleted students do not count; they are detached from the group.
+func DeleteGroupHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var studentCount int
+	err = tx.QueryRow(ctx, "SELECT COUNT(*) FROM students WHERE group_id = $1 AND deleted_at IS NULL", id).Scan(&studentCount)
+	if err != nil {
+		fmt.Printf("DeleteGroupHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if studentCount > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":         "Group still has students. Move them to another group first",
+			"student_count": studentCount,
+		})
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO student_group_history (student_id, from_group_id, to_group_id, reason, moved_by)
+        SELECT s.id, s.group_id, NULL, 'Group ' || sg.group_name || ' was deleted', $2
+        FROM students s JOIN student_groups sg ON s.group_id = sg.id
+        WHERE s.group_id = $1 AND s.deleted_at IS NOT NULL
+    `, id, c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("Failed to record group history: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+	}
+	if _, err := tx.Exec(ctx, "UPDATE students SET group_id = NULL WHERE group_id = $1 AND deleted_at IS NOT NULL", id); err != nil {
+		fmt.Printf("Failed to detach deleted students: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM student_groups WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Group is still referenced by students"})
+		}
+		fmt.Printf("Failed to delete group: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete group"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func GetGroupStudentsHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+
+	if _, err := getGroupById(pool, id); err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	students, err := getStudentsByGroupId(pool, id)
+	if err != nil {
+		fmt.Printf("GetGroupStudentsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, students)
+}
+
+func getStudentsByGroupId(pool *pgxpool.Pool, groupId int) ([]Student, error) {
+	query := studentSelectQuery + `
+        WHERE s.group_id = $1 AND s.deleted_at IS NULL
+        ORDER BY s.full_name
+    `
+	rows, err := pool.Query(context.Background(), query, groupId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	students := []Student{}
+	for rows.Next() {
+		student, err := scanStudent(rows)
+		if err != nil {
+			return nil, err
+		}
+		students = append(students, *student)
+	}
+
+	return students, rows.Err()
+}
+
+// MoveStudentHandler transfers a student to another group and records the
+// move in student_group_history in the same transaction.
+func MoveStudentHandler(c echo.Context) error {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	var req MoveStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.GroupID <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "group_id is required"})
+	}
+
+	userID := c.Get("user_id").(int)
+	ctx := context.Background()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var currentGroupID *int
+	err = tx.QueryRow(ctx, "SELECT group_id FROM students WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", studentID).Scan(&currentGroupID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if currentGroupID != nil && *currentGroupID == req.GroupID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Student is already in this group"})
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE students SET group_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.GroupID, studentID)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_id. Please select a valid group"})
+		}
+		fmt.Printf("Failed to move student: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to move student"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO student_group_history (student_id, from_group_id, to_group_id, reason, moved_by)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+    `, studentID, currentGroupID, req.GroupID, req.Reason, userID)
+	if err != nil {
+		fmt.Printf("Failed to record group history: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to move student"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to move student"})
+	}
+
+	student, err := getStudentById(pool, studentID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Student moved but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, student)
+}
+
+func GetStudentGroupHistoryHandler(c echo.Context) error {
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	query := `
+        SELECT h.id, h.student_id, h.from_group_id, fg.group_name, h.to_group_id, tg.group_name,
+            COALESCE(h.reason, ''), h.moved_by, h.moved_at
+        FROM student_group_history h
+        LEFT JOIN student_groups fg ON h.from_group_id = fg.id
+        LEFT JOIN student_groups tg ON h.to_group_id = tg.id
+        WHERE h.student_id = $1
+        ORDER BY h.moved_at DESC
+    `
+	rows, err := pool.Query(context.Background(), query, studentID)
+	if err != nil {
+		fmt.Printf("GetStudentGroupHistoryHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	history := []GroupHistoryEntry{}
+	for rows.Next() {
+		var entry GroupHistoryEntry
+		err := rows.Scan(&entry.ID, &entry.StudentID, &entry.FromGroupID, &entry.FromGroupName, &entry.ToGroupID, &entry.ToGroupName,
+			&entry.Reason, &entry.MovedBy, &entry.MovedAt)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		history = append(history, entry)
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,204 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// GuardianStudent is a student linked to a guardian account.
+type GuardianStudent struct {
+	StudentID       int       `json:"student_id"`
+	FullName        string    `json:"full_name"`
+	StudentIDNumber string    `json:"student_id_number"`
+	GroupID         *int      `json:"group_id"`
+	GroupName       *string   `json:"group_name"`
+	Relationship    *string   `json:"relationship"`
+	LinkedAt        time.Time `json:"linked_at"`
+}
+
+type LinkGuardianStudentRequest struct {
+	StudentID    int    `json:"student_id"`
+	Relationship string `json:"relationship"`
+}
+
+func getGuardianStudents(ctx context.Context, guardianID int) ([]GuardianStudent, error) {
+	rows, err := pool.Query(ctx, `
+        SELECT s.id, s.full_name, COALESCE(s.student_id_number, ''), s.group_id, sg.group_name, gs.relationship, gs.created_at
+        FROM guardian_students gs
+        JOIN students s ON gs.student_id = s.id
+        LEFT JOIN student_groups sg ON s.group_id = sg.id
+        WHERE gs.guardian_user_id = $1 AND s.deleted_at IS NULL
+        ORDER BY s.full_name, s.id
+    `, guardianID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	children := []GuardianStudent{}
+	for rows.Next() {
+		var g GuardianStudent
+		if err := rows.Scan(&g.StudentID, &g.FullName, &g.StudentIDNumber, &g.GroupID, &g.GroupName, &g.Relationship, &g.LinkedAt); err != nil {
+			return nil, err
+		}
+		children = append(children, g)
+	}
+	return children, rows.Err()
+}
+
+// GetMyChildrenHandler lists the students the calling guardian may follow.
+func GetMyChildrenHandler(c echo.Context) error {
+	children, err := getGuardianStudents(context.Background(), c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("GetMyChildrenHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, children)
+}
+
+func GetUserChildrenHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := context.Background()
+	if _, err := getUserById(id); err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	children, err := getGuardianStudents(ctx, id)
+	if err != nil {
+		fmt.Printf("GetUserChildrenHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, children)
+}
+
+// LinkGuardianStudentHandler gives a guardian account read access to a
+// student. A student may have several guardians and a guardian several
+// students; linking again only updates the relationship.
+func LinkGuardianStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	var req LinkGuardianStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Relationship = strings.TrimSpace(req.Relationship)
+	if req.StudentID <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "student_id is required"})
+	}
+	if len(req.Relationship) > 50 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "relationship must be at most 50 characters"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var role string
+	err = tx.QueryRow(ctx, "SELECT COALESCE(role, 'student') FROM users WHERE id = $1 FOR UPDATE", id).Scan(&role)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if role != "guardian" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is not a guardian"})
+	}
+
+	var exists bool
+	err = tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM students WHERE id = $1 AND deleted_at IS NULL)", req.StudentID).Scan(&exists)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !exists {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO guardian_students (guardian_user_id, student_id, relationship, created_by)
+        VALUES ($1, $2, NULLIF($3, ''), $4)
+        ON CONFLICT (guardian_user_id, student_id) DO UPDATE SET relationship = EXCLUDED.relationship
+    `, id, req.StudentID, req.Relationship, c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("Failed to link guardian: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	err = writeAuditLog(ctx, tx, c, "link_guardian_student", "users", id, nil,
+		map[string]interface{}{"student_id": req.StudentID, "relationship": req.Relationship})
+	if err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	children, err := getGuardianStudents(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, children)
+}
+
+func UnlinkGuardianStudentHandler(c echo.Context) error {
+	id, err1 := strconv.Atoi(c.Param("id"))
+	studentID, err2 := strconv.Atoi(c.Param("studentId"))
+	if err1 != nil || err2 != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user or student ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var relationship *string
+	err = tx.QueryRow(ctx, `
+        DELETE FROM guardian_students WHERE guardian_user_id = $1 AND student_id = $2
+        RETURNING relationship
+    `, id, studentID).Scan(&relationship)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Student is not linked to this guardian"})
+		}
+		fmt.Printf("Failed to unlink guardian: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	err = writeAuditLog(ctx, tx, c, "unlink_guardian_student", "users", id,
+		map[string]interface{}{"student_id": studentID, "relationship": relationship}, nil)
+	if err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
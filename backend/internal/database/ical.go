@@ -0,0 +1,106 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// icsWriter builds an RFC 5545 document: CRLF line endings, content lines
+// folded at 75 octets.
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	content := name + ":" + value
+	// The first line holds 75 octets; continuation lines start with a space,
+	// which counts towards their 75, leaving 74 for content.
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		// Never split a UTF-8 sequence.
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.b.WriteString(content[:cut])
+		w.b.WriteString("\r\n ")
+		content = content[cut:]
+		limit = 74
+	}
+	w.b.WriteString(content)
+	w.b.WriteString("\r\n")
+}
+
+func (w *icsWriter) String() string {
+	return w.b.String()
+}
+
+func escapeICSText(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+func icsLocalTime(t time.Time) string {
+	return t.Format("20060102T150405")
+}
+
+func icsUTCTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds/60%60)
+}
+
+// writeVTimezone describes loc between from and to as one STANDARD or
+// DAYLIGHT component per offset change, which is exact for any zone without
+// needing recurrence rules.
+func writeVTimezone(w *icsWriter, loc *time.Location, from, to time.Time) {
+	w.line("BEGIN", "VTIMEZONE")
+	w.line("TZID", loc.String())
+
+	_, offset := from.In(loc).Zone()
+	writeZoneComponent(w, from.In(loc), offset, offset, false)
+
+	for day := from; day.Before(to); day = day.Add(24 * time.Hour) {
+		_, next := day.Add(24 * time.Hour).In(loc).Zone()
+		if next == offset {
+			continue
+		}
+		// Narrow the change down to the minute.
+		lo, hi := day, day.Add(24*time.Hour)
+		for hi.Sub(lo) > time.Minute {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, o := mid.In(loc).Zone(); o == offset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		dst := hi.In(loc).IsDST()
+		// DTSTART of a zone component is the local time before the change.
+		onset := hi.Add(time.Duration(offset) * time.Second).UTC()
+		writeZoneComponent(w, onset, offset, next, dst)
+		offset = next
+	}
+
+	w.line("END", "VTIMEZONE")
+}
+
+func writeZoneComponent(w *icsWriter, onset time.Time, from, to int, dst bool) {
+	kind := "STANDARD"
+	if dst {
+		kind = "DAYLIGHT"
+	}
+	w.line("BEGIN", kind)
+	w.line("DTSTART", icsLocalTime(onset))
+	w.line("TZOFFSETFROM", icsOffset(from))
+	w.line("TZOFFSETTO", icsOffset(to))
+	w.line("END", kind)
+}
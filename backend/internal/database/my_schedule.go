@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// MyScheduleEntry is a lesson session with flags for the current user's view.
+type MyScheduleEntry struct {
+	LessonSession
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	IsToday   bool      `json:"is_today"`
+	IsOngoing bool      `json:"is_ongoing"`
+	IsNext    bool      `json:"is_next"`
+}
+
+type MyScheduleDay struct {
+	Date      string            `json:"date"`
+	DayOfWeek string            `json:"day_of_week"`
+	IsToday   bool              `json:"is_today"`
+	Lessons   []MyScheduleEntry `json:"lessons"`
+}
+
+type MySchedule struct {
+	Role      string          `json:"role"`
+	GroupID   *int            `json:"group_id,omitempty"`
+	TeacherID *int            `json:"teacher_id,omitempty"`
+	View      string          `json:"view"`
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	Today     string          `json:"today"`
+	Days      []MyScheduleDay `json:"days"`
+	// Next is the next class that has not started yet, even when it falls
+	// outside the requested range.
+	Next *MyScheduleEntry `json:"next"`
+}
+
+// nextClassHorizonDays bounds the search for the next upcoming class.
+const nextClassHorizonDays = 60
+
+// timetableOwner resolves whose timetable the caller follows: their group's
+// for students, their child's group for guardians (?student_id= picks the
+// child when there are several), their own lessons for teachers. A
+// non-empty msg means the account has no personal timetable.
+func timetableOwner(c echo.Context) (SessionFilter, string, error) {
+	var filter SessionFilter
+	userID := c.Get("user_id").(int)
+	switch c.Get("user_role").(string) {
+	case "student":
+		studentID, err := getLinkedStudentID(userID)
+		if err != nil {
+			return filter, "", err
+		}
+		if studentID == nil {
+			return filter, "Account is not linked to a student", nil
+		}
+		return studentTimetable(*studentID)
+	case "guardian":
+		children, err := getGuardianStudentIDs(userID)
+		if err != nil {
+			return filter, "", err
+		}
+		if len(children) == 0 {
+			return filter, "Account is not linked to a student", nil
+		}
+		if param := c.QueryParam("student_id"); param != "" {
+			studentID, err := strconv.Atoi(param)
+			if err != nil {
+				return filter, "Invalid student_id", nil
+			}
+			for _, child := range children {
+				if child == studentID {
+					return studentTimetable(studentID)
+				}
+			}
+			return filter, "Student is not linked to this account", nil
+		}
+		if len(children) > 1 {
+			return filter, "Pass student_id to choose a child", nil
+		}
+		return studentTimetable(children[0])
+	case "teacher":
+		teacherID, err := getLinkedTeacherID(userID)
+		if err != nil {
+			return filter, "", err
+		}
+		if teacherID == nil {
+			return filter, "Account is not linked to a teacher", nil
+		}
+		filter.TeacherID = *teacherID
+		return filter, "", nil
+	}
+	return filter, "This account has no personal timetable", nil
+}
+
+// studentTimetable filters sessions down to the group of a student.
+func studentTimetable(studentID int) (SessionFilter, string, error) {
+	var filter SessionFilter
+	var groupID *int
+	err := pool.QueryRow(context.Background(), "SELECT group_id FROM students WHERE id = $1 AND deleted_at IS NULL", studentID).Scan(&groupID)
+	if err != nil && err != pgx.ErrNoRows {
+		return filter, "", err
+	}
+	if groupID == nil {
+		return filter, "Student is not assigned to a group", nil
+	}
+	filter.GroupID = *groupID
+	return filter, "", nil
+}
+
+func newMyScheduleEntry(s LessonSession, today string, now time.Time, loc *time.Location) MyScheduleEntry {
+	entry := MyScheduleEntry{LessonSession: s, IsToday: s.SessionDate == today}
+	if start, end, err := atSlot(s.SessionDate, s.TimeSlot, loc); err == nil {
+		entry.StartsAt, entry.EndsAt = start, end
+		entry.IsOngoing = s.Status == "scheduled" && !now.Before(start) && now.Before(end)
+	}
+	return entry
+}
+
+// GetMyScheduleHandler returns the caller's lessons on concrete dates for a
+// week (default, Monday to Sunday) or a single day around ?date=. Sessions
+// already reflect cancellations, moves and substitutions.
+func GetMyScheduleHandler(c echo.Context) error {
+	ctx := context.Background()
+	filter, msg, err := timetableOwner(c)
+	if err != nil {
+		fmt.Printf("GetMyScheduleHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if msg != "" {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": msg})
+	}
+
+	loc := calendarLocation()
+	now := time.Now().In(loc)
+	today := now.Format("2006-01-02")
+
+	view := c.QueryParam("view")
+	if view == "" {
+		view = "week"
+	}
+	if view != "week" && view != "day" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "view must be week or day"})
+	}
+
+	date, _ := parseDate(today)
+	if v := c.QueryParam("date"); v != "" {
+		if date, err = parseDate(v); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD"})
+		}
+	}
+
+	from, to := date, date
+	if view == "week" {
+		offset := (int(date.Weekday()) + 6) % 7
+		from = date.AddDate(0, 0, -offset)
+		to = from.AddDate(0, 0, 6)
+	}
+	filter.From = from.Format("2006-01-02")
+	filter.To = to.Format("2006-01-02")
+
+	sessions, err := getLessonSessions(ctx, filter)
+	if err != nil {
+		fmt.Printf("GetMyScheduleHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	upcoming, err := getLessonSessions(ctx, SessionFilter{
+		GroupID:   filter.GroupID,
+		TeacherID: filter.TeacherID,
+		From:      today,
+		To:        now.AddDate(0, 0, nextClassHorizonDays).Format("2006-01-02"),
+		Status:    "scheduled",
+	})
+	if err != nil {
+		fmt.Printf("GetMyScheduleHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	result := MySchedule{
+		Role:  c.Get("user_role").(string),
+		View:  view,
+		From:  filter.From,
+		To:    filter.To,
+		Today: today,
+		Days:  []MyScheduleDay{},
+	}
+	if filter.GroupID > 0 {
+		result.GroupID = &filter.GroupID
+	}
+	if filter.TeacherID > 0 {
+		result.TeacherID = &filter.TeacherID
+	}
+
+	// Sessions are ordered by date and time slot strings, which is not
+	// chronological for slots like "9:00-10:30", so compare start times.
+	for _, s := range upcoming {
+		entry := newMyScheduleEntry(s, today, now, loc)
+		if entry.StartsAt.IsZero() || !entry.StartsAt.After(now) {
+			continue
+		}
+		if result.Next == nil || entry.StartsAt.Before(result.Next.StartsAt) {
+			e := entry
+			result.Next = &e
+		}
+	}
+	if result.Next != nil {
+		result.Next.IsNext = true
+	}
+
+	byDate := map[string][]MyScheduleEntry{}
+	for _, s := range sessions {
+		entry := newMyScheduleEntry(s, today, now, loc)
+		entry.IsNext = result.Next != nil && s.ID == result.Next.ID
+		byDate[s.SessionDate] = append(byDate[s.SessionDate], entry)
+	}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		lessons := byDate[key]
+		if lessons == nil {
+			lessons = []MyScheduleEntry{}
+		}
+		sort.SliceStable(lessons, func(i, j int) bool { return lessons[i].StartsAt.Before(lessons[j].StartsAt) })
+		result.Days = append(result.Days, MyScheduleDay{
+			Date:      key,
+			DayOfWeek: d.Weekday().String(),
+			IsToday:   key == today,
+			Lessons:   lessons,
+		})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
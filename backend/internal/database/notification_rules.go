@@ -0,0 +1,449 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type NotificationRule struct {
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Event           string    `json:"event"`
+	Threshold       *float64  `json:"threshold"`
+	Channels        []string  `json:"channels"`
+	Recipients      []string  `json:"recipients"`
+	WebhookURL      *string   `json:"webhook_url"`
+	SubjectTemplate string    `json:"subject_template"`
+	BodyTemplate    string    `json:"body_template"`
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+type NotificationRuleRequest struct {
+	Name            string   `json:"name"`
+	Event           string   `json:"event"`
+	Threshold       *float64 `json:"threshold"`
+	Channels        []string `json:"channels"`
+	Recipients      []string `json:"recipients"`
+	WebhookURL      *string  `json:"webhook_url"`
+	SubjectTemplate string   `json:"subject_template"`
+	BodyTemplate    string   `json:"body_template"`
+	IsActive        *bool    `json:"is_active"`
+}
+
+type NotificationPreference struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Enabled bool   `json:"enabled"`
+}
+
+type NotificationDelivery struct {
+	ID           int       `json:"id"`
+	RuleID       *int      `json:"rule_id"`
+	Event        string    `json:"event"`
+	Channel      string    `json:"channel"`
+	UserID       *int      `json:"user_id"`
+	Recipient    *string   `json:"recipient"`
+	StudentID    *int      `json:"student_id"`
+	AttendanceID *int      `json:"attendance_id"`
+	Subject      *string   `json:"subject"`
+	Body         *string   `json:"body"`
+	Status       string    `json:"status"`
+	Error        *string   `json:"error"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+var notificationEvents = []string{"absence", "consecutive_absences", "below_threshold"}
+
+var notificationRecipientKinds = map[string]bool{"student": true, "guardian": true, "teacher": true, "admin": true}
+
+const notificationRuleSelectQuery = `
+    SELECT id, name, event, threshold::float8, channels, recipients, webhook_url, subject_template, body_template,
+        is_active, created_at, updated_at
+    FROM notification_rules
+`
+
+func scanNotificationRule(row pgx.Row) (*NotificationRule, error) {
+	r := &NotificationRule{}
+	err := row.Scan(&r.ID, &r.Name, &r.Event, &r.Threshold, &r.Channels, &r.Recipients, &r.WebhookURL,
+		&r.SubjectTemplate, &r.BodyTemplate, &r.IsActive, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func getNotificationRules(ctx context.Context, activeOnly bool) ([]NotificationRule, error) {
+	query := notificationRuleSelectQuery
+	if activeOnly {
+		query += " WHERE is_active"
+	}
+	rows, err := pool.Query(ctx, query+" ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []NotificationRule{}
+	for rows.Next() {
+		r, err := scanNotificationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *r)
+	}
+	return rules, rows.Err()
+}
+
+func isNotificationEvent(event string) bool {
+	for _, e := range notificationEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func isInAppEvent(event string) bool {
+	for _, e := range inAppEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// validateNotificationRule checks a rule request and renders its templates
+// against sample data, so broken templates are caught when they are saved.
+func validateNotificationRule(req *NotificationRuleRequest) string {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "name is required"
+	}
+	if !isNotificationEvent(req.Event) {
+		return "event must be one of: " + strings.Join(notificationEvents, ", ")
+	}
+	switch req.Event {
+	case "consecutive_absences":
+		if req.Threshold == nil || *req.Threshold < 1 || *req.Threshold != float64(int(*req.Threshold)) {
+			return "threshold must be the number of absences in a row"
+		}
+	case "below_threshold":
+		if req.Threshold == nil || *req.Threshold <= 0 || *req.Threshold > 100 {
+			return "threshold must be an attendance rate in percent"
+		}
+	default:
+		req.Threshold = nil
+	}
+
+	if len(req.Channels) == 0 {
+		return "at least one channel is required"
+	}
+	for _, ch := range req.Channels {
+		if _, ok := notificationChannels[ch]; !ok {
+			return "channels must be email, in_app or webhook"
+		}
+		if ch == "webhook" {
+			if req.WebhookURL == nil {
+				return "webhook_url is required for the webhook channel"
+			}
+			u, err := url.Parse(*req.WebhookURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return "webhook_url must be an http or https URL"
+			}
+		}
+	}
+	if len(req.Recipients) == 0 {
+		req.Recipients = []string{"student"}
+	}
+	for _, r := range req.Recipients {
+		if !notificationRecipientKinds[r] {
+			return "recipients must be student, guardian, teacher or admin"
+		}
+	}
+
+	sample := notificationData{StudentName: "Student", SubjectName: "Subject", VisitDay: "2026-01-01", Status: "absent", Streak: 3, Rate: 50, Threshold: 70}
+	for _, t := range []string{req.SubjectTemplate, req.BodyTemplate} {
+		if strings.TrimSpace(t) == "" {
+			return "subject_template and body_template are required"
+		}
+		if _, err := renderNotificationTemplate(t, sample); err != nil {
+			return "Invalid template: " + err.Error()
+		}
+	}
+	return ""
+}
+
+func GetNotificationRulesHandler(c echo.Context) error {
+	rules, err := getNotificationRules(context.Background(), false)
+	if err != nil {
+		fmt.Printf("GetNotificationRulesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+func CreateNotificationRuleHandler(c echo.Context) error {
+	return saveNotificationRule(c, 0)
+}
+
+func UpdateNotificationRuleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule ID"})
+	}
+	return saveNotificationRule(c, id)
+}
+
+// saveNotificationRule creates a rule when id is 0 and replaces it otherwise.
+func saveNotificationRule(c echo.Context, id int) error {
+	var req NotificationRuleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if msg := validateNotificationRule(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	active := true
+	if req.IsActive != nil {
+		active = *req.IsActive
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var old *NotificationRule
+	status := http.StatusCreated
+	if id == 0 {
+		err = tx.QueryRow(ctx, `
+            INSERT INTO notification_rules (name, event, threshold, channels, recipients, webhook_url, subject_template, body_template, is_active)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+            RETURNING id
+        `, req.Name, req.Event, req.Threshold, req.Channels, req.Recipients, req.WebhookURL,
+			req.SubjectTemplate, req.BodyTemplate, active).Scan(&id)
+	} else {
+		status = http.StatusOK
+		old, err = scanNotificationRule(tx.QueryRow(ctx, notificationRuleSelectQuery+" WHERE id = $1 FOR UPDATE", id))
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification rule not found"})
+		}
+		if err == nil {
+			_, err = tx.Exec(ctx, `
+                UPDATE notification_rules
+                SET name = $1, event = $2, threshold = $3, channels = $4, recipients = $5, webhook_url = $6,
+                    subject_template = $7, body_template = $8, is_active = $9, updated_at = CURRENT_TIMESTAMP
+                WHERE id = $10
+            `, req.Name, req.Event, req.Threshold, req.Channels, req.Recipients, req.WebhookURL,
+				req.SubjectTemplate, req.BodyTemplate, active, id)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Failed to save notification rule: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save notification rule"})
+	}
+
+	rule, err := scanNotificationRule(tx.QueryRow(ctx, notificationRuleSelectQuery+" WHERE id = $1", id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save notification rule"})
+	}
+	action, oldValues := "create_notification_rule", interface{}(nil)
+	if old != nil {
+		action, oldValues = "update_notification_rule", old
+	}
+	if err := writeAuditLog(ctx, tx, c, action, "notification_rules", id, oldValues, rule); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save notification rule"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save notification rule"})
+	}
+	return c.JSON(status, rule)
+}
+
+func DeleteNotificationRuleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := scanNotificationRule(tx.QueryRow(ctx, notificationRuleSelectQuery+" WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification rule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if _, err := tx.Exec(ctx, "DELETE FROM notification_rules WHERE id = $1", id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete notification rule"})
+	}
+	if err := writeAuditLog(ctx, tx, c, "delete_notification_rule", "notification_rules", id, old, nil); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete notification rule"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete notification rule"})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetMyNotificationPreferencesHandler lists every event and per-user channel
+// with whether the caller receives it.
+func GetMyNotificationPreferencesHandler(c echo.Context) error {
+	rows, err := pool.Query(context.Background(), `
+        SELECT event, channel, enabled FROM notification_preferences WHERE user_id = $1
+    `, c.Get("user_id").(int))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	stored := map[string]bool{}
+	for rows.Next() {
+		var event, channel string
+		var enabled bool
+		if err := rows.Scan(&event, &channel, &enabled); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		stored[event+"/"+channel] = enabled
+	}
+
+	prefs := []NotificationPreference{}
+	for _, event := range notificationEvents {
+		for _, channel := range []string{"email", "in_app"} {
+			enabled, ok := stored[event+"/"+channel]
+			prefs = append(prefs, NotificationPreference{Event: event, Channel: channel, Enabled: enabled || !ok})
+		}
+	}
+	for _, event := range inAppEvents {
+		enabled, ok := stored[event+"/in_app"]
+		prefs = append(prefs, NotificationPreference{Event: event, Channel: "in_app", Enabled: enabled || !ok})
+	}
+	return c.JSON(http.StatusOK, prefs)
+}
+
+// UpdateMyNotificationPreferencesHandler stores the given preferences;
+// combinations left out keep their current setting.
+func UpdateMyNotificationPreferencesHandler(c echo.Context) error {
+	var req []NotificationPreference
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	for _, p := range req {
+		if isInAppEvent(p.Event) {
+			if p.Channel != "in_app" {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": p.Event + " is only delivered in_app"})
+			}
+			continue
+		}
+		if !isNotificationEvent(p.Event) {
+			events := append(append([]string{}, notificationEvents...), inAppEvents...)
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "event must be one of: " + strings.Join(events, ", ")})
+		}
+		if channel, ok := notificationChannels[p.Channel]; !ok || !channel.perUser() {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "channel must be email or in_app"})
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	userID := c.Get("user_id").(int)
+	for _, p := range req {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO notification_preferences (user_id, event, channel, enabled) VALUES ($1, $2, $3, $4)
+            ON CONFLICT (user_id, event, channel) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+        `, userID, p.Event, p.Channel, p.Enabled)
+		if err != nil {
+			fmt.Printf("Failed to save notification preference: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save preferences"})
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save preferences"})
+	}
+	return GetMyNotificationPreferencesHandler(c)
+}
+
+// GetNotificationDeliveriesHandler shows the delivery log, newest first,
+// filtered by ?rule_id=, ?user_id=, ?student_id=, ?channel= and ?status=.
+func GetNotificationDeliveriesHandler(c echo.Context) error {
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	for _, param := range []string{"rule_id", "user_id", "student_id"} {
+		if v := c.QueryParam(param); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid " + param})
+			}
+			where(param+" = $%d", id)
+		}
+	}
+	for _, param := range []string{"channel", "status"} {
+		if v := c.QueryParam(param); v != "" {
+			where(param+" = $%d", v)
+		}
+	}
+	limit := 100
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 1000 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 1000"})
+		}
+		limit = n
+	}
+
+	query := `
+        SELECT id, rule_id, event, channel, user_id, recipient, student_id, attendance_id, subject, body, status, error, created_at
+        FROM notification_deliveries
+    `
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT %d", limit)
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("GetNotificationDeliveriesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	deliveries := []NotificationDelivery{}
+	for rows.Next() {
+		var d NotificationDelivery
+		err := rows.Scan(&d.ID, &d.RuleID, &d.Event, &d.Channel, &d.UserID, &d.Recipient, &d.StudentID, &d.AttendanceID,
+			&d.Subject, &d.Body, &d.Status, &d.Error, &d.CreatedAt)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		deliveries = append(deliveries, d)
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
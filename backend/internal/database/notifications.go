@@ -0,0 +1,306 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// Notification is a message in a user's in-app notification center.
+type Notification struct {
+	ID        int             `json:"id"`
+	Event     string          `json:"event"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body"`
+	Data      json.RawMessage `json:"data"`
+	ReadAt    *time.Time      `json:"read_at"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NotificationPage is one page of the caller's notifications, newest first.
+// NextBefore is passed back as ?before= to fetch the next page.
+type NotificationPage struct {
+	Items       []Notification `json:"items"`
+	UnreadCount int            `json:"unread_count"`
+	NextBefore  *int           `json:"next_before"`
+}
+
+// inAppEvents are raised directly by the code that makes the change rather
+// than through notification rules, and are only delivered in the app.
+// Absences reach the notification center through the rules' in_app channel.
+var inAppEvents = []string{"grade", "schedule_change", "excuse_approved"}
+
+// inAppNotice is one notification for the accounts of some students (the
+// students themselves and their guardians), those of a whole group when
+// GroupID is set, and some other users.
+type inAppNotice struct {
+	Event      string
+	StudentIDs []int
+	GroupID    int
+	UserIDs    []int
+	Title      string
+	Body       string
+	Data       map[string]interface{}
+}
+
+const notificationSelectQuery = `
+    SELECT id, event, title, body, COALESCE(data, 'null'::jsonb), read_at, created_at
+    FROM notifications
+`
+
+func scanNotification(row pgx.Row) (*Notification, error) {
+	n := &Notification{}
+	if err := row.Scan(&n.ID, &n.Event, &n.Title, &n.Body, &n.Data, &n.ReadAt, &n.CreatedAt); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// notifyInApp delivers the notices in the background after the change they
+// report has been committed, skipping users who opted out of the event.
+func notifyInApp(notices ...inAppNotice) {
+	if len(notices) == 0 {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		for i := range notices {
+			if err := deliverInApp(ctx, &notices[i]); err != nil {
+				fmt.Printf("Failed to deliver %s notification: %v\n", notices[i].Event, err)
+			}
+		}
+	}()
+}
+
+func deliverInApp(ctx context.Context, n *inAppNotice) error {
+	studentIDs := n.StudentIDs
+	if n.GroupID != 0 {
+		rows, err := pool.Query(ctx, "SELECT id FROM students WHERE group_id = $1 AND deleted_at IS NULL", n.GroupID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			studentIDs = append(studentIDs, id)
+		}
+		rows.Close()
+	}
+	recipients, err := studentAccountIDs(ctx, studentIDs)
+	if err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	for _, id := range recipients {
+		seen[id] = true
+	}
+	for _, id := range n.UserIDs {
+		if !seen[id] {
+			seen[id] = true
+			recipients = append(recipients, id)
+		}
+	}
+
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return err
+	}
+	var studentID int
+	if len(studentIDs) == 1 {
+		studentID = studentIDs[0]
+	}
+	for _, userID := range recipients {
+		userID := userID
+		m := notificationMessage{Event: n.Event, UserID: &userID, Subject: n.Title, Body: n.Body, Data: notificationData{StudentID: studentID}}
+		enabled, err := notificationEnabled(ctx, userID, n.Event, "in_app")
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			logNotificationDelivery(ctx, "in_app", &m, nil, true)
+			continue
+		}
+		_, err = pool.Exec(ctx, `
+            INSERT INTO notifications (user_id, event, title, body, data) VALUES ($1, $2, $3, $4, $5)
+        `, userID, n.Event, n.Title, n.Body, data)
+		logNotificationDelivery(ctx, "in_app", &m, err, false)
+	}
+	return nil
+}
+
+// studentAccountIDs returns the active user accounts that follow the given
+// students: their own and their guardians'.
+func studentAccountIDs(ctx context.Context, studentIDs []int) ([]int, error) {
+	if len(studentIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := pool.Query(ctx, `
+        SELECT id FROM users WHERE student_id = ANY($1) AND is_active
+        UNION
+        SELECT u.id FROM guardian_students gs JOIN users u ON gs.guardian_user_id = u.id
+        WHERE gs.student_id = ANY($1) AND u.is_active
+        ORDER BY 1
+    `, studentIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// teacherAccountIDs returns the active user accounts of the given teachers,
+// matched by email like getLinkedTeacherID.
+func teacherAccountIDs(ctx context.Context, teacherIDs []int) ([]int, error) {
+	rows, err := pool.Query(ctx, `
+        SELECT DISTINCT u.id FROM users u JOIN teachers t ON lower(t.email) = lower(u.email)
+        WHERE t.id = ANY($1) AND u.is_active
+        ORDER BY u.id
+    `, teacherIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func unreadNotificationCount(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := pool.QueryRow(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL", userID).Scan(&count)
+	return count, err
+}
+
+// GetMyNotificationsHandler lists the caller's notifications, newest first.
+// ?unread=true leaves out those already read; ?limit= (default 50, at most
+// 200) and ?before= page through older ones.
+func GetMyNotificationsHandler(c echo.Context) error {
+	userID := c.Get("user_id").(int)
+	query := notificationSelectQuery + ` WHERE user_id = $1`
+	args := []interface{}{userID}
+
+	if v := c.QueryParam("unread"); v != "" {
+		unread, err := strconv.ParseBool(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "unread must be true or false"})
+		}
+		if unread {
+			query += ` AND read_at IS NULL`
+		}
+	}
+	if v := c.QueryParam("before"); v != "" {
+		before, err := strconv.Atoi(v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before"})
+		}
+		args = append(args, before)
+		query += fmt.Sprintf(` AND id < $%d`, len(args))
+	}
+	limit := 50
+	if v := c.QueryParam("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must be between 1 and 200"})
+		}
+		limit = n
+	}
+	// One extra row tells whether there is another page.
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT %d`, limit+1)
+
+	ctx := context.Background()
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		fmt.Printf("GetMyNotificationsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	page := NotificationPage{Items: []Notification{}}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		page.Items = append(page.Items, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		next := page.Items[limit-1].ID
+		page.NextBefore = &next
+	}
+
+	if page.UnreadCount, err = unreadNotificationCount(ctx, userID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func GetUnreadNotificationCountHandler(c echo.Context) error {
+	count, err := unreadNotificationCount(context.Background(), c.Get("user_id").(int))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, map[string]int{"unread_count": count})
+}
+
+// MarkNotificationReadHandler marks one of the caller's notifications as
+// read. Marking it again keeps the time it was first read.
+func MarkNotificationReadHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid notification ID"})
+	}
+
+	n, err := scanNotification(pool.QueryRow(context.Background(), `
+        UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+        WHERE id = $1 AND user_id = $2
+        RETURNING id, event, title, body, COALESCE(data, 'null'::jsonb), read_at, created_at
+    `, id, c.Get("user_id").(int)))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Notification not found"})
+		}
+		fmt.Printf("Failed to mark notification read: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update notification"})
+	}
+	return c.JSON(http.StatusOK, n)
+}
+
+func MarkAllNotificationsReadHandler(c echo.Context) error {
+	tag, err := pool.Exec(context.Background(), `
+        UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL
+    `, c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("Failed to mark notifications read: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update notifications"})
+	}
+	return c.JSON(http.StatusOK, map[string]int64{"marked": tag.RowsAffected(), "unread_count": 0})
+}
@@ -0,0 +1,472 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// notificationData is what rule templates can refer to, e.g.
+// {{.StudentName}} or {{.Rate}}.
+type notificationData struct {
+	AttendanceID int     `json:"attendance_id"`
+	StudentID    int     `json:"student_id"`
+	StudentName  string  `json:"student_name"`
+	SubjectID    int     `json:"subject_id"`
+	SubjectName  string  `json:"subject_name"`
+	VisitDay     string  `json:"visit_day"`
+	Status       string  `json:"status"`
+	Streak       int     `json:"streak,omitempty"`
+	Rate         float64 `json:"rate,omitempty"`
+	Threshold    float64 `json:"threshold,omitempty"`
+}
+
+// notificationMessage is one rendered notification for one recipient. For
+// channels that do not deliver per user, UserID is nil and Recipient is the
+// channel's own target.
+type notificationMessage struct {
+	RuleID    int
+	Event     string
+	UserID    *int
+	Recipient string
+	Subject   string
+	Body      string
+	Data      notificationData
+}
+
+// notificationChannel delivers rendered notifications. Channels that are
+// not per user (webhooks) are called once per fired rule.
+type notificationChannel interface {
+	perUser() bool
+	deliver(ctx context.Context, rule *NotificationRule, m *notificationMessage) error
+}
+
+var notificationChannels = map[string]notificationChannel{
+	"email":   emailChannel{},
+	"in_app":  inAppChannel{},
+	"webhook": webhookChannel{},
+}
+
+type emailChannel struct{}
+
+func (emailChannel) perUser() bool { return true }
+
+// deliver sends a plain text email through SMTP_HOST:SMTP_PORT, logging in
+// with SMTP_USERNAME and SMTP_PASSWORD when set.
+func (emailChannel) deliver(ctx context.Context, rule *NotificationRule, m *notificationMessage) error {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return fmt.Errorf("email is not configured (SMTP_HOST is empty)")
+	}
+	if m.Recipient == "" {
+		return fmt.Errorf("user has no email address")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		from = "no-reply@" + host
+	}
+
+	var auth smtp.Auth
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	header := strings.NewReplacer("\r", " ", "\n", " ")
+	msg := "From: " + from + "\r\n" +
+		"To: " + m.Recipient + "\r\n" +
+		"Subject: " + header.Replace(m.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + m.Body + "\r\n"
+	return smtp.SendMail(host+":"+port, auth, from, []string{m.Recipient}, []byte(msg))
+}
+
+type inAppChannel struct{}
+
+func (inAppChannel) perUser() bool { return true }
+
+func (inAppChannel) deliver(ctx context.Context, rule *NotificationRule, m *notificationMessage) error {
+	data, err := json.Marshal(m.Data)
+	if err != nil {
+		return err
+	}
+	_, err = pool.Exec(ctx, `
+        INSERT INTO notifications (user_id, event, title, body, data) VALUES ($1, $2, $3, $4, $5)
+    `, *m.UserID, m.Event, m.Subject, m.Body, data)
+	return err
+}
+
+type webhookChannel struct{}
+
+func (webhookChannel) perUser() bool { return false }
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// deliver POSTs the notification as JSON to the rule's webhook URL.
+func (webhookChannel) deliver(ctx context.Context, rule *NotificationRule, m *notificationMessage) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"rule_id": rule.ID,
+		"event":   m.Event,
+		"subject": m.Subject,
+		"body":    m.Body,
+		"data":    m.Data,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.Recipient, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+func renderNotificationTemplate(text string, data notificationData) (string, error) {
+	t, err := template.New("notification").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// notifyAttendance evaluates the notification rules for attendance rows
+// whose status was just set. It runs in the background so that slow mail
+// servers or webhooks never hold up the request that marked attendance.
+func notifyAttendance(ids ...int) {
+	if len(ids) == 0 {
+		return
+	}
+	go func() {
+		ctx := context.Background()
+		for _, id := range ids {
+			if err := evaluateAttendanceRules(ctx, id); err != nil {
+				fmt.Printf("Failed to evaluate notification rules for attendance %d: %v\n", id, err)
+			}
+		}
+	}()
+}
+
+// notificationRecipient is a user a rule notifies.
+type notificationRecipient struct {
+	UserID int
+	Email  string
+}
+
+func evaluateAttendanceRules(ctx context.Context, attendanceID int) error {
+	var data notificationData
+	var teacherID *int
+	err := pool.QueryRow(ctx, `
+        SELECT a.id, a.student_id, s.full_name, a.subject_id, sub.subject_name, a.visit_day::text, a.status,
+            COALESCE(ls.teacher_id, (
+                SELECT sc.teacher_id FROM schedule sc WHERE sc.group_id = s.group_id AND sc.subject_id = a.subject_id
+                ORDER BY sc.id LIMIT 1
+            ))
+        FROM attendance a
+        JOIN students s ON a.student_id = s.id
+        JOIN subjects sub ON a.subject_id = sub.id
+        LEFT JOIN lesson_sessions ls ON a.session_id = ls.id
+        WHERE a.id = $1
+    `, attendanceID).Scan(&data.AttendanceID, &data.StudentID, &data.StudentName, &data.SubjectID, &data.SubjectName,
+		&data.VisitDay, &data.Status, &teacherID)
+	if err != nil {
+		return err
+	}
+
+	rules, err := getNotificationRules(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	streak := -1
+	for i := range rules {
+		rule := &rules[i]
+		ruleData := data
+		switch rule.Event {
+		case "absence":
+			if data.Status != "absent" {
+				continue
+			}
+		case "consecutive_absences":
+			if data.Status != "absent" {
+				continue
+			}
+			if streak < 0 {
+				if streak, err = absenceStreak(ctx, data); err != nil {
+					return err
+				}
+			}
+			// Only the absence that completes the streak notifies.
+			if streak != int(*rule.Threshold) {
+				continue
+			}
+			ruleData.Streak = streak
+		case "below_threshold":
+			rate, crossed, err := rateFellBelow(ctx, data, *rule.Threshold)
+			if err != nil {
+				return err
+			}
+			if !crossed {
+				continue
+			}
+			ruleData.Rate = rate
+			ruleData.Threshold = *rule.Threshold
+		default:
+			continue
+		}
+		if err := fireNotificationRule(ctx, rule, ruleData, teacherID); err != nil {
+			fmt.Printf("Failed to fire notification rule %d: %v\n", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+// absenceStreak counts the student's absences in a row in the subject,
+// ending with the given day.
+func absenceStreak(ctx context.Context, data notificationData) (int, error) {
+	rows, err := pool.Query(ctx, `
+        SELECT status FROM attendance
+        WHERE student_id = $1 AND subject_id = $2 AND visit_day <= $3::date
+        ORDER BY visit_day DESC
+        LIMIT 366
+    `, data.StudentID, data.SubjectID, data.VisitDay)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	streak := 0
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return 0, err
+		}
+		if status != "absent" {
+			break
+		}
+		streak++
+	}
+	return streak, rows.Err()
+}
+
+// rateFellBelow reports the student's attendance rate in the subject over the
+// semester of the lesson and whether this lesson took it below threshold.
+func rateFellBelow(ctx context.Context, data notificationData, threshold float64) (float64, bool, error) {
+	policy, err := loadAttendancePolicy(ctx, pool)
+	if err != nil {
+		return 0, false, err
+	}
+	rows, err := pool.Query(ctx, `
+        WITH sem AS (
+            SELECT start_date, end_date FROM semesters
+            WHERE $3::date BETWEEN start_date AND end_date
+            ORDER BY start_date LIMIT 1
+        )
+        SELECT a.id = $4, a.status, COUNT(*)
+        FROM attendance a
+        WHERE a.student_id = $1 AND a.subject_id = $2
+            AND (NOT EXISTS (SELECT 1 FROM sem)
+                OR a.visit_day BETWEEN (SELECT start_date FROM sem) AND (SELECT end_date FROM sem))
+        GROUP BY 1, 2
+    `, data.StudentID, data.SubjectID, data.VisitDay, data.AttendanceID)
+	if err != nil {
+		return 0, false, err
+	}
+	defer rows.Close()
+
+	before, after := newAttendanceStats(), newAttendanceStats()
+	for rows.Next() {
+		var current bool
+		var status string
+		var count int
+		if err := rows.Scan(&current, &status, &count); err != nil {
+			return 0, false, err
+		}
+		after.add(status, count, 0, policy)
+		if !current {
+			before.add(status, count, 0, policy)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, err
+	}
+	before.finish()
+	after.finish()
+
+	if after.AttendanceRate == nil || *after.AttendanceRate >= threshold {
+		return 0, false, nil
+	}
+	return *after.AttendanceRate, before.AttendanceRate == nil || *before.AttendanceRate >= threshold, nil
+}
+
+// notificationRecipients resolves the rule's recipient kinds to active users.
+func notificationRecipients(ctx context.Context, rule *NotificationRule, studentID int, teacherID *int) ([]notificationRecipient, error) {
+	var recipients []notificationRecipient
+	seen := map[int]bool{}
+	for _, kind := range rule.Recipients {
+		var query string
+		var args []interface{}
+		switch kind {
+		case "student":
+			query, args = "SELECT id, COALESCE(email, '') FROM users WHERE student_id = $1 AND is_active", []interface{}{studentID}
+		case "guardian":
+			query, args = `
+                SELECT u.id, COALESCE(u.email, '') FROM guardian_students gs JOIN users u ON gs.guardian_user_id = u.id
+                WHERE gs.student_id = $1 AND u.is_active
+            `, []interface{}{studentID}
+		case "teacher":
+			if teacherID == nil {
+				continue
+			}
+			query, args = `
+                SELECT u.id, COALESCE(u.email, '') FROM users u JOIN teachers t ON lower(t.email) = lower(u.email)
+                WHERE t.id = $1 AND u.is_active
+            `, []interface{}{*teacherID}
+		case "admin":
+			query = "SELECT id, COALESCE(email, '') FROM users WHERE role = 'admin' AND is_active"
+		default:
+			continue
+		}
+
+		rows, err := pool.Query(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var r notificationRecipient
+			if err := rows.Scan(&r.UserID, &r.Email); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !seen[r.UserID] {
+				seen[r.UserID] = true
+				recipients = append(recipients, r)
+			}
+		}
+		rows.Close()
+	}
+	return recipients, nil
+}
+
+func notificationEnabled(ctx context.Context, userID int, event, channel string) (bool, error) {
+	enabled := true
+	err := pool.QueryRow(ctx, `
+        SELECT COALESCE((SELECT enabled FROM notification_preferences WHERE user_id = $1 AND event = $2 AND channel = $3), true)
+    `, userID, event, channel).Scan(&enabled)
+	return enabled, err
+}
+
+// fireNotificationRule renders the rule and hands it to each of its
+// channels, logging every delivery.
+func fireNotificationRule(ctx context.Context, rule *NotificationRule, data notificationData, teacherID *int) error {
+	base := notificationMessage{RuleID: rule.ID, Event: rule.Event, Data: data}
+	var renderErr error
+	if base.Subject, renderErr = renderNotificationTemplate(rule.SubjectTemplate, data); renderErr == nil {
+		base.Body, renderErr = renderNotificationTemplate(rule.BodyTemplate, data)
+	}
+
+	recipients, err := notificationRecipients(ctx, rule, data.StudentID, teacherID)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range rule.Channels {
+		channel, ok := notificationChannels[name]
+		if !ok {
+			continue
+		}
+		if !channel.perUser() {
+			m := base
+			if rule.WebhookURL != nil {
+				m.Recipient = *rule.WebhookURL
+			}
+			err := renderErr
+			if err == nil {
+				err = channel.deliver(ctx, rule, &m)
+			}
+			logNotificationDelivery(ctx, name, &m, err, false)
+			continue
+		}
+		for _, r := range recipients {
+			m := base
+			userID := r.UserID
+			m.UserID = &userID
+			if name == "email" {
+				m.Recipient = r.Email
+			}
+			enabled, err := notificationEnabled(ctx, r.UserID, rule.Event, name)
+			if err != nil {
+				return err
+			}
+			if !enabled {
+				logNotificationDelivery(ctx, name, &m, nil, true)
+				continue
+			}
+			err = renderErr
+			if err == nil {
+				err = channel.deliver(ctx, rule, &m)
+			}
+			logNotificationDelivery(ctx, name, &m, err, false)
+		}
+	}
+	return nil
+}
+
+func logNotificationDelivery(ctx context.Context, channel string, m *notificationMessage, deliveryErr error, skipped bool) {
+	status := "sent"
+	var errText *string
+	switch {
+	case skipped:
+		status = "skipped"
+		text := "disabled in the user's preferences"
+		errText = &text
+	case deliveryErr != nil:
+		status = "failed"
+		text := deliveryErr.Error()
+		errText = &text
+	}
+	var recipient *string
+	if m.Recipient != "" {
+		recipient = &m.Recipient
+	}
+	var ruleID *int
+	if m.RuleID != 0 {
+		ruleID = &m.RuleID
+	}
+	var studentID, attendanceID *int
+	if m.Data.StudentID != 0 {
+		studentID = &m.Data.StudentID
+	}
+	if m.Data.AttendanceID != 0 {
+		attendanceID = &m.Data.AttendanceID
+	}
+	_, err := pool.Exec(ctx, `
+        INSERT INTO notification_deliveries (rule_id, event, channel, user_id, recipient, student_id, attendance_id, subject, body, status, error)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+    `, ruleID, m.Event, channel, m.UserID, recipient, studentID, attendanceID, m.Subject, m.Body, status, errText)
+	if err != nil {
+		fmt.Printf("Failed to log notification delivery: %v\n", err)
+	}
+}
@@ -0,0 +1,94 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Landscape A4 in points, set in the built-in Courier font so columns of
+// text line up without embedding font metrics.
+const (
+	pdfPageWidth    = 842
+	pdfPageHeight   = 595
+	pdfMargin       = 36
+	pdfFontSize     = 7
+	pdfLeading      = 9
+	pdfTitleLeading = 14
+	// Courier glyphs are 0.6 em wide.
+	pdfLineWidth = (pdfPageWidth - 2*pdfMargin) * 10 / (6 * pdfFontSize)
+	pdfPageLines = (pdfPageHeight-2*pdfMargin)/pdfLeading - 2
+)
+
+// pdfText escapes s for a PDF string literal. The standard fonts only cover
+// Latin-1, so other characters are replaced with '?'.
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// writeTextPDF writes pages of preformatted lines, each page headed by title
+// and numbered. Lines longer than pdfLineWidth are clipped by the page edge.
+func writeTextPDF(w io.Writer, title string, pages [][]string) error {
+	if len(pages) == 0 {
+		pages = [][]string{{}}
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// Objects 1-4 are the catalog, page tree and fonts; each page then adds
+	// a page object and its content stream.
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range pages {
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F2 10 Tf\n%d %d Td\n(%s) Tj\n", pdfMargin, pdfPageHeight-pdfMargin, pdfText(title))
+		fmt.Fprintf(&content, "/F1 %d Tf\n%d TL\n0 -%d Td\n", pdfFontSize, pdfLeading, pdfTitleLeading)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfText(line))
+		}
+		content.WriteString("ET\n")
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d %d Td\n(Page %d of %d) Tj\nET\n", pdfFontSize, pdfPageWidth-pdfMargin-70, pdfMargin/2, i+1, len(pages))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
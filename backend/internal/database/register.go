@@ -0,0 +1,363 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// AttendanceRegister is the paper register of one group in one subject:
+// a row per student, a column per lesson date. Cells line up with Dates and
+// are null where nothing was recorded.
+type AttendanceRegister struct {
+	GroupID     int           `json:"group_id"`
+	GroupName   string        `json:"group_name"`
+	SubjectID   int           `json:"subject_id"`
+	SubjectName string        `json:"subject_name"`
+	From        string        `json:"from"`
+	To          string        `json:"to"`
+	Dates       []string      `json:"dates"`
+	Rows        []RegisterRow `json:"rows"`
+}
+
+type RegisterRow struct {
+	StudentID   int              `json:"student_id"`
+	StudentName string           `json:"student_name"`
+	Cells       []*Attendance    `json:"cells"`
+	Stats       *AttendanceStats `json:"stats"`
+}
+
+// registerMarks are the symbols written in exported registers.
+var registerMarks = map[string]string{
+	"present": "P",
+	"absent":  "A",
+	"late":    "L",
+	"excused": "E",
+	"remote":  "R",
+}
+
+const registerLegend = "P present, A absent, L late (minutes), E excused, R remote"
+
+func registerMark(a *Attendance) string {
+	if a == nil {
+		return ""
+	}
+	mark := registerMarks[a.Status]
+	if a.Status == "late" && a.MinutesLate != nil {
+		mark += strconv.Itoa(*a.MinutesLate)
+	}
+	return mark
+}
+
+func registerRate(row RegisterRow) string {
+	if row.Stats.AttendanceRate == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*row.Stats.AttendanceRate, 'f', -1, 64)
+}
+
+// loadAttendanceRegister builds the register. The dates are those of the
+// group's lessons of the subject in the range plus any date that already
+// has attendance, so marks recorded without a session still show.
+func loadAttendanceRegister(ctx context.Context, groupID, subjectID int, from, to string) (*AttendanceRegister, error) {
+	reg := &AttendanceRegister{GroupID: groupID, SubjectID: subjectID, From: from, To: to, Dates: []string{}, Rows: []RegisterRow{}}
+	var groupName, subjectName *string
+	err := pool.QueryRow(ctx, `
+        SELECT (SELECT group_name FROM student_groups WHERE id = $1), (SELECT subject_name FROM subjects WHERE id = $2)
+    `, groupID, subjectID).Scan(&groupName, &subjectName)
+	if err != nil {
+		return nil, err
+	}
+	if groupName == nil || subjectName == nil {
+		return nil, pgx.ErrNoRows
+	}
+	reg.GroupName, reg.SubjectName = *groupName, *subjectName
+
+	rows, err := pool.Query(ctx, `
+        SELECT session_date::text FROM lesson_sessions
+        WHERE group_id = $1 AND subject_id = $2 AND status = 'scheduled' AND session_date BETWEEN $3::date AND $4::date
+        UNION
+        SELECT a.visit_day::text FROM attendance a JOIN students s ON a.student_id = s.id
+        WHERE s.group_id = $1 AND a.subject_id = $2 AND a.visit_day BETWEEN $3::date AND $4::date
+        ORDER BY 1
+    `, groupID, subjectID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	column := map[string]int{}
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		column[date] = len(reg.Dates)
+		reg.Dates = append(reg.Dates, date)
+	}
+	rows.Close()
+
+	rows, err = pool.Query(ctx, `
+        SELECT id, full_name FROM students
+        WHERE group_id = $1 AND deleted_at IS NULL
+        ORDER BY full_name, id
+    `, groupID)
+	if err != nil {
+		return nil, err
+	}
+	index := map[int]int{}
+	for rows.Next() {
+		row := RegisterRow{Cells: make([]*Attendance, len(reg.Dates))}
+		if err := rows.Scan(&row.StudentID, &row.StudentName); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[row.StudentID] = len(reg.Rows)
+		reg.Rows = append(reg.Rows, row)
+	}
+	rows.Close()
+
+	policy, err := loadAttendancePolicy(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	for i := range reg.Rows {
+		reg.Rows[i].Stats = newAttendanceStats()
+	}
+
+	rows, err = pool.Query(ctx, attendanceSelectQuery+`
+        JOIN students s ON a.student_id = s.id
+        WHERE s.group_id = $1 AND s.deleted_at IS NULL AND a.subject_id = $2 AND a.visit_day BETWEEN $3::date AND $4::date
+    `, groupID, subjectID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		a, err := scanAttendance(rows)
+		if err != nil {
+			return nil, err
+		}
+		i, ok := index[a.StudentId]
+		if !ok {
+			continue
+		}
+		reg.Rows[i].Cells[column[a.VisitDay]] = a
+		minutesLate := 0
+		if a.MinutesLate != nil {
+			minutesLate = *a.MinutesLate
+		}
+		reg.Rows[i].Stats.add(a.Status, 1, minutesLate, policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range reg.Rows {
+		reg.Rows[i].Stats.finish()
+	}
+	return reg, nil
+}
+
+// table returns the register as a header row and a row per student, with
+// the student's attendance rate in the last column.
+func (reg *AttendanceRegister) table() [][]interface{} {
+	header := []interface{}{"Student"}
+	for _, d := range reg.Dates {
+		header = append(header, d)
+	}
+	header = append(header, "Rate %")
+
+	table := [][]interface{}{header}
+	for _, row := range reg.Rows {
+		line := []interface{}{row.StudentName}
+		for _, cell := range row.Cells {
+			line = append(line, registerMark(cell))
+		}
+		if row.Stats.AttendanceRate != nil {
+			line = append(line, *row.Stats.AttendanceRate)
+		} else {
+			line = append(line, nil)
+		}
+		table = append(table, line)
+	}
+	return table
+}
+
+func (reg *AttendanceRegister) title() string {
+	return fmt.Sprintf("Attendance register: %s, %s, %s to %s", reg.GroupName, reg.SubjectName, reg.From, reg.To)
+}
+
+// pdfPages lays the register out as text. Dates that do not fit across one
+// page continue on further pages, each repeating the student names.
+func (reg *AttendanceRegister) pdfPages() [][]string {
+	const nameWidth, cellWidth, rateWidth = 28, 6, 7
+	perPage := (pdfLineWidth - nameWidth - rateWidth) / cellWidth
+	rowsPerPage := pdfPageLines - 4
+
+	var pages [][]string
+	for start := 0; start == 0 || start < len(reg.Dates); start += perPage {
+		end := start + perPage
+		if end > len(reg.Dates) {
+			end = len(reg.Dates)
+		}
+		last := end == len(reg.Dates)
+
+		header := fmt.Sprintf("%-*s", nameWidth, "Student")
+		for _, d := range reg.Dates[start:end] {
+			header += fmt.Sprintf("%-*s", cellWidth, d[5:])
+		}
+		if last {
+			header += fmt.Sprintf("%*s", rateWidth, "Rate%")
+		}
+
+		var lines []string
+		for i, row := range reg.Rows {
+			if i%rowsPerPage == 0 {
+				if lines != nil {
+					pages = append(pages, lines)
+				}
+				lines = []string{header, strings.Repeat("-", len(header))}
+			}
+			name := []rune(row.StudentName)
+			if len(name) > nameWidth-1 {
+				name = name[:nameWidth-1]
+			}
+			line := fmt.Sprintf("%-*s", nameWidth, string(name))
+			for _, cell := range row.Cells[start:end] {
+				line += fmt.Sprintf("%-*s", cellWidth, registerMark(cell))
+			}
+			if last {
+				line += fmt.Sprintf("%*s", rateWidth, registerRate(row))
+			}
+			lines = append(lines, line)
+		}
+		if lines == nil {
+			lines = []string{header, strings.Repeat("-", len(header))}
+		}
+		lines = append(lines, "", registerLegend)
+		pages = append(pages, lines)
+	}
+	return pages
+}
+
+// csvText quotes text that a spreadsheet would otherwise run as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// GetAttendanceRegisterHandler returns the register of ?group_id= in
+// ?subject_id= between ?from= and ?to= (the current semester by default, or
+// ?semester=). ?format=csv, xlsx or pdf downloads it instead of JSON. The PDF
+// uses the built-in Latin-1 fonts, so names in other scripts print as '?';
+// use xlsx or csv for those.
+func GetAttendanceRegisterHandler(c echo.Context) error {
+	groupID, err1 := strconv.Atoi(c.QueryParam("group_id"))
+	subjectID, err2 := strconv.Atoi(c.QueryParam("subject_id"))
+	if err1 != nil || err2 != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "group_id and subject_id are required"})
+	}
+	format := strings.ToLower(c.QueryParam("format"))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "xlsx" && format != "pdf" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "format must be json, csv, xlsx or pdf"})
+	}
+
+	ctx := context.Background()
+	from, to := c.QueryParam("from"), c.QueryParam("to")
+	if from == "" || to == "" {
+		semester, msg, err := semesterParam(c)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+		if semester == nil {
+			semester, err = resolveSemester(ctx, pool, "")
+			if err == pgx.ErrNoRows {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "No current semester; pass from and to"})
+			}
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+		}
+		if from == "" {
+			from = semester.StartDate
+		}
+		if to == "" {
+			to = semester.EndDate
+		}
+	}
+	start, err1 := parseDate(from)
+	end, err2 := parseDate(to)
+	if err1 != nil || err2 != nil || end.Before(start) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from and to must be YYYY-MM-DD and not end before start"})
+	}
+	if end.Sub(start) > maxSessionRangeDays*24*time.Hour {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The register may span at most a year"})
+	}
+
+	reg, err := loadAttendanceRegister(ctx, groupID, subjectID, from, to)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Group or subject not found"})
+		}
+		fmt.Printf("GetAttendanceRegisterHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	filename := fmt.Sprintf("register-%d-%d-%s-%s.%s", groupID, subjectID, from, to, format)
+	var body bytes.Buffer
+	var contentType string
+	switch format {
+	case "json":
+		return c.JSON(http.StatusOK, reg)
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		w := csv.NewWriter(&body)
+		for _, line := range reg.table() {
+			record := make([]string, len(line))
+			for i, v := range line {
+				switch v := v.(type) {
+				case nil:
+				case string:
+					record[i] = csvText(v)
+				default:
+					record[i] = fmt.Sprint(v)
+				}
+			}
+			if err = w.Write(record); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			w.Flush()
+			err = w.Error()
+		}
+	case "xlsx":
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+		err = writeXLSX(&body, "Register", reg.table())
+	case "pdf":
+		contentType = "application/pdf"
+		err = writeTextPDF(&body, reg.title(), reg.pdfPages())
+	}
+	if err != nil {
+		fmt.Printf("Failed to export register: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to export register"})
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	return c.Blob(http.StatusOK, contentType, body.Bytes())
+}
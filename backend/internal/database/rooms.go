@@ -0,0 +1,792 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type Building struct {
+	ID           int    `json:"id"`
+	BuildingName string `json:"building_name"`
+	Address      string `json:"address"`
+	RoomCount    int    `json:"room_count"`
+}
+
+type BuildingRequest struct {
+	BuildingName string `json:"building_name"`
+	Address      string `json:"address"`
+}
+
+type Room struct {
+	ID                   int      `json:"id"`
+	BuildingID           int      `json:"building_id"`
+	BuildingName         string   `json:"building_name"`
+	RoomNumber           string   `json:"room_number"`
+	Capacity             int      `json:"capacity"`
+	Equipment            []string `json:"equipment"`
+	WheelchairAccessible bool     `json:"wheelchair_accessible"`
+	IsActive             bool     `json:"is_active"`
+}
+
+type RoomRequest struct {
+	BuildingID           int      `json:"building_id"`
+	RoomNumber           string   `json:"room_number"`
+	Capacity             int      `json:"capacity"`
+	Equipment            []string `json:"equipment"`
+	WheelchairAccessible bool     `json:"wheelchair_accessible"`
+	IsActive             *bool    `json:"is_active"`
+}
+
+type RoomBooking struct {
+	ID          int       `json:"id"`
+	RoomID      int       `json:"room_id"`
+	RoomNumber  string    `json:"room_number"`
+	BookingDate string    `json:"booking_date"`
+	Semester    string    `json:"semester"`
+	StartTime   string    `json:"start_time"`
+	EndTime     string    `json:"end_time"`
+	Purpose     string    `json:"purpose"`
+	BookedBy    *int      `json:"booked_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type RoomBookingRequest struct {
+	BookingDate string `json:"booking_date"`
+	StartTime   string `json:"start_time"`
+	EndTime     string `json:"end_time"`
+	Purpose     string `json:"purpose"`
+}
+
+type RoomTimetable struct {
+	Room     Room          `json:"room"`
+	Schedule []Schedule    `json:"schedule"`
+	Bookings []RoomBooking `json:"bookings"`
+}
+
+// semesterForDate maps a date outside the academic calendar to the
+// conventional semester label: January-May is Spring, June-August Summer,
+// the rest Fall.
+func semesterForDate(date time.Time) string {
+	switch {
+	case date.Month() <= time.May:
+		return fmt.Sprintf("Spring %d", date.Year())
+	case date.Month() <= time.August:
+		return fmt.Sprintf("Summer %d", date.Year())
+	default:
+		return fmt.Sprintf("Fall %d", date.Year())
+	}
+}
+
+func bookingRange(b RoomBooking) (TimeRange, error) {
+	return parseTimeSlot(b.StartTime + "-" + b.EndTime)
+}
+
+// findBookingConflicts reports ad-hoc bookings that fall on a date when the
+// weekly slot takes place, i.e. same weekday within the slot's semester.
+func findBookingConflicts(slot scheduleSlot, bookings []RoomBooking) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	for _, b := range bookings {
+		date, err := time.Parse("2006-01-02", b.BookingDate)
+		if err != nil {
+			continue
+		}
+		r, err := bookingRange(b)
+		if err != nil {
+			continue
+		}
+		if date.Weekday().String() != slot.DayOfWeek || b.Semester != slot.Semester || !r.Overlaps(slot.Range) {
+			continue
+		}
+		conflicts = append(conflicts, ScheduleConflict{
+			Type:                "booking",
+			ScheduleID:          slot.ID,
+			ConflictingID:       b.ID,
+			Semester:            slot.Semester,
+			DayOfWeek:           slot.DayOfWeek,
+			TimeSlot:            slot.TimeSlot,
+			ConflictingTimeSlot: r.String(),
+			Resource:            fmt.Sprintf("%s on %s", b.RoomNumber, b.BookingDate),
+		})
+	}
+	return conflicts
+}
+
+const roomBookingSelectQuery = `
+    SELECT b.id, b.room_id, r.room_number, b.booking_date::text,
+        COALESCE((SELECT sem.name FROM semesters sem WHERE b.booking_date BETWEEN sem.start_date AND sem.end_date ORDER BY sem.start_date LIMIT 1), ''),
+        to_char(b.start_time, 'HH24:MI'), to_char(b.end_time, 'HH24:MI'), b.purpose, b.booked_by, b.created_at
+    FROM room_bookings b
+    JOIN rooms r ON b.room_id = r.id
+`
+
+func scanRoomBookings(rows pgx.Rows) ([]RoomBooking, error) {
+	defer rows.Close()
+	bookings := []RoomBooking{}
+	for rows.Next() {
+		var b RoomBooking
+		err := rows.Scan(&b.ID, &b.RoomID, &b.RoomNumber, &b.BookingDate, &b.Semester, &b.StartTime, &b.EndTime, &b.Purpose, &b.BookedBy, &b.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if b.Semester == "" {
+			if date, err := time.Parse("2006-01-02", b.BookingDate); err == nil {
+				b.Semester = semesterForDate(date)
+			}
+		}
+		bookings = append(bookings, b)
+	}
+	return bookings, rows.Err()
+}
+
+func loadRoomBookings(ctx context.Context, tx pgx.Tx, roomID int) ([]RoomBooking, error) {
+	rows, err := tx.Query(ctx, roomBookingSelectQuery+` WHERE b.room_id = $1 AND b.booking_date >= CURRENT_DATE ORDER BY b.booking_date, b.start_time`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	return scanRoomBookings(rows)
+}
+
+func GetBuildingsHandler(c echo.Context) error {
+	query := `
+        SELECT b.id, b.building_name, COALESCE(b.address, ''), (SELECT COUNT(*) FROM rooms r WHERE r.building_id = b.id)
+        FROM buildings b
+        ORDER BY b.building_name
+    `
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		fmt.Printf("GetBuildingsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	buildings := []Building{}
+	for rows.Next() {
+		var b Building
+		if err := rows.Scan(&b.ID, &b.BuildingName, &b.Address, &b.RoomCount); err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		buildings = append(buildings, b)
+	}
+
+	return c.JSON(http.StatusOK, buildings)
+}
+
+func CreateBuildingHandler(c echo.Context) error {
+	var req BuildingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.BuildingName = strings.TrimSpace(req.BuildingName)
+	if req.BuildingName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "building_name is required"})
+	}
+
+	building := Building{BuildingName: req.BuildingName, Address: req.Address}
+	err := pool.QueryRow(context.Background(), "INSERT INTO buildings (building_name, address) VALUES ($1, NULLIF($2, '')) RETURNING id",
+		req.BuildingName, req.Address).Scan(&building.ID)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A building with this name already exists"})
+		}
+		fmt.Printf("Failed to create building: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create building"})
+	}
+
+	return c.JSON(http.StatusCreated, building)
+}
+
+func UpdateBuildingHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid building ID"})
+	}
+
+	var req BuildingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.BuildingName = strings.TrimSpace(req.BuildingName)
+	if req.BuildingName == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "building_name is required"})
+	}
+
+	tag, err := pool.Exec(context.Background(),
+		"UPDATE buildings SET building_name = $1, address = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP WHERE id = $3",
+		req.BuildingName, req.Address, id)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A building with this name already exists"})
+		}
+		fmt.Printf("Failed to update building: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update building"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Building not found"})
+	}
+
+	return c.JSON(http.StatusOK, Building{ID: id, BuildingName: req.BuildingName, Address: req.Address})
+}
+
+func DeleteBuildingHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid building ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM buildings WHERE id = $1", id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Building still has rooms"})
+		}
+		fmt.Printf("Failed to delete building: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete building"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Building not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+const roomSelectQuery = `
+    SELECT r.id, r.building_id, b.building_name, r.room_number, r.capacity, r.equipment, r.wheelchair_accessible, r.is_active
+    FROM rooms r
+    JOIN buildings b ON r.building_id = b.id
+`
+
+func scanRoom(row pgx.Row) (*Room, error) {
+	room := &Room{}
+	err := row.Scan(&room.ID, &room.BuildingID, &room.BuildingName, &room.RoomNumber, &room.Capacity, &room.Equipment,
+		&room.WheelchairAccessible, &room.IsActive)
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
+func getRoomById(ctx context.Context, id int) (*Room, error) {
+	return scanRoom(pool.QueryRow(ctx, roomSelectQuery+` WHERE r.id = $1`, id))
+}
+
+// queryRooms lists rooms matching the building_id, min_capacity, accessible,
+// equipment and include_inactive query parameters.
+func queryRooms(c echo.Context) ([]Room, string, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if v := c.QueryParam("building_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "Invalid building_id", nil
+		}
+		where("r.building_id = $%d", id)
+	}
+	if v := c.QueryParam("min_capacity"); v != "" {
+		capacity, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, "Invalid min_capacity", nil
+		}
+		where("r.capacity >= $%d", capacity)
+	}
+	if c.QueryParam("accessible") == "true" {
+		conditions = append(conditions, "r.wheelchair_accessible")
+	}
+	if v := c.QueryParam("equipment"); v != "" {
+		where("r.equipment @> $%d", strings.Split(v, ","))
+	}
+	if c.QueryParam("include_inactive") != "true" {
+		conditions = append(conditions, "r.is_active")
+	}
+
+	query := roomSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY b.building_name, r.room_number"
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	rooms := []Room{}
+	for rows.Next() {
+		room, err := scanRoom(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		rooms = append(rooms, *room)
+	}
+	return rooms, "", rows.Err()
+}
+
+func GetRoomsHandler(c echo.Context) error {
+	rooms, msg, err := queryRooms(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	if err != nil {
+		fmt.Printf("GetRoomsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, rooms)
+}
+
+func GetRoomHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	room, err := getRoomById(context.Background(), id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, room)
+}
+
+func validateRoomRequest(req *RoomRequest) string {
+	req.RoomNumber = strings.TrimSpace(req.RoomNumber)
+	if req.BuildingID <= 0 || req.RoomNumber == "" {
+		return "building_id and room_number are required"
+	}
+	if req.Capacity <= 0 {
+		return "capacity must be positive"
+	}
+	if req.Equipment == nil {
+		req.Equipment = []string{}
+	}
+	return ""
+}
+
+func roomWriteError(c echo.Context, err error) error {
+	if isUniqueViolation(err) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "This room number already exists in the building"})
+	}
+	if isForeignKeyViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid building_id"})
+	}
+	fmt.Printf("Failed to save room: %v\n", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save room"})
+}
+
+func CreateRoomHandler(c echo.Context) error {
+	var req RoomRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if msg := validateRoomRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	isActive := req.IsActive == nil || *req.IsActive
+
+	var id int
+	query := `
+        INSERT INTO rooms (building_id, room_number, capacity, equipment, wheelchair_accessible, is_active)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `
+	err := pool.QueryRow(context.Background(), query, req.BuildingID, req.RoomNumber, req.Capacity, req.Equipment,
+		req.WheelchairAccessible, isActive).Scan(&id)
+	if err != nil {
+		return roomWriteError(c, err)
+	}
+
+	room, err := getRoomById(context.Background(), id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Room created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, room)
+}
+
+// UpdateRoomHandler also renames the room on schedule rows that reference it,
+// since schedule.room_number is kept as a display label.
+func UpdateRoomHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	var req RoomRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if msg := validateRoomRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	isActive := req.IsActive == nil || *req.IsActive
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        UPDATE rooms
+        SET building_id = $1, room_number = $2, capacity = $3, equipment = $4, wheelchair_accessible = $5, is_active = $6,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $7
+    `
+	tag, err := tx.Exec(ctx, query, req.BuildingID, req.RoomNumber, req.Capacity, req.Equipment, req.WheelchairAccessible, isActive, id)
+	if err != nil {
+		return roomWriteError(c, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE schedule SET room_number = $1 WHERE room_id = $2", req.RoomNumber, id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save room"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save room"})
+	}
+
+	room, err := getRoomById(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Room updated but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, room)
+}
+
+func DeleteRoomHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	var scheduleCount int
+	if err := pool.QueryRow(context.Background(), "SELECT COUNT(*) FROM schedule WHERE room_id = $1", id).Scan(&scheduleCount); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if scheduleCount > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":          "Room is still used by the schedule. Deactivate it instead",
+			"schedule_count": scheduleCount,
+		})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM rooms WHERE id = $1", id)
+	if err != nil {
+		fmt.Printf("Failed to delete room: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete room"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func GetRoomTimetableHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	ctx := context.Background()
+	room, err := getRoomById(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	schedules, err := getSchedules(pool, ScheduleFilter{RoomID: id, Semester: c.QueryParam("semester")})
+	if err != nil {
+		fmt.Printf("GetRoomTimetableHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	rows, err := pool.Query(ctx, roomBookingSelectQuery+` WHERE b.room_id = $1 AND b.booking_date >= CURRENT_DATE ORDER BY b.booking_date, b.start_time`, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	bookings, err := scanRoomBookings(rows)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, RoomTimetable{Room: *room, Schedule: schedules, Bookings: bookings})
+}
+
+// GetFreeRoomsHandler finds rooms with nothing scheduled or booked at a given
+// time. Pass either day (weekly view) or date (also honours bookings), plus
+// time_slot. The usual room filters apply.
+func GetFreeRoomsHandler(c echo.Context) error {
+	day := c.QueryParam("day")
+	semester := c.QueryParam("semester")
+	var date *time.Time
+	if v := c.QueryParam("date"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "date must be YYYY-MM-DD"})
+		}
+		date = &d
+		day = d.Weekday().String()
+		if semester == "" {
+			if semester, err = semesterNameForDate(context.Background(), pool, d); err != nil {
+				if err == errOutsideCalendar {
+					return c.JSON(http.StatusBadRequest, map[string]string{"error": "date is outside the academic calendar"})
+				}
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+		}
+	}
+	if semester == "" || semester == currentSemesterName {
+		sem, err := getCurrentSemester(context.Background(), pool)
+		if err != nil && err != pgx.ErrNoRows {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		semester = ""
+		if sem != nil {
+			semester = sem.Name
+		}
+	}
+	if !isWeekday(day) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "day or date is required"})
+	}
+	wanted, err := parseTimeSlot(c.QueryParam("time_slot"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "time_slot must look like 09:00-10:30"})
+	}
+
+	rooms, msg, err := queryRooms(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	if err != nil {
+		fmt.Printf("GetFreeRoomsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	busy := map[string]bool{}
+	slots, _, err := loadScheduleSlots(ctx, tx, semester, day)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for _, slot := range slots {
+		if slot.Range.Overlaps(wanted) {
+			busy[roomKey(slot.RoomID, slot.RoomNumber)] = true
+		}
+	}
+
+	if date != nil {
+		rows, err := tx.Query(ctx, roomBookingSelectQuery+` WHERE b.booking_date = $1`, date.Format("2006-01-02"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		bookings, err := scanRoomBookings(rows)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		for _, b := range bookings {
+			if r, err := bookingRange(b); err == nil && r.Overlaps(wanted) {
+				busy[roomKey(b.RoomID, "")] = true
+			}
+		}
+	}
+
+	free := []Room{}
+	for _, room := range rooms {
+		if !busy[roomKey(room.ID, "")] && !busy[roomKey(0, room.RoomNumber)] {
+			free = append(free, room)
+		}
+	}
+
+	return c.JSON(http.StatusOK, free)
+}
+
+func GetRoomBookingsHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	rows, err := pool.Query(context.Background(), roomBookingSelectQuery+` WHERE b.room_id = $1 ORDER BY b.booking_date DESC, b.start_time`, id)
+	if err != nil {
+		fmt.Printf("GetRoomBookingsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	bookings, err := scanRoomBookings(rows)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, bookings)
+}
+
+// CreateRoomBookingHandler books a room for a one-off event. The booking must
+// not overlap other bookings of the room that day nor a lesson held in the
+// room that day, whether moved there or scheduled weekly.
+func CreateRoomBookingHandler(c echo.Context) error {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid room ID"})
+	}
+
+	var req RoomBookingRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	date, err := time.Parse("2006-01-02", req.BookingDate)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "booking_date must be YYYY-MM-DD"})
+	}
+	wanted, err := parseTimeSlot(req.StartTime + "-" + req.EndTime)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "start_time and end_time must look like 09:00 and end after start"})
+	}
+	if strings.TrimSpace(req.Purpose) == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "purpose is required"})
+	}
+
+	ctx := context.Background()
+	room, err := getRoomById(ctx, roomID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Room not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !room.IsActive {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Room is not active"})
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockSchedule(ctx, tx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	sessions, pending, semester, err := lessonsOnDate(ctx, tx, date, 0)
+	if err == errOutsideCalendar {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "booking_date is outside the academic calendar"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	conflicts := []ScheduleConflict{}
+	bookings, err := loadRoomBookings(ctx, tx, roomID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for _, b := range bookings {
+		if r, err := bookingRange(b); err == nil && b.BookingDate == req.BookingDate && r.Overlaps(wanted) {
+			conflicts = append(conflicts, ScheduleConflict{
+				Type: "booking", ConflictingID: b.ID, DayOfWeek: date.Weekday().String(),
+				TimeSlot: wanted.String(), ConflictingTimeSlot: r.String(), Resource: b.Purpose,
+			})
+		}
+	}
+
+	// Materialized sessions say where lessons really are that day, including
+	// moves and cancellations; weekly slots only count where none exists.
+	probe := scheduleSlot{RoomID: roomID, RoomNumber: room.RoomNumber, DayOfWeek: date.Weekday().String(), Semester: req.BookingDate, TimeSlot: wanted.String(), Range: wanted}
+	for _, conflict := range findSlotConflicts(probe, sessions) {
+		if conflict.Type == "room" {
+			conflict.Type = "session"
+			conflict.Semester = semester
+			conflicts = append(conflicts, conflict)
+		}
+	}
+	for _, conflict := range findSlotConflicts(probe, pending) {
+		if conflict.Type == "room" {
+			conflict.Semester = semester
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":     "Room is not free at this time",
+			"conflicts": conflicts,
+		})
+	}
+
+	var id int
+	err = tx.QueryRow(ctx, `
+        INSERT INTO room_bookings (room_id, booking_date, start_time, end_time, purpose, booked_by)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, roomID, req.BookingDate, req.StartTime, req.EndTime, strings.TrimSpace(req.Purpose), c.Get("user_id").(int)).Scan(&id)
+	if err != nil {
+		fmt.Printf("Failed to create room booking: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create booking"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create booking"})
+	}
+
+	rows, err := pool.Query(ctx, roomBookingSelectQuery+` WHERE b.id = $1`, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	created, err := scanRoomBookings(rows)
+	if err != nil || len(created) == 0 {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Booking created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, created[0])
+}
+
+func DeleteRoomBookingHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("bookingId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid booking ID"})
+	}
+
+	query := "DELETE FROM room_bookings WHERE id = $1"
+	args := []interface{}{id}
+	if c.Get("user_role").(string) != "admin" {
+		query += " AND booked_by = $2"
+		args = append(args, c.Get("user_id").(int))
+	}
+
+	tag, err := pool.Exec(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("Failed to delete room booking: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete booking"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Booking not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
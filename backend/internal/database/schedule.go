@@ -0,0 +1,553 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+type Schedule struct {
+	ID           int    `json:"id"`
+	SubjectID    int    `json:"subject_id"`
+	SubjectName  string `json:"subject_name"`
+	SubjectCode  string `json:"subject_code"`
+	TeacherID    int    `json:"teacher_id"`
+	TeacherName  string `json:"teacher_name"`
+	DayOfWeek    string `json:"day_of_week"`
+	TimeSlot     string `json:"time_slot"`
+	RoomID       *int   `json:"room_id"`
+	RoomNumber   string `json:"room_number"`
+	BuildingName string `json:"building_name,omitempty"`
+	Semester     string `json:"semester"`
+	AcademicYear string `json:"academic_year"`
+	GroupID      int    `json:"group_id"`
+	GroupName    string `json:"group_name"`
+}
+
+type ScheduleRequest struct {
+	SubjectID    int    `json:"subject_id"`
+	GroupID      int    `json:"group_id"`
+	TeacherID    int    `json:"teacher_id"`
+	DayOfWeek    string `json:"day_of_week"`
+	TimeSlot     string `json:"time_slot"`
+	RoomID       int    `json:"room_id"`
+	RoomNumber   string `json:"room_number"`
+	Semester     string `json:"semester"`
+	AcademicYear string `json:"academic_year"`
+	SemesterID   int    `json:"-"`
+}
+
+// ScheduleFilter narrows schedule queries. Zero values mean "any".
+type ScheduleFilter struct {
+	GroupID    int
+	SubjectID  int
+	TeacherID  int
+	DayOfWeek  string
+	RoomID     int
+	RoomNumber string
+	Semester   string
+}
+
+var weekdays = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"}
+
+var semesterRegex = regexp.MustCompile(`^(Fall|Spring|Summer) \d{4}$`)
+
+func isWeekday(day string) bool {
+	for _, d := range weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func validateScheduleRequest(req *ScheduleRequest) string {
+	if req.SubjectID <= 0 || req.GroupID <= 0 || req.TeacherID <= 0 {
+		return "subject_id, group_id and teacher_id are required"
+	}
+	if !isWeekday(req.DayOfWeek) {
+		return "day_of_week must be a full weekday name, e.g. Monday"
+	}
+	timeRange, err := parseTimeSlot(req.TimeSlot)
+	if err != nil {
+		return "time_slot must look like 09:00-10:30 and end after it starts"
+	}
+	req.TimeSlot = timeRange.String()
+	req.RoomNumber = strings.TrimSpace(req.RoomNumber)
+	if req.Semester != "" && req.Semester != currentSemesterName && !semesterRegex.MatchString(req.Semester) {
+		return "semester must look like Spring 2026"
+	}
+	if req.AcademicYear != "" && !validateAcademicYear(req.AcademicYear) {
+		return "academic_year must look like 2025-2026"
+	}
+	return ""
+}
+
+// resolveScheduleSemester replaces the requested semester name (the current
+// semester if empty) with the calendar entry, filling in its id and
+// academic year.
+func resolveScheduleSemester(ctx context.Context, q queryRower, req *ScheduleRequest) (string, error) {
+	sem, err := resolveSemester(ctx, q, req.Semester)
+	if err == pgx.ErrNoRows {
+		return "Unknown semester. Add it to the academic calendar first", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if req.AcademicYear != "" && req.AcademicYear != sem.AcademicYear {
+		return fmt.Sprintf("%s belongs to academic year %s", sem.Name, sem.AcademicYear), nil
+	}
+	req.SemesterID = sem.ID
+	req.Semester = sem.Name
+	req.AcademicYear = sem.AcademicYear
+	return "", nil
+}
+
+func parseScheduleFilter(c echo.Context) (ScheduleFilter, string) {
+	var filter ScheduleFilter
+	var err error
+	if v := c.QueryParam("group_id"); v != "" {
+		if filter.GroupID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid group_id"
+		}
+	}
+	if v := c.QueryParam("subject_id"); v != "" {
+		if filter.SubjectID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid subject_id"
+		}
+	}
+	if v := c.QueryParam("teacher_id"); v != "" {
+		if filter.TeacherID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid teacher_id"
+		}
+	}
+	if v := c.QueryParam("day"); v != "" {
+		if !isWeekday(v) {
+			return filter, "day must be a full weekday name, e.g. Monday"
+		}
+		filter.DayOfWeek = v
+	}
+	if v := c.QueryParam("room_id"); v != "" {
+		if filter.RoomID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid room_id"
+		}
+	}
+	filter.RoomNumber = c.QueryParam("room")
+	filter.Semester = c.QueryParam("semester")
+	if filter.Semester == currentSemesterName {
+		sem, err := getCurrentSemester(context.Background(), pool)
+		if err != nil {
+			return filter, "No current semester in the academic calendar"
+		}
+		filter.Semester = sem.Name
+	}
+	return filter, ""
+}
+
+const scheduleSelectQuery = `
+    SELECT s.id, s.subject_id, sub.subject_name, sub.subject_code, s.teacher_id, t.full_name,
+        s.day_of_week, s.time_slot, s.room_id, COALESCE(s.room_number, ''), COALESCE(b.building_name, ''),
+        sem.name, s.academic_year, s.group_id, sg.group_name
+    FROM schedule s
+    JOIN semesters sem ON s.semester_id = sem.id
+    JOIN subjects sub ON s.subject_id = sub.id
+    JOIN teachers t ON s.teacher_id = t.id
+    LEFT JOIN student_groups sg ON s.group_id = sg.id
+    LEFT JOIN rooms r ON s.room_id = r.id
+    LEFT JOIN buildings b ON r.building_id = b.id
+`
+
+const scheduleOrderBy = `
+    ORDER BY array_position(ARRAY['Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday', 'Sunday']::varchar[], s.day_of_week),
+        s.time_slot, s.id
+`
+
+func scanSchedule(row pgx.Row) (*Schedule, error) {
+	schedule := &Schedule{}
+	err := row.Scan(&schedule.ID, &schedule.SubjectID, &schedule.SubjectName, &schedule.SubjectCode, &schedule.TeacherID, &schedule.TeacherName,
+		&schedule.DayOfWeek, &schedule.TimeSlot, &schedule.RoomID, &schedule.RoomNumber, &schedule.BuildingName, &schedule.Semester, &schedule.AcademicYear, &schedule.GroupID, &schedule.GroupName)
+	if err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+func getSchedules(pool *pgxpool.Pool, filter ScheduleFilter) ([]Schedule, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+	if filter.GroupID > 0 {
+		where("s.group_id = $%d", filter.GroupID)
+	}
+	if filter.SubjectID > 0 {
+		where("s.subject_id = $%d", filter.SubjectID)
+	}
+	if filter.TeacherID > 0 {
+		where("s.teacher_id = $%d", filter.TeacherID)
+	}
+	if filter.DayOfWeek != "" {
+		where("s.day_of_week = $%d", filter.DayOfWeek)
+	}
+	if filter.RoomID > 0 {
+		where("s.room_id = $%d", filter.RoomID)
+	}
+	if filter.RoomNumber != "" {
+		where("s.room_number = $%d", filter.RoomNumber)
+	}
+	if filter.Semester != "" {
+		where("s.semester_id = (SELECT id FROM semesters WHERE name = $%d)", filter.Semester)
+	}
+
+	query := scheduleSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += scheduleOrderBy
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+func getScheduleById(pool *pgxpool.Pool, id int) (*Schedule, error) {
+	return scanSchedule(pool.QueryRow(context.Background(), scheduleSelectQuery+` WHERE s.id = $1`, id))
+}
+
+func GetAllScheduleHandler(c echo.Context) error {
+	filter, msg := parseScheduleFilter(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	schedules, err := getSchedules(pool, filter)
+	if err != nil {
+		fmt.Printf("GetAllScheduleHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, schedules)
+}
+
+func GetScheduleByGroupHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group ID"})
+	}
+
+	filter, msg := parseScheduleFilter(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	filter.GroupID = id
+
+	schedules, err := getSchedules(pool, filter)
+	if err != nil {
+		fmt.Printf("GetScheduleByGroupHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, schedules)
+}
+
+func GetScheduleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+	}
+
+	schedule, err := getScheduleById(pool, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule entry not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+func CreateScheduleHandler(c echo.Context) error {
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateScheduleRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	if msg, err := resolveScheduleRoom(ctx, tx, &req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	} else if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	if msg, err := resolveScheduleSemester(ctx, tx, &req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	} else if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	conflicts, err := lockAndCheckScheduleConflicts(ctx, tx, 0, &req)
+	if err != nil {
+		fmt.Printf("Failed to check schedule conflicts: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if len(conflicts) > 0 {
+		return scheduleConflictResponse(c, conflicts)
+	}
+
+	var id int
+	query := `
+        INSERT INTO schedule (subject_id, group_id, teacher_id, day_of_week, time_slot, room_id, room_number, semester_id, academic_year)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, ''), $8, $9)
+        RETURNING id
+    `
+	err = tx.QueryRow(ctx, query, req.SubjectID, req.GroupID, req.TeacherID, req.DayOfWeek,
+		req.TimeSlot, req.RoomID, req.RoomNumber, req.SemesterID, req.AcademicYear).Scan(&id)
+	if err != nil {
+		return scheduleWriteError(c, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save schedule entry"})
+	}
+
+	schedule, err := getScheduleById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Schedule entry created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+func UpdateScheduleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+	}
+
+	var req ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateScheduleRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	if msg, err := resolveScheduleRoom(ctx, tx, &req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	} else if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+	if msg, err := resolveScheduleSemester(ctx, tx, &req); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	} else if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	conflicts, err := lockAndCheckScheduleConflicts(ctx, tx, id, &req)
+	if err != nil {
+		fmt.Printf("Failed to check schedule conflicts: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if len(conflicts) > 0 {
+		return scheduleConflictResponse(c, conflicts)
+	}
+
+	query := `
+        UPDATE schedule
+        SET subject_id = $1, group_id = $2, teacher_id = $3, day_of_week = $4, time_slot = $5, room_id = NULLIF($6, 0),
+            room_number = NULLIF($7, ''), semester_id = $8, academic_year = $9, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $10
+    `
+	tag, err := tx.Exec(ctx, query, req.SubjectID, req.GroupID, req.TeacherID, req.DayOfWeek,
+		req.TimeSlot, req.RoomID, req.RoomNumber, req.SemesterID, req.AcademicYear, id)
+	if err != nil {
+		return scheduleWriteError(c, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule entry not found"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save schedule entry"})
+	}
+
+	schedule, err := getScheduleById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Schedule entry updated but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// resolveScheduleRoom copies the room number of a referenced room onto the
+// request so schedule.room_number stays a readable label. A free-text room
+// number that names exactly one room is linked to it, so conflict checks
+// see both spellings of the same room.
+func resolveScheduleRoom(ctx context.Context, tx pgx.Tx, req *ScheduleRequest) (string, error) {
+	if req.RoomID <= 0 {
+		req.RoomID = 0
+		if normalizeRoom(req.RoomNumber) == "" {
+			return "", nil
+		}
+		id, number, err := matchRoomNumber(ctx, tx, req.RoomNumber)
+		if err != nil {
+			return "", err
+		}
+		if id > 0 {
+			req.RoomID, req.RoomNumber = id, number
+		}
+		return "", nil
+	}
+	var isActive bool
+	err := tx.QueryRow(ctx, "SELECT room_number, is_active FROM rooms WHERE id = $1", req.RoomID).Scan(&req.RoomNumber, &isActive)
+	if err == pgx.ErrNoRows {
+		return "Invalid room_id", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !isActive {
+		return "Room is not active", nil
+	}
+	return "", nil
+}
+
+// matchRoomNumber finds the active room a free-text room number names. It
+// returns 0 when no room or more than one room matches.
+func matchRoomNumber(ctx context.Context, tx pgx.Tx, roomNumber string) (int, string, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT id, room_number FROM rooms
+        WHERE is_active AND lower(regexp_replace(trim(room_number), '\s+', ' ', 'g')) = $1
+        LIMIT 2
+    `, normalizeRoom(roomNumber))
+	if err != nil {
+		return 0, "", err
+	}
+	defer rows.Close()
+
+	var id, matches int
+	var number string
+	for rows.Next() {
+		if err := rows.Scan(&id, &number); err != nil {
+			return 0, "", err
+		}
+		matches++
+	}
+	if err := rows.Err(); err != nil || matches != 1 {
+		return 0, "", err
+	}
+	return id, number, nil
+}
+
+// lockAndCheckScheduleConflicts serializes schedule writers for the rest of
+// the transaction and returns the entries the new one would overlap.
+func lockAndCheckScheduleConflicts(ctx context.Context, tx pgx.Tx, id int, req *ScheduleRequest) ([]ScheduleConflict, error) {
+	if err := lockSchedule(ctx, tx); err != nil {
+		return nil, err
+	}
+	return checkScheduleConflicts(ctx, tx, id, req)
+}
+
+func scheduleConflictResponse(c echo.Context, conflicts []ScheduleConflict) error {
+	return c.JSON(http.StatusConflict, map[string]interface{}{
+		"error":     "Schedule entry conflicts with existing entries",
+		"conflicts": conflicts,
+	})
+}
+
+func scheduleWriteError(c echo.Context, err error) error {
+	if isForeignKeyViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject_id, group_id or teacher_id"})
+	}
+	fmt.Printf("Failed to save schedule entry: %v\n", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save schedule entry"})
+}
+
+// DeleteScheduleHandler removes a weekly entry together with its generated
+// lesson sessions. It refuses while any of those sessions has exceptions,
+// check-in windows or attendance, which would be lost with it.
+func DeleteScheduleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid schedule ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var exceptions, checkins, attendance int
+	err = tx.QueryRow(ctx, `
+        SELECT
+            (SELECT COUNT(*) FROM schedule_exceptions se JOIN lesson_sessions ls ON se.session_id = ls.id WHERE ls.schedule_id = $1),
+            (SELECT COUNT(*) FROM attendance_checkin_windows w JOIN lesson_sessions ls ON w.session_id = ls.id WHERE ls.schedule_id = $1),
+            (SELECT COUNT(*) FROM attendance a JOIN lesson_sessions ls ON a.session_id = ls.id WHERE ls.schedule_id = $1)
+    `, id).Scan(&exceptions, &checkins, &attendance)
+	if err != nil {
+		fmt.Printf("DeleteScheduleHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if exceptions > 0 || checkins > 0 || attendance > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":           "Lessons of this entry already have exceptions, check-ins or attendance; they would be lost",
+			"exceptions":      exceptions,
+			"checkin_windows": checkins,
+			"attendance":      attendance,
+		})
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM schedule WHERE id = $1", id)
+	if err != nil {
+		fmt.Printf("Failed to delete schedule entry: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete schedule entry"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Schedule entry not found"})
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete schedule entry"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// TimeRange is a half-open interval of minutes since midnight.
+type TimeRange struct {
+	Start int
+	End   int
+}
+
+func (r TimeRange) Overlaps(other TimeRange) bool {
+	return r.Start < other.End && other.Start < r.End
+}
+
+func (r TimeRange) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", r.Start/60, r.Start%60, r.End/60, r.End%60)
+}
+
+func parseClock(s string) (int, error) {
+	if len(s) != 5 || s[2] != ':' {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	hour, err := strconv.Atoi(s[:2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	minute, err := strconv.Atoi(s[3:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+// parseTimeSlot turns a schedule time_slot like "09:00-10:30" into a range.
+func parseTimeSlot(slot string) (TimeRange, error) {
+	parts := strings.Split(strings.TrimSpace(slot), "-")
+	if len(parts) != 2 {
+		return TimeRange{}, fmt.Errorf("time slot %q must look like 09:00-10:30", slot)
+	}
+	start, err := parseClock(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return TimeRange{}, err
+	}
+	end, err := parseClock(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return TimeRange{}, err
+	}
+	if end <= start {
+		return TimeRange{}, fmt.Errorf("time slot %q ends before it starts", slot)
+	}
+	return TimeRange{Start: start, End: end}, nil
+}
+
+func normalizeRoom(room string) string {
+	return strings.ToLower(strings.Join(strings.Fields(room), " "))
+}
+
+// roomKey identifies a room for conflict checks: by rooms.id when the entry
+// references one, otherwise by its normalized free-text room number.
+func roomKey(roomID int, roomNumber string) string {
+	if roomID > 0 {
+		return fmt.Sprintf("id:%d", roomID)
+	}
+	if name := normalizeRoom(roomNumber); name != "" {
+		return "name:" + name
+	}
+	return ""
+}
+
+// scheduleSlot is the part of a schedule row that matters for conflicts.
+type scheduleSlot struct {
+	ID         int
+	GroupID    int
+	TeacherID  int
+	RoomID     int
+	RoomNumber string
+	DayOfWeek  string
+	Semester   string
+	TimeSlot   string
+	Range      TimeRange
+}
+
+type ScheduleConflict struct {
+	Type                string `json:"type"`
+	ScheduleID          int    `json:"schedule_id,omitempty"`
+	ConflictingID       int    `json:"conflicting_id"`
+	Semester            string `json:"semester"`
+	DayOfWeek           string `json:"day_of_week"`
+	TimeSlot            string `json:"time_slot"`
+	ConflictingTimeSlot string `json:"conflicting_time_slot"`
+	Resource            string `json:"resource"`
+}
+
+type ConflictReport struct {
+	Conflicts        []ScheduleConflict `json:"conflicts"`
+	InvalidTimeSlots []int              `json:"invalid_time_slots,omitempty"`
+}
+
+// findSlotConflicts returns every way in which slot collides with others:
+// the same teacher, group or room booked at an overlapping time on the same
+// day of the same semester.
+func findSlotConflicts(slot scheduleSlot, others []scheduleSlot) []ScheduleConflict {
+	var conflicts []ScheduleConflict
+	room := roomKey(slot.RoomID, slot.RoomNumber)
+	for _, other := range others {
+		if other.ID == slot.ID && slot.ID != 0 {
+			continue
+		}
+		if other.Semester != slot.Semester || other.DayOfWeek != slot.DayOfWeek || !slot.Range.Overlaps(other.Range) {
+			continue
+		}
+		base := ScheduleConflict{
+			ScheduleID:          slot.ID,
+			ConflictingID:       other.ID,
+			Semester:            slot.Semester,
+			DayOfWeek:           slot.DayOfWeek,
+			TimeSlot:            slot.TimeSlot,
+			ConflictingTimeSlot: other.TimeSlot,
+		}
+		if other.TeacherID == slot.TeacherID {
+			c := base
+			c.Type = "teacher"
+			c.Resource = fmt.Sprintf("teacher %d", slot.TeacherID)
+			conflicts = append(conflicts, c)
+		}
+		if other.GroupID == slot.GroupID {
+			c := base
+			c.Type = "group"
+			c.Resource = fmt.Sprintf("group %d", slot.GroupID)
+			conflicts = append(conflicts, c)
+		}
+		if room != "" && roomKey(other.RoomID, other.RoomNumber) == room {
+			c := base
+			c.Type = "room"
+			c.Resource = slot.RoomNumber
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+// loadScheduleSlots reads schedule rows for conflict checks. Rows whose
+// time_slot cannot be parsed are returned separately by id.
+func loadScheduleSlots(ctx context.Context, q pgx.Tx, semester, dayOfWeek string) ([]scheduleSlot, []int, error) {
+	query := `
+        SELECT s.id, s.group_id, s.teacher_id, COALESCE(s.room_id, 0), COALESCE(s.room_number, ''), s.day_of_week, sem.name, s.time_slot
+        FROM schedule s
+        JOIN semesters sem ON s.semester_id = sem.id
+        WHERE ($1 = '' OR sem.name = $1) AND ($2 = '' OR s.day_of_week = $2)
+        ORDER BY s.id
+    `
+	rows, err := q.Query(ctx, query, semester, dayOfWeek)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var slots []scheduleSlot
+	var invalid []int
+	for rows.Next() {
+		var slot scheduleSlot
+		if err := rows.Scan(&slot.ID, &slot.GroupID, &slot.TeacherID, &slot.RoomID, &slot.RoomNumber, &slot.DayOfWeek, &slot.Semester, &slot.TimeSlot); err != nil {
+			return nil, nil, err
+		}
+		r, err := parseTimeSlot(slot.TimeSlot)
+		if err != nil {
+			invalid = append(invalid, slot.ID)
+			continue
+		}
+		slot.Range = r
+		slots = append(slots, slot)
+	}
+	return slots, invalid, rows.Err()
+}
+
+// lockSchedule takes a transaction-scoped advisory lock so two concurrent
+// writers cannot both pass the conflict check.
+func lockSchedule(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('schedule'))")
+	return err
+}
+
+func checkScheduleConflicts(ctx context.Context, tx pgx.Tx, id int, req *ScheduleRequest) ([]ScheduleConflict, error) {
+	r, err := parseTimeSlot(req.TimeSlot)
+	if err != nil {
+		return nil, err
+	}
+	slot := scheduleSlot{
+		ID:         id,
+		GroupID:    req.GroupID,
+		TeacherID:  req.TeacherID,
+		RoomID:     req.RoomID,
+		RoomNumber: req.RoomNumber,
+		DayOfWeek:  req.DayOfWeek,
+		Semester:   req.Semester,
+		TimeSlot:   req.TimeSlot,
+		Range:      r,
+	}
+
+	others, _, err := loadScheduleSlots(ctx, tx, req.Semester, req.DayOfWeek)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := findSlotConflicts(slot, others)
+
+	if req.RoomID > 0 {
+		bookings, err := loadRoomBookings(ctx, tx, req.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, findBookingConflicts(slot, bookings)...)
+	}
+	return conflicts, nil
+}
+
+// GetScheduleConflictsHandler audits existing schedule rows and reports every
+// overlapping pair once.
+func GetScheduleConflictsHandler(c echo.Context) error {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	slots, invalid, err := loadScheduleSlots(ctx, tx, c.QueryParam("semester"), "")
+	if err != nil {
+		fmt.Printf("GetScheduleConflictsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	report := ConflictReport{Conflicts: []ScheduleConflict{}, InvalidTimeSlots: invalid}
+	for i, slot := range slots {
+		report.Conflicts = append(report.Conflicts, findSlotConflicts(slot, slots[i+1:])...)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTimeSlot(t *testing.T) {
+	tests := []struct {
+		name    string
+		slot    string
+		want    TimeRange
+		wantErr bool
+	}{
+		{name: "valid", slot: "09:00-10:30", want: TimeRange{Start: 540, End: 630}},
+		{name: "surrounding spaces", slot: " 09:00 - 10:30 ", want: TimeRange{Start: 540, End: 630}},
+		{name: "midnight start", slot: "00:00-00:01", want: TimeRange{Start: 0, End: 1}},
+		{name: "end of day", slot: "22:00-23:59", want: TimeRange{Start: 1320, End: 1439}},
+		{name: "empty", slot: "", wantErr: true},
+		{name: "missing end", slot: "09:00", wantErr: true},
+		{name: "extra part", slot: "09:00-10:00-11:00", wantErr: true},
+		{name: "single digit hour", slot: "9:00-10:30", wantErr: true},
+		{name: "hour out of range", slot: "24:00-24:30", wantErr: true},
+		{name: "minute out of range", slot: "09:60-10:30", wantErr: true},
+		{name: "not a number", slot: "ab:cd-10:30", wantErr: true},
+		{name: "ends before it starts", slot: "10:30-09:00", wantErr: true},
+		{name: "empty range", slot: "10:30-10:30", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTimeSlot(tt.slot)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseTimeSlot(%q) = %v, want error", tt.slot, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTimeSlot(%q) error: %v", tt.slot, err)
+			}
+			if got != tt.want {
+				t.Fatalf("parseTimeSlot(%q) = %v, want %v", tt.slot, got, tt.want)
+			}
+		})
+	}
+}
+
+func testSlot(id, groupID, teacherID, roomID int, roomNumber, day, timeSlot string) scheduleSlot {
+	r, err := parseTimeSlot(timeSlot)
+	if err != nil {
+		panic(err)
+	}
+	return scheduleSlot{
+		ID:         id,
+		GroupID:    groupID,
+		TeacherID:  teacherID,
+		RoomID:     roomID,
+		RoomNumber: roomNumber,
+		DayOfWeek:  day,
+		Semester:   "2025-2026 Fall",
+		TimeSlot:   timeSlot,
+		Range:      r,
+	}
+}
+
+func TestFindSlotConflicts(t *testing.T) {
+	slot := testSlot(1, 10, 20, 0, "A-101", "Monday", "09:00-10:30")
+
+	otherSemester := testSlot(2, 10, 20, 0, "A-101", "Monday", "09:00-10:30")
+	otherSemester.Semester = "2025-2026 Spring"
+
+	tests := []struct {
+		name   string
+		slot   scheduleSlot
+		others []scheduleSlot
+		want   []string
+	}{
+		{
+			name:   "teacher",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 11, 20, 0, "B-201", "Monday", "10:00-11:30")},
+			want:   []string{"teacher"},
+		},
+		{
+			name:   "group",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 10, 21, 0, "B-201", "Monday", "08:00-09:30")},
+			want:   []string{"group"},
+		},
+		{
+			name:   "room by normalized number",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 11, 21, 0, "  a-101 ", "Monday", "09:00-10:30")},
+			want:   []string{"room"},
+		},
+		{
+			name:   "room by id",
+			slot:   testSlot(1, 10, 20, 5, "A-101", "Monday", "09:00-10:30"),
+			others: []scheduleSlot{testSlot(2, 11, 21, 5, "Main hall", "Monday", "09:00-10:30")},
+			want:   []string{"room"},
+		},
+		{
+			name:   "same number but different room ids",
+			slot:   testSlot(1, 10, 20, 5, "A-101", "Monday", "09:00-10:30"),
+			others: []scheduleSlot{testSlot(2, 11, 21, 6, "A-101", "Monday", "09:00-10:30")},
+		},
+		{
+			name:   "every resource at once",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 10, 20, 0, "A-101", "Monday", "09:00-10:30")},
+			want:   []string{"teacher", "group", "room"},
+		},
+		{
+			name: "several other slots",
+			slot: slot,
+			others: []scheduleSlot{
+				testSlot(2, 10, 21, 0, "", "Monday", "09:30-10:00"),
+				testSlot(3, 11, 20, 0, "", "Monday", "10:00-12:00"),
+			},
+			want: []string{"group", "teacher"},
+		},
+		{
+			name:   "back to back",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 10, 20, 0, "A-101", "Monday", "10:30-12:00")},
+		},
+		{
+			name:   "different day",
+			slot:   slot,
+			others: []scheduleSlot{testSlot(2, 10, 20, 0, "A-101", "Tuesday", "09:00-10:30")},
+		},
+		{
+			name:   "different semester",
+			slot:   slot,
+			others: []scheduleSlot{otherSemester},
+		},
+		{
+			name:   "the slot itself",
+			slot:   slot,
+			others: []scheduleSlot{slot},
+		},
+		{
+			name:   "new slot without a room",
+			slot:   testSlot(0, 12, 22, 0, "", "Monday", "09:00-10:30"),
+			others: []scheduleSlot{testSlot(2, 11, 21, 0, "", "Monday", "09:00-10:30")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range findSlotConflicts(tt.slot, tt.others) {
+				got = append(got, c.Type)
+				if c.ScheduleID != tt.slot.ID || c.TimeSlot != tt.slot.TimeSlot {
+					t.Errorf("conflict %+v does not describe slot %d", c, tt.slot.ID)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("conflict types = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,543 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// SessionExceptionRequest is the body of the cancel, move, substitute and
+// restore endpoints. Only the fields relevant to the action are read.
+type SessionExceptionRequest struct {
+	Reason      string `json:"reason"`
+	SessionDate string `json:"session_date"`
+	TimeSlot    string `json:"time_slot"`
+	RoomID      int    `json:"room_id"`
+	RoomNumber  string `json:"room_number"`
+	TeacherID   int    `json:"teacher_id"`
+}
+
+type ScheduleException struct {
+	ID            int       `json:"id"`
+	SessionID     int       `json:"session_id"`
+	SubjectID     int       `json:"subject_id"`
+	SubjectName   string    `json:"subject_name"`
+	GroupID       int       `json:"group_id"`
+	ExceptionType string    `json:"exception_type"`
+	Reason        string    `json:"reason"`
+	OldDate       *string   `json:"old_date"`
+	OldTimeSlot   *string   `json:"old_time_slot"`
+	OldRoomNumber *string   `json:"old_room_number"`
+	OldTeacherID  *int      `json:"old_teacher_id"`
+	NewDate       *string   `json:"new_date"`
+	NewTimeSlot   *string   `json:"new_time_slot"`
+	NewRoomNumber *string   `json:"new_room_number"`
+	NewTeacherID  *int      `json:"new_teacher_id"`
+	CreatedBy     *int      `json:"created_by"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// sessionState is the mutable part of a lesson session.
+type sessionState struct {
+	ID         int
+	GroupID    int
+	TeacherID  int
+	Date       string
+	TimeSlot   string
+	RoomID     int
+	RoomNumber string
+	Status     string
+}
+
+func loadSessionStateForUpdate(ctx context.Context, tx pgx.Tx, id int) (*sessionState, error) {
+	st := &sessionState{ID: id}
+	err := tx.QueryRow(ctx, `
+        SELECT group_id, teacher_id, session_date::text, time_slot, COALESCE(room_id, 0), COALESCE(room_number, ''), status
+        FROM lesson_sessions
+        WHERE id = $1
+        FOR UPDATE
+    `, id).Scan(&st.GroupID, &st.TeacherID, &st.Date, &st.TimeSlot, &st.RoomID, &st.RoomNumber, &st.Status)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// findSessionConflicts checks a session as it would be after a change
+// against everything else happening that day: other sessions, weekly
+// schedule entries whose sessions have not been generated for that day, and
+// room bookings.
+// lessonsOnDate returns what takes place on date: the scheduled lesson
+// sessions other than excludeID, and the weekly slots of the semester that
+// have no session materialized for that date yet. Slots carry the date as
+// their Semester so they only compare with each other. The semester name is
+// returned as well; errOutsideCalendar means date is in no semester.
+func lessonsOnDate(ctx context.Context, tx pgx.Tx, date time.Time, excludeID int) ([]scheduleSlot, []scheduleSlot, string, error) {
+	day := date.Format("2006-01-02")
+	weekday := date.Weekday().String()
+	rows, err := tx.Query(ctx, `
+        SELECT id, group_id, teacher_id, COALESCE(room_id, 0), COALESCE(room_number, ''), time_slot
+        FROM lesson_sessions
+        WHERE session_date = $1 AND status = 'scheduled' AND id <> $2
+    `, day, excludeID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var sessions []scheduleSlot
+	for rows.Next() {
+		slot := scheduleSlot{DayOfWeek: weekday, Semester: day}
+		if err := rows.Scan(&slot.ID, &slot.GroupID, &slot.TeacherID, &slot.RoomID, &slot.RoomNumber, &slot.TimeSlot); err != nil {
+			rows.Close()
+			return nil, nil, "", err
+		}
+		if slot.Range, err = parseTimeSlot(slot.TimeSlot); err != nil {
+			continue
+		}
+		sessions = append(sessions, slot)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, "", err
+	}
+
+	semester, err := semesterNameForDate(ctx, tx, date)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	weekly, _, err := loadScheduleSlots(ctx, tx, semester, weekday)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	materialized := map[int]bool{}
+	rows, err = tx.Query(ctx, "SELECT schedule_id FROM lesson_sessions WHERE original_date = $1", day)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	for rows.Next() {
+		var scheduleID int
+		if err := rows.Scan(&scheduleID); err != nil {
+			rows.Close()
+			return nil, nil, "", err
+		}
+		materialized[scheduleID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, "", err
+	}
+	var pending []scheduleSlot
+	for _, slot := range weekly {
+		if !materialized[slot.ID] {
+			slot.Semester = day
+			pending = append(pending, slot)
+		}
+	}
+	return sessions, pending, semester, nil
+}
+
+func findSessionConflicts(ctx context.Context, tx pgx.Tx, st sessionState) ([]ScheduleConflict, error) {
+	date, err := parseDate(st.Date)
+	if err != nil {
+		return nil, err
+	}
+	r, err := parseTimeSlot(st.TimeSlot)
+	if err != nil {
+		return nil, err
+	}
+	weekday := date.Weekday().String()
+	probe := scheduleSlot{
+		ID:         st.ID,
+		GroupID:    st.GroupID,
+		TeacherID:  st.TeacherID,
+		RoomID:     st.RoomID,
+		RoomNumber: st.RoomNumber,
+		DayOfWeek:  weekday,
+		Semester:   st.Date,
+		TimeSlot:   r.String(),
+		Range:      r,
+	}
+
+	sessions, pending, semester, err := lessonsOnDate(ctx, tx, date, st.ID)
+	if err != nil {
+		return nil, err
+	}
+	conflicts := findSlotConflicts(probe, sessions)
+	weeklyProbe := probe
+	weeklyProbe.ID = 0
+	conflicts = append(conflicts, findSlotConflicts(weeklyProbe, pending)...)
+
+	if st.RoomID > 0 {
+		rows, err := tx.Query(ctx, roomBookingSelectQuery+` WHERE b.room_id = $1 AND b.booking_date = $2`, st.RoomID, st.Date)
+		if err != nil {
+			return nil, err
+		}
+		bookings, err := scanRoomBookings(rows)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range bookings {
+			if br, err := bookingRange(b); err == nil && br.Overlaps(r) {
+				conflicts = append(conflicts, ScheduleConflict{
+					Type: "booking", ScheduleID: st.ID, ConflictingID: b.ID, Semester: semester, DayOfWeek: weekday,
+					TimeSlot: r.String(), ConflictingTimeSlot: br.String(), Resource: b.Purpose,
+				})
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+func CancelSessionHandler(c echo.Context) error {
+	return changeSession(c, "cancel")
+}
+
+func MoveSessionHandler(c echo.Context) error {
+	return changeSession(c, "move")
+}
+
+func SubstituteTeacherHandler(c echo.Context) error {
+	return changeSession(c, "substitute")
+}
+
+func RestoreSessionHandler(c echo.Context) error {
+	return changeSession(c, "restore")
+}
+
+// changeSession applies one exception to a lesson session and records it.
+// Teachers may only change their own sessions.
+func changeSession(c echo.Context, kind string) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+	}
+
+	var req SessionExceptionRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "reason is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockSchedule(ctx, tx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	old, err := loadSessionStateForUpdate(ctx, tx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Lesson session not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if c.Get("user_role").(string) == "teacher" {
+		teacherID, err := getLinkedTeacherID(c.Get("user_id").(int))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if teacherID == nil || *teacherID != old.TeacherID {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only change your own lessons"})
+		}
+	}
+
+	var hasAttendance bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM attendance WHERE session_id = $1)", id).Scan(&hasAttendance); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	next := *old
+	switch kind {
+	case "cancel":
+		if old.Status != "scheduled" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Lesson session is already cancelled"})
+		}
+		if hasAttendance {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Attendance has already been recorded for this lesson"})
+		}
+		next.Status = "cancelled"
+	case "restore":
+		if old.Status != "cancelled" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Lesson session is not cancelled"})
+		}
+		next.Status = "scheduled"
+	case "move":
+		if old.Status != "scheduled" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "A cancelled lesson cannot be moved. Restore it first"})
+		}
+		if msg, err := applySessionMove(ctx, tx, &next, &req); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else if msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+		if next == *old {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Nothing to change: give a new session_date, time_slot or room"})
+		}
+		if hasAttendance && next.Date != old.Date {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Attendance has already been recorded for this lesson"})
+		}
+	case "substitute":
+		if old.Status != "scheduled" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Lesson session is cancelled"})
+		}
+		if req.TeacherID <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "teacher_id is required"})
+		}
+		if req.TeacherID == old.TeacherID {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Teacher already teaches this lesson"})
+		}
+		var status string
+		err := tx.QueryRow(ctx, "SELECT COALESCE(status, 'Active') FROM teachers WHERE id = $1", req.TeacherID).Scan(&status)
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid teacher_id"})
+		}
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if status != "Active" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Substitute teacher is not active"})
+		}
+		next.TeacherID = req.TeacherID
+	}
+
+	if next.Status == "scheduled" {
+		conflicts, err := findSessionConflicts(ctx, tx, next)
+		if err == errOutsideCalendar {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "The lesson date is outside the academic calendar"})
+		}
+		if err != nil {
+			fmt.Printf("Failed to check session conflicts: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if len(conflicts) > 0 {
+			return c.JSON(http.StatusConflict, map[string]interface{}{
+				"error":     "Lesson session conflicts with other lessons that day",
+				"conflicts": conflicts,
+			})
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE lesson_sessions
+        SET session_date = $1, time_slot = $2, room_id = NULLIF($3, 0), room_number = NULLIF($4, ''), teacher_id = $5, status = $6,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE id = $7
+    `, next.Date, next.TimeSlot, next.RoomID, next.RoomNumber, next.TeacherID, next.Status, id)
+	if err != nil {
+		fmt.Printf("Failed to update lesson session: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update lesson session"})
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO schedule_exceptions (session_id, exception_type, reason, old_date, old_time_slot, old_room_number, old_teacher_id,
+            new_date, new_time_slot, new_room_number, new_teacher_id, created_by)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, NULLIF($10, ''), $11, $12)
+    `, id, kind, req.Reason, old.Date, old.TimeSlot, old.RoomNumber, old.TeacherID,
+		next.Date, next.TimeSlot, next.RoomNumber, next.TeacherID, c.Get("user_id").(int))
+	if err != nil {
+		fmt.Printf("Failed to record schedule exception: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update lesson session"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update lesson session"})
+	}
+
+	session, err := getLessonSessionById(ctx, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Lesson session updated but failed to load it"})
+	}
+
+	teachers := []int{old.TeacherID}
+	if next.TeacherID != old.TeacherID {
+		teachers = append(teachers, next.TeacherID)
+	}
+	if userIDs, err := teacherAccountIDs(ctx, teachers); err != nil {
+		fmt.Printf("Failed to resolve teachers to notify: %v\n", err)
+	} else {
+		notifyInApp(sessionChangeNotice(kind, req.Reason, old, session, userIDs))
+	}
+
+	return c.JSON(http.StatusOK, session)
+}
+
+// sessionChangeNotice tells the group and the teachers involved about a
+// change to one lesson.
+func sessionChangeNotice(kind, reason string, old *sessionState, s *LessonSession, teacherUserIDs []int) inAppNotice {
+	n := inAppNotice{
+		Event:   "schedule_change",
+		GroupID: s.GroupID,
+		UserIDs: teacherUserIDs,
+		Data:    map[string]interface{}{"session_id": s.ID, "exception_type": kind, "subject_id": s.SubjectID, "group_id": s.GroupID},
+	}
+	switch kind {
+	case "cancel":
+		n.Title = s.SubjectName + " cancelled"
+		n.Body = fmt.Sprintf("%s on %s, %s is cancelled: %s", s.SubjectName, s.SessionDate, s.TimeSlot, reason)
+	case "restore":
+		n.Title = s.SubjectName + " takes place again"
+		n.Body = fmt.Sprintf("%s on %s, %s is no longer cancelled: %s", s.SubjectName, s.SessionDate, s.TimeSlot, reason)
+	case "move":
+		n.Title = s.SubjectName + " moved"
+		n.Body = fmt.Sprintf("%s moves from %s, %s (room %s) to %s, %s (room %s): %s", s.SubjectName,
+			old.Date, old.TimeSlot, old.RoomNumber, s.SessionDate, s.TimeSlot, s.RoomNumber, reason)
+	case "substitute":
+		n.Title = "Substitute teacher for " + s.SubjectName
+		n.Body = fmt.Sprintf("%s on %s, %s is taught by %s: %s", s.SubjectName, s.SessionDate, s.TimeSlot, s.TeacherName, reason)
+	}
+	return n
+}
+
+// applySessionMove fills in the new date, time slot and room of a moved
+// session from the request. Unset fields keep their current value.
+func applySessionMove(ctx context.Context, tx pgx.Tx, st *sessionState, req *SessionExceptionRequest) (string, error) {
+	if req.SessionDate != "" {
+		if _, err := parseDate(req.SessionDate); err != nil {
+			return "session_date must be YYYY-MM-DD", nil
+		}
+		var holiday string
+		err := tx.QueryRow(ctx, "SELECT name FROM holidays WHERE holiday_date = $1", req.SessionDate).Scan(&holiday)
+		if err == nil {
+			return fmt.Sprintf("%s is a holiday (%s)", req.SessionDate, holiday), nil
+		}
+		if err != pgx.ErrNoRows {
+			return "", err
+		}
+		st.Date = req.SessionDate
+	}
+	if req.TimeSlot != "" {
+		r, err := parseTimeSlot(req.TimeSlot)
+		if err != nil {
+			return "time_slot must look like 09:00-10:30 and end after it starts", nil
+		}
+		st.TimeSlot = r.String()
+	}
+	if req.RoomID > 0 {
+		var isActive bool
+		err := tx.QueryRow(ctx, "SELECT room_number, is_active FROM rooms WHERE id = $1", req.RoomID).Scan(&st.RoomNumber, &isActive)
+		if err == pgx.ErrNoRows {
+			return "Invalid room_id", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !isActive {
+			return "Room is not active", nil
+		}
+		st.RoomID = req.RoomID
+	} else if room := strings.TrimSpace(req.RoomNumber); room != "" {
+		id, number, err := matchRoomNumber(ctx, tx, room)
+		if err != nil {
+			return "", err
+		}
+		st.RoomID = id
+		st.RoomNumber = room
+		if id > 0 {
+			st.RoomNumber = number
+		}
+	}
+	return "", nil
+}
+
+const scheduleExceptionSelectQuery = `
+    SELECT e.id, e.session_id, ls.subject_id, sub.subject_name, ls.group_id, e.exception_type, e.reason,
+        e.old_date::text, e.old_time_slot, e.old_room_number, e.old_teacher_id,
+        e.new_date::text, e.new_time_slot, e.new_room_number, e.new_teacher_id, e.created_by, e.created_at
+    FROM schedule_exceptions e
+    JOIN lesson_sessions ls ON e.session_id = ls.id
+    JOIN subjects sub ON ls.subject_id = sub.id
+`
+
+func queryScheduleExceptions(ctx context.Context, query string, args ...interface{}) ([]ScheduleException, error) {
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []ScheduleException{}
+	for rows.Next() {
+		var e ScheduleException
+		err := rows.Scan(&e.ID, &e.SessionID, &e.SubjectID, &e.SubjectName, &e.GroupID, &e.ExceptionType, &e.Reason,
+			&e.OldDate, &e.OldTimeSlot, &e.OldRoomNumber, &e.OldTeacherID,
+			&e.NewDate, &e.NewTimeSlot, &e.NewRoomNumber, &e.NewTeacherID, &e.CreatedBy, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+	return exceptions, rows.Err()
+}
+
+func GetSessionExceptionsHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+	}
+
+	exceptions, err := queryScheduleExceptions(context.Background(), scheduleExceptionSelectQuery+` WHERE e.session_id = $1 ORDER BY e.created_at, e.id`, id)
+	if err != nil {
+		fmt.Printf("GetSessionExceptionsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, exceptions)
+}
+
+// GetScheduleExceptionsHandler lists exceptions whose session falls between
+// from and to (by original or new date), optionally for one group or teacher.
+func GetScheduleExceptionsHandler(c echo.Context) error {
+	filter, msg := parseSessionFilter(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+	if filter.GroupID > 0 {
+		where("ls.group_id = $%d", filter.GroupID)
+	}
+	if filter.SubjectID > 0 {
+		where("ls.subject_id = $%d", filter.SubjectID)
+	}
+	if filter.TeacherID > 0 {
+		where("(e.old_teacher_id = $%[1]d OR e.new_teacher_id = $%[1]d)", filter.TeacherID)
+	}
+	if filter.From != "" {
+		where("GREATEST(e.old_date, e.new_date) >= $%d", filter.From)
+	}
+	if filter.To != "" {
+		where("LEAST(e.old_date, e.new_date) <= $%d", filter.To)
+	}
+
+	query := scheduleExceptionSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY e.created_at DESC, e.id DESC LIMIT 200"
+
+	exceptions, err := queryScheduleExceptions(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("GetScheduleExceptionsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, exceptions)
+}
@@ -0,0 +1,483 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// LessonSession is one concrete occurrence of a weekly schedule entry.
+type LessonSession struct {
+	ID           int    `json:"id"`
+	ScheduleID   int    `json:"schedule_id"`
+	SessionDate  string `json:"session_date"`
+	OriginalDate string `json:"original_date"`
+	DayOfWeek    string `json:"day_of_week"`
+	SubjectID    int    `json:"subject_id"`
+	SubjectName  string `json:"subject_name"`
+	GroupID      int    `json:"group_id"`
+	GroupName    string `json:"group_name"`
+	TeacherID    int    `json:"teacher_id"`
+	TeacherName  string `json:"teacher_name"`
+	TimeSlot     string `json:"time_slot"`
+	RoomID       *int   `json:"room_id"`
+	RoomNumber   string `json:"room_number"`
+	Status       string `json:"status"`
+	// ExceptionType is the latest change made to this occurrence, if any.
+	ExceptionType *string `json:"exception_type,omitempty"`
+}
+
+type GenerateSessionsRequest struct {
+	Semester  string   `json:"semester"`
+	StartDate string   `json:"start_date"`
+	EndDate   string   `json:"end_date"`
+	Holidays  []string `json:"holidays"`
+	GroupID   int      `json:"group_id"`
+}
+
+type GenerateSessionsResult struct {
+	Created int `json:"created"`
+	// Updated counts existing sessions brought in line with an edited
+	// schedule entry.
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+	// Kept counts sessions that no longer match the schedule but already
+	// have attendance or exceptions recorded, so they were left in place.
+	Kept int `json:"kept"`
+}
+
+// SessionFilter narrows lesson session queries. Zero values mean "any".
+type SessionFilter struct {
+	GroupID   int
+	SubjectID int
+	TeacherID int
+	From      string
+	To        string
+	Status    string
+}
+
+const maxSessionRangeDays = 366
+
+func parseDate(s string) (time.Time, error) {
+	return time.Parse("2006-01-02", s)
+}
+
+// validateGenerateSessionsRequest defaults the date range to the whole
+// semester and checks it.
+func validateGenerateSessionsRequest(req *GenerateSessionsRequest, sem *Semester) (time.Time, time.Time, map[string]bool, string) {
+	if req.StartDate == "" {
+		req.StartDate = sem.StartDate
+	}
+	if req.EndDate == "" {
+		req.EndDate = sem.EndDate
+	}
+	from, err := parseDate(req.StartDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, "start_date must be YYYY-MM-DD"
+	}
+	to, err := parseDate(req.EndDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, nil, "end_date must be YYYY-MM-DD"
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, nil, "end_date must not be before start_date"
+	}
+	if to.Sub(from) > maxSessionRangeDays*24*time.Hour {
+		return time.Time{}, time.Time{}, nil, "date range must not exceed one year"
+	}
+	holidays := map[string]bool{}
+	for _, h := range req.Holidays {
+		if _, err := parseDate(h); err != nil {
+			return time.Time{}, time.Time{}, nil, "holidays must be YYYY-MM-DD dates"
+		}
+		holidays[h] = true
+	}
+	return from, to, holidays, ""
+}
+
+type sessionSource struct {
+	ScheduleID int
+	SubjectID  int
+	GroupID    int
+	TeacherID  int
+	DayOfWeek  string
+	TimeSlot   string
+	RoomID     *int
+	RoomNumber *string
+}
+
+// materializeSessions creates a lesson session for every date in [from, to]
+// on which a schedule entry of the semester takes place, skipping holidays,
+// and copies the entry's time slot, teacher and room onto sessions that
+// already exist and have neither exceptions nor attendance.
+// Sessions in the range that no longer match the schedule are removed unless
+// they have attendance or exceptions.
+func materializeSessions(ctx context.Context, tx pgx.Tx, semesterID, groupID int, from, to time.Time, holidays map[string]bool) (GenerateSessionsResult, error) {
+	var result GenerateSessionsResult
+
+	rows, err := tx.Query(ctx, `
+        SELECT id, subject_id, group_id, teacher_id, day_of_week, time_slot, room_id, room_number
+        FROM schedule
+        WHERE semester_id = $1 AND ($2 = 0 OR group_id = $2)
+    `, semesterID, groupID)
+	if err != nil {
+		return result, err
+	}
+	var sources []sessionSource
+	for rows.Next() {
+		var s sessionSource
+		if err := rows.Scan(&s.ScheduleID, &s.SubjectID, &s.GroupID, &s.TeacherID, &s.DayOfWeek, &s.TimeSlot, &s.RoomID, &s.RoomNumber); err != nil {
+			rows.Close()
+			return result, err
+		}
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	wanted := map[[2]string]bool{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		if holidays[date] {
+			continue
+		}
+		for _, s := range sources {
+			if s.DayOfWeek != d.Weekday().String() {
+				continue
+			}
+			wanted[[2]string{strconv.Itoa(s.ScheduleID), date}] = true
+			// Existing sessions follow edits to the schedule entry unless they
+			// were changed by hand or already have attendance.
+			var inserted bool
+			err := tx.QueryRow(ctx, `
+                INSERT INTO lesson_sessions (schedule_id, session_date, original_date, subject_id, group_id, teacher_id, time_slot, room_id, room_number)
+                VALUES ($1, $2, $2, $3, $4, $5, $6, $7, $8)
+                ON CONFLICT (schedule_id, original_date) DO UPDATE
+                SET subject_id = EXCLUDED.subject_id, group_id = EXCLUDED.group_id, teacher_id = EXCLUDED.teacher_id,
+                    time_slot = EXCLUDED.time_slot, room_id = EXCLUDED.room_id, room_number = EXCLUDED.room_number,
+                    updated_at = CURRENT_TIMESTAMP
+                WHERE NOT EXISTS (SELECT 1 FROM schedule_exceptions e WHERE e.session_id = lesson_sessions.id)
+                    AND NOT EXISTS (SELECT 1 FROM attendance a WHERE a.session_id = lesson_sessions.id)
+                    AND (lesson_sessions.subject_id, lesson_sessions.group_id, lesson_sessions.teacher_id, lesson_sessions.time_slot,
+                        lesson_sessions.room_id, lesson_sessions.room_number)
+                        IS DISTINCT FROM (EXCLUDED.subject_id, EXCLUDED.group_id, EXCLUDED.teacher_id, EXCLUDED.time_slot,
+                        EXCLUDED.room_id, EXCLUDED.room_number)
+                RETURNING xmax = 0
+            `, s.ScheduleID, date, s.SubjectID, s.GroupID, s.TeacherID, s.TimeSlot, s.RoomID, s.RoomNumber).Scan(&inserted)
+			if err == pgx.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return result, err
+			}
+			if inserted {
+				result.Created++
+			} else {
+				result.Updated++
+			}
+		}
+	}
+
+	rows, err = tx.Query(ctx, `
+        SELECT ls.id, ls.schedule_id, ls.original_date::text,
+            EXISTS (SELECT 1 FROM attendance a WHERE a.session_id = ls.id)
+                OR EXISTS (SELECT 1 FROM schedule_exceptions se WHERE se.session_id = ls.id)
+        FROM lesson_sessions ls
+        JOIN schedule s ON ls.schedule_id = s.id
+        WHERE s.semester_id = $1 AND ($2 = 0 OR s.group_id = $2) AND ls.original_date BETWEEN $3 AND $4
+    `, semesterID, groupID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return result, err
+	}
+	var stale []int
+	for rows.Next() {
+		var id, scheduleID int
+		var date string
+		var hasHistory bool
+		if err := rows.Scan(&id, &scheduleID, &date, &hasHistory); err != nil {
+			rows.Close()
+			return result, err
+		}
+		if wanted[[2]string{strconv.Itoa(scheduleID), date}] {
+			continue
+		}
+		if hasHistory {
+			result.Kept++
+			continue
+		}
+		stale = append(stale, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	if len(stale) > 0 {
+		tag, err := tx.Exec(ctx, "DELETE FROM lesson_sessions WHERE id = ANY($1)", stale)
+		if err != nil {
+			return result, err
+		}
+		result.Removed = int(tag.RowsAffected())
+	}
+
+	return result, nil
+}
+
+// GenerateSessionsHandler materializes lesson sessions from the weekly
+// schedule, by default over the whole current semester. Holidays and exam
+// periods from the academic calendar are skipped in addition to any extra
+// holidays in the request. It is safe to run repeatedly, e.g. after the
+// schedule changes.
+func GenerateSessionsHandler(c echo.Context) error {
+	var req GenerateSessionsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	sem, err := resolveSemester(ctx, tx, req.Semester)
+	if err == pgx.ErrNoRows {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	from, to, holidays, msg := validateGenerateSessionsRequest(&req, sem)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	calendarDays, err := nonTeachingDays(ctx, tx, from, to)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	for day := range calendarDays {
+		holidays[day] = true
+	}
+
+	if err := lockSchedule(ctx, tx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	result, err := materializeSessions(ctx, tx, sem.ID, req.GroupID, from, to, holidays)
+	if err != nil {
+		fmt.Printf("Failed to generate lesson sessions: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate lesson sessions"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate lesson sessions"})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+const sessionSelectQuery = `
+    SELECT ls.id, ls.schedule_id, ls.session_date::text, ls.original_date::text, to_char(ls.session_date, 'FMDay'), ls.subject_id, sub.subject_name,
+        ls.group_id, sg.group_name, ls.teacher_id, t.full_name, ls.time_slot, ls.room_id, COALESCE(ls.room_number, ''), ls.status,
+        (SELECT e.exception_type FROM schedule_exceptions e WHERE e.session_id = ls.id ORDER BY e.created_at DESC, e.id DESC LIMIT 1)
+    FROM lesson_sessions ls
+    JOIN subjects sub ON ls.subject_id = sub.id
+    JOIN student_groups sg ON ls.group_id = sg.id
+    JOIN teachers t ON ls.teacher_id = t.id
+`
+
+func scanLessonSession(row pgx.Row) (*LessonSession, error) {
+	s := &LessonSession{}
+	err := row.Scan(&s.ID, &s.ScheduleID, &s.SessionDate, &s.OriginalDate, &s.DayOfWeek, &s.SubjectID, &s.SubjectName,
+		&s.GroupID, &s.GroupName, &s.TeacherID, &s.TeacherName, &s.TimeSlot, &s.RoomID, &s.RoomNumber, &s.Status, &s.ExceptionType)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func getLessonSessionById(ctx context.Context, id int) (*LessonSession, error) {
+	return scanLessonSession(pool.QueryRow(ctx, sessionSelectQuery+` WHERE ls.id = $1`, id))
+}
+
+func getLessonSessions(ctx context.Context, filter SessionFilter) ([]LessonSession, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+	if filter.GroupID > 0 {
+		where("ls.group_id = $%d", filter.GroupID)
+	}
+	if filter.SubjectID > 0 {
+		where("ls.subject_id = $%d", filter.SubjectID)
+	}
+	if filter.TeacherID > 0 {
+		where("ls.teacher_id = $%d", filter.TeacherID)
+	}
+	if filter.From != "" {
+		where("ls.session_date >= $%d", filter.From)
+	}
+	if filter.To != "" {
+		where("ls.session_date <= $%d", filter.To)
+	}
+	if filter.Status != "" {
+		where("ls.status = $%d", filter.Status)
+	}
+
+	query := sessionSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY ls.session_date, ls.time_slot, ls.id"
+
+	rows, err := pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []LessonSession{}
+	for rows.Next() {
+		s, err := scanLessonSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func parseSessionFilter(c echo.Context) (SessionFilter, string) {
+	var filter SessionFilter
+	var err error
+	if v := c.QueryParam("group_id"); v != "" {
+		if filter.GroupID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid group_id"
+		}
+	}
+	if v := c.QueryParam("subject_id"); v != "" {
+		if filter.SubjectID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid subject_id"
+		}
+	}
+	if v := c.QueryParam("teacher_id"); v != "" {
+		if filter.TeacherID, err = strconv.Atoi(v); err != nil {
+			return filter, "Invalid teacher_id"
+		}
+	}
+	if v := c.QueryParam("from"); v != "" {
+		if _, err := parseDate(v); err != nil {
+			return filter, "from must be YYYY-MM-DD"
+		}
+		filter.From = v
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if _, err := parseDate(v); err != nil {
+			return filter, "to must be YYYY-MM-DD"
+		}
+		filter.To = v
+	}
+	filter.Status = c.QueryParam("status")
+	return filter, ""
+}
+
+func GetLessonSessionsHandler(c echo.Context) error {
+	filter, msg := parseSessionFilter(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	sessions, err := getLessonSessions(context.Background(), filter)
+	if err != nil {
+		fmt.Printf("GetLessonSessionsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func GetLessonSessionHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid session ID"})
+	}
+
+	session, err := getLessonSessionById(context.Background(), id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Lesson session not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	return c.JSON(http.StatusOK, session)
+}
+
+// resolveAttendanceSession ties an attendance mark to the lesson session it
+// belongs to. The session is either given explicitly or looked up by the
+// subject and visit day among the sessions of the student's group. A
+// non-empty message means the mark does not correspond to a real lesson.
+func resolveAttendanceSession(ctx context.Context, attendance *Attendance) (string, error) {
+	var groupID *int
+	err := pool.QueryRow(ctx, "SELECT group_id FROM students WHERE id = $1 AND deleted_at IS NULL", attendance.StudentId).Scan(&groupID)
+	if err == pgx.ErrNoRows {
+		return "Student not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if groupID == nil {
+		return "Student is not assigned to a group", nil
+	}
+
+	if attendance.SessionID != nil {
+		var subjectID, sessionGroupID int
+		var date, status string
+		err := pool.QueryRow(ctx, "SELECT subject_id, group_id, session_date::text, status FROM lesson_sessions WHERE id = $1", *attendance.SessionID).
+			Scan(&subjectID, &sessionGroupID, &date, &status)
+		if err == pgx.ErrNoRows {
+			return "Lesson session not found", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if subjectID != attendance.SubjectID || sessionGroupID != *groupID {
+			return "Lesson session does not belong to this subject and the student's group", nil
+		}
+		if attendance.VisitDay != "" && attendance.VisitDay != date {
+			return "visit_day does not match the lesson session date", nil
+		}
+		if status != "scheduled" {
+			return "Lesson session was cancelled", nil
+		}
+		attendance.VisitDay = date
+		return "", nil
+	}
+
+	var sessionID int
+	err = pool.QueryRow(ctx, `
+        SELECT id FROM lesson_sessions
+        WHERE subject_id = $1 AND group_id = $2 AND session_date = $3 AND status = 'scheduled'
+        ORDER BY time_slot, id
+        LIMIT 1
+    `, attendance.SubjectID, *groupID, attendance.VisitDay).Scan(&sessionID)
+	if err == pgx.ErrNoRows {
+		return "No lesson of this subject is scheduled for the student's group on visit_day", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	attendance.SessionID = &sessionID
+	return "", nil
+}
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const studentSelectQuery = `
+    SELECT s.id, s.full_name, COALESCE(s.gender, ''), s.birth_date::text, COALESCE(s.group_id, 0), COALESCE(sg.group_name, ''),
+        COALESCE(s.email, ''), COALESCE(s.phone, ''), COALESCE(s.student_id_number, ''),
+        COALESCE(s.enrollment_date::text, ''), COALESCE(s.status, 'Active'), s.deleted_at
+    FROM students s
+    LEFT JOIN student_groups sg ON s.group_id = sg.id
+`
+
+func scanStudent(row pgx.Row) (*Student, error) {
+	student := &Student{}
+	err := row.Scan(&student.ID, &student.FullName, &student.Gender, &student.BirthDate, &student.GroupID, &student.GroupName,
+		&student.Email, &student.Phone, &student.StudentIDNumber, &student.EnrollmentDate, &student.Status, &student.DeletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return student, nil
+}
+
+// studentStatusTransitions lists which statuses a student may move to from
+// each status. Graduated is terminal.
+var studentStatusTransitions = map[string][]string{
+	"Active":    {"Suspended", "Inactive", "Graduated"},
+	"Suspended": {"Active", "Inactive"},
+	"Inactive":  {"Active"},
+	"Graduated": {},
+}
+
+func validateStudentStatusTransition(from, to, reason string) string {
+	if _, ok := studentStatusTransitions[to]; !ok {
+		return "status must be one of Active, Suspended, Inactive, Graduated"
+	}
+	for _, next := range studentStatusTransitions[from] {
+		if next == to {
+			if (to == "Suspended" || to == "Inactive") && strings.TrimSpace(reason) == "" {
+				return "A reason is required to set status " + to
+			}
+			return ""
+		}
+	}
+	return fmt.Sprintf("Cannot change status from %s to %s", from, to)
+}
+
+type UpdateStudentRequest struct {
+	FullName        string `json:"full_name"`
+	Gender          string `json:"gender"`
+	BirthDate       string `json:"birth_date"`
+	GroupID         int    `json:"group_id"`
+	Email           string `json:"email"`
+	Phone           string `json:"phone"`
+	StudentIDNumber string `json:"student_id_number"`
+	EnrollmentDate  string `json:"enrollment_date"`
+}
+
+// RestoreStudentRequest optionally puts the restored student into a group.
+// It is required when the student's group was deleted in the meantime.
+type RestoreStudentRequest struct {
+	GroupID *int `json:"group_id"`
+}
+
+type PatchStudentRequest struct {
+	FullName        *string `json:"full_name"`
+	Gender          *string `json:"gender"`
+	BirthDate       *string `json:"birth_date"`
+	GroupID         *int    `json:"group_id"`
+	Email           *string `json:"email"`
+	Phone           *string `json:"phone"`
+	StudentIDNumber *string `json:"student_id_number"`
+	EnrollmentDate  *string `json:"enrollment_date"`
+	Status          *string `json:"status"`
+	Reason          string  `json:"reason"`
+}
+
+type StatusHistoryEntry struct {
+	ID         int       `json:"id"`
+	StudentID  int       `json:"student_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Reason     string    `json:"reason"`
+	ChangedBy  *int      `json:"changed_by"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// UpdateStudentHandler replaces a student's profile. Status is not part of
+// the profile and can only be changed through PATCH with a reason.
+func UpdateStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	var req UpdateStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if req.FullName == "" || req.Gender == "" || req.BirthDate == "" || req.GroupID <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing required fields: full_name, gender, birth_date, group_id"})
+	}
+
+	patch := PatchStudentRequest{
+		FullName:        &req.FullName,
+		Gender:          &req.Gender,
+		BirthDate:       &req.BirthDate,
+		GroupID:         &req.GroupID,
+		Email:           &req.Email,
+		Phone:           &req.Phone,
+		StudentIDNumber: &req.StudentIDNumber,
+	}
+	if req.EnrollmentDate != "" {
+		patch.EnrollmentDate = &req.EnrollmentDate
+	}
+
+	return applyStudentPatch(c, id, &patch)
+}
+
+func PatchStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	var req PatchStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	return applyStudentPatch(c, id, &req)
+}
+
+func applyStudentPatch(c echo.Context, id int, req *PatchStudentRequest) error {
+	userID := c.Get("user_id").(int)
+	ctx := context.Background()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var currentStatus string
+	var currentGroupID *int
+	var deletedAt *time.Time
+	err = tx.QueryRow(ctx, "SELECT COALESCE(status, 'Active'), group_id, deleted_at FROM students WHERE id = $1 FOR UPDATE", id).
+		Scan(&currentStatus, &currentGroupID, &deletedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if deletedAt != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Student is deleted. Restore it first"})
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(expr string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf(expr, len(args)))
+	}
+
+	if req.FullName != nil {
+		if strings.TrimSpace(*req.FullName) == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "full_name cannot be empty"})
+		}
+		set("full_name = $%d", strings.TrimSpace(*req.FullName))
+	}
+	if req.Gender != nil {
+		set("gender = $%d", *req.Gender)
+	}
+	if req.BirthDate != nil {
+		set("birth_date = $%d", *req.BirthDate)
+	}
+	if req.GroupID != nil {
+		set("group_id = $%d", *req.GroupID)
+	}
+	if req.Email != nil {
+		if *req.Email != "" && !ValidateEmail(*req.Email) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid email format"})
+		}
+		set("email = NULLIF($%d, '')", *req.Email)
+	}
+	if req.Phone != nil {
+		set("phone = NULLIF($%d, '')", *req.Phone)
+	}
+	if req.StudentIDNumber != nil {
+		set("student_id_number = NULLIF($%d, '')", *req.StudentIDNumber)
+	}
+	if req.EnrollmentDate != nil {
+		set("enrollment_date = $%d", *req.EnrollmentDate)
+	}
+
+	statusChanged := req.Status != nil && *req.Status != currentStatus
+	if statusChanged {
+		if msg := validateStudentStatusTransition(currentStatus, *req.Status, req.Reason); msg != "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+		}
+		set("status = $%d", *req.Status)
+	}
+
+	if len(sets) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Nothing to update"})
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE students SET %s, updated_at = CURRENT_TIMESTAMP WHERE id = $%d", strings.Join(sets, ", "), len(args))
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return studentWriteError(c, err)
+	}
+
+	if statusChanged {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO student_status_history (student_id, from_status, to_status, reason, changed_by)
+            VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+        `, id, currentStatus, *req.Status, req.Reason, userID)
+		if err != nil {
+			fmt.Printf("Failed to record status history: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update student"})
+		}
+	}
+
+	if req.GroupID != nil && (currentGroupID == nil || *req.GroupID != *currentGroupID) {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO student_group_history (student_id, from_group_id, to_group_id, reason, moved_by)
+            VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+        `, id, currentGroupID, *req.GroupID, req.Reason, userID)
+		if err != nil {
+			fmt.Printf("Failed to record group history: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update student"})
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update student"})
+	}
+
+	student, err := getStudentById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Student updated but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, student)
+}
+
+func studentWriteError(c echo.Context, err error) error {
+	if isUniqueViolation(err) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Email or student ID number is already taken"})
+	}
+	if isForeignKeyViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_id. Please select a valid group"})
+	}
+	if isCheckViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid gender or status value"})
+	}
+	if strings.Contains(err.Error(), "invalid input syntax for type date") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid date format, expected YYYY-MM-DD"})
+	}
+	fmt.Printf("Failed to update student: %v\n", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update student"})
+}
+
+// DeleteStudentHandler soft-deletes a student: the row is hidden from lists
+// and rosters but attendance and grades history is kept.
+func DeleteStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(),
+		"UPDATE students SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		fmt.Printf("Failed to delete student: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete student"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RestoreStudentHandler undoes a soft delete. A student whose group was
+// deleted meanwhile must be given a new group_id.
+func RestoreStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+	var req RestoreStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var currentGroupID *int
+	err = tx.QueryRow(ctx, "SELECT group_id FROM students WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE", id).Scan(&currentGroupID)
+	if err == pgx.ErrNoRows {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Deleted student not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	groupID := currentGroupID
+	if req.GroupID != nil {
+		groupID = req.GroupID
+	}
+	if groupID == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The student's group was deleted; pass group_id"})
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE students SET deleted_at = NULL, group_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", *groupID, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_id"})
+		}
+		fmt.Printf("Failed to restore student: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restore student"})
+	}
+	if currentGroupID == nil || *currentGroupID != *groupID {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO student_group_history (student_id, from_group_id, to_group_id, reason, moved_by)
+            VALUES ($1, $2, $3, 'Restored', $4)
+        `, id, currentGroupID, *groupID, c.Get("user_id").(int))
+		if err != nil {
+			fmt.Printf("Failed to record group history: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restore student"})
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restore student"})
+	}
+
+	student, err := getStudentById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Student restored but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, student)
+}
+
+func GetStudentStatusHistoryHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	query := `
+        SELECT id, student_id, from_status, to_status, COALESCE(reason, ''), changed_by, changed_at
+        FROM student_status_history
+        WHERE student_id = $1
+        ORDER BY changed_at DESC
+    `
+	rows, err := pool.Query(context.Background(), query, id)
+	if err != nil {
+		fmt.Printf("GetStudentStatusHistoryHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	history := []StatusHistoryEntry{}
+	for rows.Next() {
+		var entry StatusHistoryEntry
+		err := rows.Scan(&entry.ID, &entry.StudentID, &entry.FromStatus, &entry.ToStatus, &entry.Reason, &entry.ChangedBy, &entry.ChangedAt)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		history = append(history, entry)
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
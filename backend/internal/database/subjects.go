@@ -0,0 +1,511 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+type Subject struct {
+	ID            int            `json:"id"`
+	SubjectName   string         `json:"subject_name"`
+	SubjectCode   string         `json:"subject_code"`
+	Credits       int            `json:"credits"`
+	Description   string         `json:"description"`
+	FacultyID     int            `json:"faculty_id"`
+	FacultyName   string         `json:"faculty_name"`
+	Prerequisites []Prerequisite `json:"prerequisites,omitempty"`
+}
+
+type SubjectRequest struct {
+	SubjectName string `json:"subject_name"`
+	SubjectCode string `json:"subject_code"`
+	Credits     int    `json:"credits"`
+	Description string `json:"description"`
+	FacultyID   int    `json:"faculty_id"`
+}
+
+type Prerequisite struct {
+	SubjectID   int     `json:"subject_id"`
+	SubjectName string  `json:"subject_name"`
+	SubjectCode string  `json:"subject_code"`
+	MinGrade    float64 `json:"min_grade"`
+}
+
+type PrerequisiteRequest struct {
+	PrerequisiteID int      `json:"prerequisite_id"`
+	MinGrade       *float64 `json:"min_grade"`
+}
+
+type PrerequisiteCheck struct {
+	Prerequisite
+	Grade     *float64 `json:"grade"`
+	Satisfied bool     `json:"satisfied"`
+}
+
+type EligibilityResponse struct {
+	StudentID     int                 `json:"student_id"`
+	SubjectID     int                 `json:"subject_id"`
+	Eligible      bool                `json:"eligible"`
+	Prerequisites []PrerequisiteCheck `json:"prerequisites"`
+}
+
+func validateSubjectRequest(req *SubjectRequest) string {
+	req.SubjectName = strings.TrimSpace(req.SubjectName)
+	req.SubjectCode = strings.ToUpper(strings.TrimSpace(req.SubjectCode))
+	if req.SubjectName == "" || req.SubjectCode == "" {
+		return "subject_name and subject_code are required"
+	}
+	if len(req.SubjectCode) > 50 {
+		return "subject_code is too long"
+	}
+	if req.Credits == 0 {
+		req.Credits = 3
+	}
+	if req.Credits < 1 || req.Credits > 30 {
+		return "credits must be between 1 and 30"
+	}
+	if req.FacultyID <= 0 {
+		return "faculty_id is required"
+	}
+	return ""
+}
+
+const subjectSelectQuery = `
+    SELECT s.id, s.subject_name, s.subject_code, s.credits, COALESCE(s.description, ''), s.faculty_id, COALESCE(f.faculty_name, '')
+    FROM subjects s
+    LEFT JOIN faculties f ON s.faculty_id = f.id
+`
+
+func scanSubject(row pgx.Row) (*Subject, error) {
+	subject := &Subject{}
+	err := row.Scan(&subject.ID, &subject.SubjectName, &subject.SubjectCode, &subject.Credits, &subject.Description, &subject.FacultyID, &subject.FacultyName)
+	if err != nil {
+		return nil, err
+	}
+	return subject, nil
+}
+
+func getSubjectById(pool *pgxpool.Pool, id int) (*Subject, error) {
+	subject, err := scanSubject(pool.QueryRow(context.Background(), subjectSelectQuery+` WHERE s.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	subject.Prerequisites, err = getPrerequisites(pool, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return subject, nil
+}
+
+func GetAllSubjectsHandler(c echo.Context) error {
+	query := subjectSelectQuery
+	var args []interface{}
+	if facultyID := c.QueryParam("faculty_id"); facultyID != "" {
+		id, err := strconv.Atoi(facultyID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid faculty ID"})
+		}
+		query += ` WHERE s.faculty_id = $1`
+		args = append(args, id)
+	}
+
+	rows, err := pool.Query(context.Background(), query+` ORDER BY s.subject_name`, args...)
+	if err != nil {
+		fmt.Printf("Failed to get subjects: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch subjects"})
+	}
+	defer rows.Close()
+
+	subjects := []Subject{}
+	for rows.Next() {
+		subject, err := scanSubject(rows)
+		if err != nil {
+			fmt.Printf("Failed to scan subject: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch subjects"})
+		}
+		subjects = append(subjects, *subject)
+	}
+
+	return c.JSON(http.StatusOK, subjects)
+}
+
+func GetSubjectHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+
+	subject, err := getSubjectById(pool, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Subject not found"})
+		}
+		fmt.Printf("GetSubjectHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, subject)
+}
+
+func CreateSubjectHandler(c echo.Context) error {
+	var req SubjectRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateSubjectRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	var id int
+	query := `
+        INSERT INTO subjects (subject_name, subject_code, credits, description, faculty_id)
+        VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+        RETURNING id
+    `
+	err := pool.QueryRow(context.Background(), query, req.SubjectName, req.SubjectCode, req.Credits, req.Description, req.FacultyID).Scan(&id)
+	if err != nil {
+		return subjectWriteError(c, err)
+	}
+
+	subject, err := getSubjectById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Subject created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, subject)
+}
+
+func UpdateSubjectHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+
+	var req SubjectRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateSubjectRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	query := `
+        UPDATE subjects
+        SET subject_name = $1, subject_code = $2, credits = $3, description = NULLIF($4, ''), faculty_id = $5, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $6
+    `
+	tag, err := pool.Exec(context.Background(), query, req.SubjectName, req.SubjectCode, req.Credits, req.Description, req.FacultyID, id)
+	if err != nil {
+		return subjectWriteError(c, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Subject not found"})
+	}
+
+	subject, err := getSubjectById(pool, id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Subject updated but failed to load it"})
+	}
+
+	return c.JSON(http.StatusOK, subject)
+}
+
+func subjectWriteError(c echo.Context, err error) error {
+	if isUniqueViolation(err) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "A subject with this code already exists"})
+	}
+	if isForeignKeyViolation(err) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid faculty_id"})
+	}
+	fmt.Printf("Failed to save subject: %v\n", err)
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save subject"})
+}
+
+// DeleteSubjectHandler refuses to remove subjects that are still scheduled or
+// have attendance or grades, because those rows would be cascaded away.
+func DeleteSubjectHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+
+	var scheduleCount, attendanceCount, gradeCount int
+	query := `
+        SELECT
+            (SELECT COUNT(*) FROM schedule WHERE subject_id = $1),
+            (SELECT COUNT(*) FROM attendance WHERE subject_id = $1),
+            (SELECT COUNT(*) FROM grades WHERE subject_id = $1)
+    `
+	err = pool.QueryRow(context.Background(), query, id).Scan(&scheduleCount, &attendanceCount, &gradeCount)
+	if err != nil {
+		fmt.Printf("DeleteSubjectHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if scheduleCount+attendanceCount+gradeCount > 0 {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":            "Subject is still in use",
+			"schedule_count":   scheduleCount,
+			"attendance_count": attendanceCount,
+			"grade_count":      gradeCount,
+		})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM subjects WHERE id = $1", id)
+	if err != nil {
+		fmt.Printf("Failed to delete subject: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete subject"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Subject not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func getPrerequisites(pool *pgxpool.Pool, subjectID int) ([]Prerequisite, error) {
+	query := `
+        SELECT p.prerequisite_id, s.subject_name, s.subject_code, p.min_grade::float8
+        FROM subject_prerequisites p
+        JOIN subjects s ON p.prerequisite_id = s.id
+        WHERE p.subject_id = $1
+        ORDER BY s.subject_code
+    `
+	rows, err := pool.Query(context.Background(), query, subjectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prerequisites := []Prerequisite{}
+	for rows.Next() {
+		var p Prerequisite
+		if err := rows.Scan(&p.SubjectID, &p.SubjectName, &p.SubjectCode, &p.MinGrade); err != nil {
+			return nil, err
+		}
+		prerequisites = append(prerequisites, p)
+	}
+
+	return prerequisites, rows.Err()
+}
+
+func GetPrerequisitesHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+
+	prerequisites, err := getPrerequisites(pool, id)
+	if err != nil {
+		fmt.Printf("GetPrerequisitesHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, prerequisites)
+}
+
+// findPrerequisitePath searches the prerequisite graph (subject -> its
+// prerequisites) for a path from start to target and returns it, or nil.
+func findPrerequisitePath(graph map[int][]int, start, target int) []int {
+	visited := map[int]bool{}
+	var path []int
+
+	var visit func(node int) bool
+	visit = func(node int) bool {
+		path = append(path, node)
+		if node == target {
+			return true
+		}
+		visited[node] = true
+		for _, next := range graph[node] {
+			if !visited[next] && visit(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	if visit(start) {
+		return path
+	}
+	return nil
+}
+
+func AddPrerequisiteHandler(c echo.Context) error {
+	subjectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+
+	var req PrerequisiteRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.PrerequisiteID <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "prerequisite_id is required"})
+	}
+	if req.PrerequisiteID == subjectID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "A subject cannot be its own prerequisite"})
+	}
+	minGrade := 50.0
+	if req.MinGrade != nil {
+		minGrade = *req.MinGrade
+	}
+	if minGrade < 0 || minGrade > 100 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "min_grade must be between 0 and 100"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize graph edits so two concurrent inserts cannot close a cycle.
+	if _, err := tx.Exec(ctx, "LOCK TABLE subject_prerequisites IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	rows, err := tx.Query(ctx, "SELECT subject_id, prerequisite_id FROM subject_prerequisites")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	graph := map[int][]int{}
+	for rows.Next() {
+		var from, to int
+		if err := rows.Scan(&from, &to); err != nil {
+			rows.Close()
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		graph[from] = append(graph[from], to)
+	}
+	rows.Close()
+
+	if path := findPrerequisitePath(graph, req.PrerequisiteID, subjectID); path != nil {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error": "Adding this prerequisite would create a cycle",
+			"cycle": append([]int{subjectID}, path...),
+		})
+	}
+
+	query := `
+        INSERT INTO subject_prerequisites (subject_id, prerequisite_id, min_grade)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (subject_id, prerequisite_id) DO UPDATE SET min_grade = EXCLUDED.min_grade
+    `
+	if _, err := tx.Exec(ctx, query, subjectID, req.PrerequisiteID, minGrade); err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Subject not found"})
+		}
+		fmt.Printf("Failed to add prerequisite: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add prerequisite"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add prerequisite"})
+	}
+
+	prerequisites, err := getPrerequisites(pool, subjectID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusCreated, prerequisites)
+}
+
+func DeletePrerequisiteHandler(c echo.Context) error {
+	subjectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+	prerequisiteID, err := strconv.Atoi(c.Param("prerequisiteId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid prerequisite ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM subject_prerequisites WHERE subject_id = $1 AND prerequisite_id = $2", subjectID, prerequisiteID)
+	if err != nil {
+		fmt.Printf("Failed to delete prerequisite: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete prerequisite"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Prerequisite not found"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// CheckEligibilityHandler tells whether a student has passed every
+// prerequisite of a subject. A prerequisite counts as passed when the
+// weighted percentage of the student's grades in it reaches min_grade.
+func CheckEligibilityHandler(c echo.Context) error {
+	subjectID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid subject ID"})
+	}
+	studentID, err := strconv.Atoi(c.Param("studentId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid student ID"})
+	}
+
+	allowed, err := canViewStudent(c, studentID)
+	if err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: unable to verify student"})
+	}
+	if !allowed {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Access denied: you can only view your own eligibility"})
+	}
+
+	if _, err := getSubjectById(pool, subjectID); err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Subject not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	query := `
+        SELECT p.prerequisite_id, s.subject_name, s.subject_code, p.min_grade::float8,
+            (SELECT (SUM(g.grade_value / g.max_grade * 100 * COALESCE(g.weight, 100)) / NULLIF(SUM(COALESCE(g.weight, 100)), 0))::float8
+             FROM grades g
+             WHERE g.student_id = $2 AND g.subject_id = p.prerequisite_id)
+        FROM subject_prerequisites p
+        JOIN subjects s ON p.prerequisite_id = s.id
+        WHERE p.subject_id = $1
+        ORDER BY s.subject_code
+    `
+	rows, err := pool.Query(context.Background(), query, subjectID, studentID)
+	if err != nil {
+		fmt.Printf("CheckEligibilityHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	response := EligibilityResponse{StudentID: studentID, SubjectID: subjectID, Eligible: true, Prerequisites: []PrerequisiteCheck{}}
+	for rows.Next() {
+		var check PrerequisiteCheck
+		err := rows.Scan(&check.SubjectID, &check.SubjectName, &check.SubjectCode, &check.MinGrade, &check.Grade)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		check.Satisfied = check.Grade != nil && *check.Grade >= check.MinGrade
+		if !check.Satisfied {
+			response.Eligible = false
+		}
+		response.Prerequisites = append(response.Prerequisites, check)
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
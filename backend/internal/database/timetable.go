@@ -0,0 +1,420 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	defaultTimetableDays  = []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"}
+	defaultTimetableSlots = []string{"09:00-10:30", "10:45-12:15", "13:00-14:30", "14:45-16:15", "16:30-18:00"}
+)
+
+type GenerateTimetableRequest struct {
+	Semester            string                `json:"semester"`
+	AcademicYear        string                `json:"academic_year"`
+	Days                []string              `json:"days"`
+	TimeSlots           []string              `json:"time_slots"`
+	LateAfter           string                `json:"late_after"`
+	KeepExisting        *bool                 `json:"keep_existing"`
+	Requirements        []SessionRequirement  `json:"requirements"`
+	Rooms               []RoomSpec            `json:"rooms"`
+	TeacherAvailability []TeacherAvailability `json:"teacher_availability"`
+}
+
+type TimetableDraft struct {
+	ID           int                  `json:"id"`
+	Semester     string               `json:"semester"`
+	AcademicYear string               `json:"academic_year"`
+	Status       string               `json:"status"`
+	Complete     bool                 `json:"complete"`
+	Score        TimetableScore       `json:"score"`
+	Unplaced     []SessionRequirement `json:"unplaced"`
+	Entries      []TimetableEntry     `json:"entries,omitempty"`
+	CreatedBy    *int                 `json:"created_by"`
+	CreatedAt    time.Time            `json:"created_at"`
+	CommittedAt  *time.Time           `json:"committed_at"`
+}
+
+func validateGenerateTimetableRequest(req *GenerateTimetableRequest) string {
+	if req.Semester != "" && req.Semester != currentSemesterName && !semesterRegex.MatchString(req.Semester) {
+		return "semester must look like Spring 2026"
+	}
+	if req.AcademicYear != "" && !validateAcademicYear(req.AcademicYear) {
+		return "academic_year must look like 2025-2026"
+	}
+	if len(req.Days) == 0 {
+		req.Days = defaultTimetableDays
+	}
+	for _, day := range req.Days {
+		if !isWeekday(day) {
+			return "days must be full weekday names, e.g. Monday"
+		}
+	}
+	if len(req.TimeSlots) == 0 {
+		req.TimeSlots = defaultTimetableSlots
+	}
+	if len(req.Requirements) == 0 {
+		return "requirements are required"
+	}
+	for _, r := range req.Requirements {
+		if r.GroupID <= 0 || r.SubjectID <= 0 || r.TeacherID <= 0 {
+			return "each requirement needs group_id, subject_id and teacher_id"
+		}
+		if r.SessionsPerWeek < 1 || r.SessionsPerWeek > 10 {
+			return "sessions_per_week must be between 1 and 10"
+		}
+	}
+	for _, room := range req.Rooms {
+		if room.RoomNumber == "" || room.Capacity <= 0 {
+			return "each room needs room_number and a positive capacity"
+		}
+	}
+	return ""
+}
+
+// GenerateTimetableHandler runs the timetable solver and stores the result as
+// a draft that can be reviewed before it is committed into schedule.
+func GenerateTimetableHandler(c echo.Context) error {
+	var req GenerateTimetableRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if msg := validateGenerateTimetableRequest(&req); msg != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": msg})
+	}
+
+	lateAfter := 0
+	if req.LateAfter != "" {
+		minutes, err := parseClock(req.LateAfter)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "late_after must look like 16:00"})
+		}
+		lateAfter = minutes
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	sem, err := resolveSemester(ctx, tx, req.Semester)
+	if err == pgx.ErrNoRows {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown semester. Add it to the academic calendar first"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if req.AcademicYear != "" && req.AcademicYear != sem.AcademicYear {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("%s belongs to academic year %s", sem.Name, sem.AcademicYear)})
+	}
+	req.Semester = sem.Name
+	req.AcademicYear = sem.AcademicYear
+
+	for i, r := range req.Requirements {
+		if r.GroupSize > 0 {
+			continue
+		}
+		err := tx.QueryRow(ctx, "SELECT COUNT(*) FROM students WHERE group_id = $1 AND deleted_at IS NULL", r.GroupID).Scan(&req.Requirements[i].GroupSize)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+	}
+
+	if len(req.Rooms) == 0 {
+		rows, err := tx.Query(ctx, "SELECT id, room_number, capacity FROM rooms WHERE is_active ORDER BY capacity, id")
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		for rows.Next() {
+			var room RoomSpec
+			if err := rows.Scan(&room.RoomID, &room.RoomNumber, &room.Capacity); err != nil {
+				rows.Close()
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+			req.Rooms = append(req.Rooms, room)
+		}
+		rows.Close()
+	}
+
+	solver, err := newTimetableSolver(req.Days, req.TimeSlots, req.Rooms, req.Requirements, req.TeacherAvailability, lateAfter)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if req.KeepExisting == nil || *req.KeepExisting {
+		existing, _, err := loadScheduleSlots(ctx, tx, req.Semester, "")
+		if err != nil {
+			fmt.Printf("GenerateTimetableHandler error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		for _, slot := range existing {
+			solver.blockExisting(slot)
+		}
+	}
+
+	result := solver.Solve()
+
+	scoreJSON, _ := json.Marshal(result.Score)
+	unplacedJSON, _ := json.Marshal(result.Unplaced)
+	requestJSON, _ := json.Marshal(req)
+
+	var draftID int
+	query := `
+        INSERT INTO timetable_drafts (semester_id, academic_year, complete, score, unplaced, request, created_by)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id
+    `
+	err = tx.QueryRow(ctx, query, sem.ID, req.AcademicYear, result.Complete, scoreJSON, unplacedJSON, requestJSON, c.Get("user_id").(int)).Scan(&draftID)
+	if err != nil {
+		fmt.Printf("Failed to save timetable draft: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save timetable draft"})
+	}
+
+	for _, e := range result.Entries {
+		_, err := tx.Exec(ctx, `
+            INSERT INTO timetable_draft_entries (draft_id, group_id, subject_id, teacher_id, day_of_week, time_slot, room_id, room_number)
+            VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''))
+        `, draftID, e.GroupID, e.SubjectID, e.TeacherID, e.DayOfWeek, e.TimeSlot, e.RoomID, e.RoomNumber)
+		if err != nil {
+			if isForeignKeyViolation(err) {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_id, subject_id or teacher_id in requirements"})
+			}
+			fmt.Printf("Failed to save timetable draft entry: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save timetable draft"})
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save timetable draft"})
+	}
+
+	draft, err := getTimetableDraft(ctx, draftID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Draft created but failed to load it"})
+	}
+
+	return c.JSON(http.StatusCreated, draft)
+}
+
+const timetableDraftSelectQuery = `
+    SELECT d.id, sem.name, d.academic_year, d.status, d.complete, d.score, d.unplaced, d.created_by, d.created_at, d.committed_at
+    FROM timetable_drafts d
+    JOIN semesters sem ON d.semester_id = sem.id
+`
+
+func scanTimetableDraft(row pgx.Row) (*TimetableDraft, error) {
+	draft := &TimetableDraft{}
+	var scoreJSON, unplacedJSON []byte
+	err := row.Scan(&draft.ID, &draft.Semester, &draft.AcademicYear, &draft.Status, &draft.Complete, &scoreJSON, &unplacedJSON,
+		&draft.CreatedBy, &draft.CreatedAt, &draft.CommittedAt)
+	if err != nil {
+		return nil, err
+	}
+	if len(scoreJSON) > 0 {
+		json.Unmarshal(scoreJSON, &draft.Score)
+	}
+	if len(unplacedJSON) > 0 {
+		json.Unmarshal(unplacedJSON, &draft.Unplaced)
+	}
+	return draft, nil
+}
+
+func getTimetableDraft(ctx context.Context, id int) (*TimetableDraft, error) {
+	draft, err := scanTimetableDraft(pool.QueryRow(ctx, timetableDraftSelectQuery+` WHERE d.id = $1`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        SELECT group_id, subject_id, teacher_id, day_of_week, time_slot, COALESCE(room_id, 0), COALESCE(room_number, '')
+        FROM timetable_draft_entries
+        WHERE draft_id = $1
+        ORDER BY array_position(ARRAY['Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday', 'Sunday']::varchar[], day_of_week),
+            time_slot, group_id
+    `
+	rows, err := pool.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	draft.Entries = []TimetableEntry{}
+	for rows.Next() {
+		var e TimetableEntry
+		if err := rows.Scan(&e.GroupID, &e.SubjectID, &e.TeacherID, &e.DayOfWeek, &e.TimeSlot, &e.RoomID, &e.RoomNumber); err != nil {
+			return nil, err
+		}
+		draft.Entries = append(draft.Entries, e)
+	}
+
+	return draft, rows.Err()
+}
+
+func GetTimetableDraftsHandler(c echo.Context) error {
+	rows, err := pool.Query(context.Background(), timetableDraftSelectQuery+` ORDER BY d.created_at DESC`)
+	if err != nil {
+		fmt.Printf("GetTimetableDraftsHandler error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	drafts := []TimetableDraft{}
+	for rows.Next() {
+		draft, err := scanTimetableDraft(rows)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		drafts = append(drafts, *draft)
+	}
+
+	return c.JSON(http.StatusOK, drafts)
+}
+
+func GetTimetableDraftHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid draft ID"})
+	}
+
+	draft, err := getTimetableDraft(context.Background(), id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Draft not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, draft)
+}
+
+// CommitTimetableDraftHandler copies a draft into schedule. The schedule may
+// have changed since the draft was generated, so every entry is checked for
+// conflicts again and nothing is written if any of them collides.
+func CommitTimetableDraftHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid draft ID"})
+	}
+	allowPartial := c.QueryParam("allow_partial") == "true"
+
+	ctx := context.Background()
+	draft, err := getTimetableDraft(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Draft not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if !draft.Complete && !allowPartial {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Draft is incomplete. Pass allow_partial=true to commit it anyway"})
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	if err := tx.QueryRow(ctx, "SELECT status FROM timetable_drafts WHERE id = $1 FOR UPDATE", id).Scan(&status); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if status != "draft" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Draft has already been committed"})
+	}
+
+	if err := lockSchedule(ctx, tx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	scheduleIDs := []int{}
+	for _, e := range draft.Entries {
+		req := ScheduleRequest{
+			SubjectID:    e.SubjectID,
+			GroupID:      e.GroupID,
+			TeacherID:    e.TeacherID,
+			DayOfWeek:    e.DayOfWeek,
+			TimeSlot:     e.TimeSlot,
+			RoomID:       e.RoomID,
+			RoomNumber:   e.RoomNumber,
+			Semester:     draft.Semester,
+			AcademicYear: draft.AcademicYear,
+		}
+		if msg, err := resolveScheduleSemester(ctx, tx, &req); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else if msg != "" {
+			return c.JSON(http.StatusConflict, map[string]string{"error": msg})
+		}
+		if msg, err := resolveScheduleRoom(ctx, tx, &req); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		} else if msg != "" {
+			return c.JSON(http.StatusConflict, map[string]interface{}{"error": msg, "entry": e})
+		}
+		conflicts, err := checkScheduleConflicts(ctx, tx, 0, &req)
+		if err != nil {
+			fmt.Printf("Failed to check schedule conflicts: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if len(conflicts) > 0 {
+			return c.JSON(http.StatusConflict, map[string]interface{}{
+				"error":     "The schedule changed since the draft was generated",
+				"entry":     e,
+				"conflicts": conflicts,
+			})
+		}
+
+		var scheduleID int
+		err = tx.QueryRow(ctx, `
+            INSERT INTO schedule (subject_id, group_id, teacher_id, day_of_week, time_slot, room_id, room_number, semester_id, academic_year)
+            VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, ''), $8, $9)
+            RETURNING id
+        `, req.SubjectID, req.GroupID, req.TeacherID, req.DayOfWeek, req.TimeSlot, req.RoomID, req.RoomNumber, req.SemesterID, req.AcademicYear).Scan(&scheduleID)
+		if err != nil {
+			return scheduleWriteError(c, err)
+		}
+		scheduleIDs = append(scheduleIDs, scheduleID)
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE timetable_drafts SET status = 'committed', committed_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit draft"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to commit draft"})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"draft_id":     id,
+		"schedule_ids": scheduleIDs,
+	})
+}
+
+func DeleteTimetableDraftHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid draft ID"})
+	}
+
+	tag, err := pool.Exec(context.Background(), "DELETE FROM timetable_drafts WHERE id = $1 AND status = 'draft'", id)
+	if err != nil {
+		fmt.Printf("Failed to delete timetable draft: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete draft"})
+	}
+	if tag.RowsAffected() == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Draft not found or already committed"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,472 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+)
+
+type SessionRequirement struct {
+	GroupID         int `json:"group_id"`
+	SubjectID       int `json:"subject_id"`
+	TeacherID       int `json:"teacher_id"`
+	SessionsPerWeek int `json:"sessions_per_week"`
+	GroupSize       int `json:"group_size,omitempty"`
+}
+
+type RoomSpec struct {
+	RoomID     int    `json:"room_id,omitempty"`
+	RoomNumber string `json:"room_number"`
+	Capacity   int    `json:"capacity"`
+}
+
+// TeacherAvailability restricts a teacher to the listed slots on a day. A
+// teacher without any availability entries is available all week.
+type TeacherAvailability struct {
+	TeacherID int      `json:"teacher_id"`
+	DayOfWeek string   `json:"day_of_week"`
+	TimeSlots []string `json:"time_slots"`
+}
+
+type TimetableEntry struct {
+	GroupID    int    `json:"group_id"`
+	SubjectID  int    `json:"subject_id"`
+	TeacherID  int    `json:"teacher_id"`
+	DayOfWeek  string `json:"day_of_week"`
+	TimeSlot   string `json:"time_slot"`
+	RoomID     int    `json:"room_id,omitempty"`
+	RoomNumber string `json:"room_number"`
+}
+
+type TimetableScore struct {
+	Total        int `json:"total"`
+	LateSessions int `json:"late_sessions"`
+	GroupGaps    int `json:"group_gaps"`
+	TeacherGaps  int `json:"teacher_gaps"`
+	RepeatedDays int `json:"repeated_days"`
+}
+
+type TimetableResult struct {
+	Entries  []TimetableEntry     `json:"entries"`
+	Unplaced []SessionRequirement `json:"unplaced"`
+	Score    TimetableScore       `json:"score"`
+	Complete bool                 `json:"complete"`
+}
+
+// Soft constraint weights. Lower total score is better.
+const (
+	latePenalty       = 3
+	repeatDayPenalty  = 5
+	groupGapPenalty   = 2
+	teacherGapPenalty = 1
+
+	defaultSolverBudget = 20000
+)
+
+type solverSession struct {
+	req       int
+	groupID   int
+	teacherID int
+	subjectID int
+	size      int
+}
+
+type gridCell struct {
+	day  int
+	slot int
+}
+
+type placement struct {
+	cell gridCell
+	room int
+}
+
+type timetableSolver struct {
+	days      []string
+	slotNames []string
+	slots     []TimeRange
+	rooms     []RoomSpec
+	lateAfter int
+	budget    int
+
+	requirements []SessionRequirement
+	sessions     []solverSession
+	available    map[int]map[gridCell]bool
+
+	teacherBusy map[int]map[gridCell]bool
+	groupBusy   map[int]map[gridCell]bool
+	roomBusy    map[string]map[gridCell]bool
+	reqDay      map[[2]int]int
+
+	assignment []*placement
+	givenUp    []bool
+	placed     int
+	best       []*placement
+	bestPlaced int
+	steps      int
+}
+
+func newTimetableSolver(days, slotNames []string, rooms []RoomSpec, requirements []SessionRequirement, availability []TeacherAvailability, lateAfter int) (*timetableSolver, error) {
+	s := &timetableSolver{
+		days:         days,
+		slotNames:    slotNames,
+		lateAfter:    lateAfter,
+		budget:       defaultSolverBudget,
+		requirements: requirements,
+		available:    map[int]map[gridCell]bool{},
+		teacherBusy:  map[int]map[gridCell]bool{},
+		groupBusy:    map[int]map[gridCell]bool{},
+		roomBusy:     map[string]map[gridCell]bool{},
+		reqDay:       map[[2]int]int{},
+	}
+
+	for _, name := range slotNames {
+		r, err := parseTimeSlot(name)
+		if err != nil {
+			return nil, err
+		}
+		s.slots = append(s.slots, r)
+	}
+	for i := range s.slots {
+		for j := i + 1; j < len(s.slots); j++ {
+			if s.slots[i].Overlaps(s.slots[j]) {
+				return nil, fmt.Errorf("time slots %s and %s overlap", slotNames[i], slotNames[j])
+			}
+		}
+	}
+
+	s.rooms = append(s.rooms, rooms...)
+	sort.SliceStable(s.rooms, func(i, j int) bool { return s.rooms[i].Capacity < s.rooms[j].Capacity })
+
+	for _, a := range availability {
+		day := indexOf(days, a.DayOfWeek)
+		if day < 0 {
+			continue
+		}
+		if s.available[a.TeacherID] == nil {
+			s.available[a.TeacherID] = map[gridCell]bool{}
+		}
+		for _, name := range a.TimeSlots {
+			r, err := parseTimeSlot(name)
+			if err != nil {
+				return nil, err
+			}
+			for slot, sr := range s.slots {
+				if sr.Start >= r.Start && sr.End <= r.End {
+					s.available[a.TeacherID][gridCell{day, slot}] = true
+				}
+			}
+		}
+	}
+
+	for i, req := range requirements {
+		for k := 0; k < req.SessionsPerWeek; k++ {
+			s.sessions = append(s.sessions, solverSession{req: i, groupID: req.GroupID, teacherID: req.TeacherID, subjectID: req.SubjectID, size: req.GroupSize})
+		}
+	}
+	s.assignment = make([]*placement, len(s.sessions))
+	s.givenUp = make([]bool, len(s.sessions))
+
+	return s, nil
+}
+
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+func mark(busy map[int]map[gridCell]bool, id int, cell gridCell, value bool) {
+	if busy[id] == nil {
+		busy[id] = map[gridCell]bool{}
+	}
+	busy[id][cell] = value
+}
+
+// blockExisting marks every grid cell overlapping an already scheduled lesson
+// as taken for its teacher, group and room.
+func (s *timetableSolver) blockExisting(slot scheduleSlot) {
+	day := indexOf(s.days, slot.DayOfWeek)
+	if day < 0 {
+		return
+	}
+	room := normalizeRoom(slot.RoomNumber)
+	for i, r := range s.slots {
+		if !r.Overlaps(slot.Range) {
+			continue
+		}
+		cell := gridCell{day, i}
+		mark(s.teacherBusy, slot.TeacherID, cell, true)
+		mark(s.groupBusy, slot.GroupID, cell, true)
+		if room != "" {
+			if s.roomBusy[room] == nil {
+				s.roomBusy[room] = map[gridCell]bool{}
+			}
+			s.roomBusy[room][cell] = true
+		}
+	}
+}
+
+func (s *timetableSolver) roomFor(sess solverSession, cell gridCell) (int, bool) {
+	if len(s.rooms) == 0 {
+		return -1, true
+	}
+	for i, room := range s.rooms {
+		if room.Capacity < sess.size {
+			continue
+		}
+		if !s.roomBusy[normalizeRoom(room.RoomNumber)][cell] {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (s *timetableSolver) candidates(sess solverSession) []placement {
+	var result []placement
+	avail := s.available[sess.teacherID]
+	for day := range s.days {
+		for slot := range s.slots {
+			cell := gridCell{day, slot}
+			if avail != nil && !avail[cell] {
+				continue
+			}
+			if s.teacherBusy[sess.teacherID][cell] || s.groupBusy[sess.groupID][cell] {
+				continue
+			}
+			room, ok := s.roomFor(sess, cell)
+			if !ok {
+				continue
+			}
+			result = append(result, placement{cell: cell, room: room})
+		}
+	}
+	return result
+}
+
+func gapsIn(busy map[gridCell]bool, day, slotCount int) int {
+	first, last, count := -1, -1, 0
+	for slot := 0; slot < slotCount; slot++ {
+		if busy[gridCell{day, slot}] {
+			if first < 0 {
+				first = slot
+			}
+			last = slot
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return last - first + 1 - count
+}
+
+// cost is the soft-constraint penalty of putting sess into p, given what is
+// already placed. It is used to try the most pleasant placements first.
+func (s *timetableSolver) cost(sess solverSession, p placement) int {
+	cost := 0
+	if s.lateAfter > 0 && s.slots[p.cell.slot].Start >= s.lateAfter {
+		cost += latePenalty
+	}
+	if s.reqDay[[2]int{sess.req, p.cell.day}] > 0 {
+		cost += repeatDayPenalty
+	}
+
+	groupBefore := gapsIn(s.groupBusy[sess.groupID], p.cell.day, len(s.slots))
+	teacherBefore := gapsIn(s.teacherBusy[sess.teacherID], p.cell.day, len(s.slots))
+	s.occupy(sess, p, true)
+	groupAfter := gapsIn(s.groupBusy[sess.groupID], p.cell.day, len(s.slots))
+	teacherAfter := gapsIn(s.teacherBusy[sess.teacherID], p.cell.day, len(s.slots))
+	s.occupy(sess, p, false)
+
+	cost += groupGapPenalty * (groupAfter - groupBefore)
+	cost += teacherGapPenalty * (teacherAfter - teacherBefore)
+	return cost
+}
+
+func (s *timetableSolver) occupy(sess solverSession, p placement, value bool) {
+	mark(s.teacherBusy, sess.teacherID, p.cell, value)
+	mark(s.groupBusy, sess.groupID, p.cell, value)
+	if p.room >= 0 {
+		room := normalizeRoom(s.rooms[p.room].RoomNumber)
+		if s.roomBusy[room] == nil {
+			s.roomBusy[room] = map[gridCell]bool{}
+		}
+		s.roomBusy[room][p.cell] = value
+	}
+	key := [2]int{sess.req, p.cell.day}
+	if value {
+		s.reqDay[key]++
+	} else {
+		s.reqDay[key]--
+	}
+}
+
+// search is a depth-first backtracking search. It always branches on the
+// session with the fewest remaining placements and tries placements in
+// order of increasing soft cost, so the first complete solution found is
+// usually a good one. A session with no placement left is given up for the
+// rest of the branch, so the others are still placed and the largest
+// partial timetable is kept in best.
+func (s *timetableSolver) search() bool {
+	if s.placed == len(s.sessions) {
+		return true
+	}
+	s.steps++
+	if s.steps > s.budget {
+		return false
+	}
+
+	next := -1
+	var nextOptions []placement
+	var givenUp []int
+	defer func() {
+		for _, i := range givenUp {
+			s.givenUp[i] = false
+		}
+	}()
+	for i, sess := range s.sessions {
+		if s.assignment[i] != nil || s.givenUp[i] {
+			continue
+		}
+		options := s.candidates(sess)
+		if len(options) == 0 {
+			// Placing more sessions only removes options, so nothing
+			// deeper in this branch can place it either.
+			s.givenUp[i] = true
+			givenUp = append(givenUp, i)
+			continue
+		}
+		if next < 0 || len(options) < len(nextOptions) {
+			next, nextOptions = i, options
+		}
+	}
+	if next < 0 {
+		return false
+	}
+
+	sess := s.sessions[next]
+	costs := make([]int, len(nextOptions))
+	for i, p := range nextOptions {
+		costs[i] = s.cost(sess, p)
+	}
+	order := make([]int, len(nextOptions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return costs[order[a]] < costs[order[b]] })
+
+	for _, i := range order {
+		p := nextOptions[i]
+		s.occupy(sess, p, true)
+		s.assignment[next] = &p
+		s.placed++
+		if s.placed > s.bestPlaced {
+			s.bestPlaced = s.placed
+			s.best = append(s.best[:0], s.assignment...)
+		}
+
+		if s.search() {
+			return true
+		}
+
+		s.placed--
+		s.assignment[next] = nil
+		s.occupy(sess, p, false)
+		if s.steps > s.budget {
+			return false
+		}
+	}
+	return false
+}
+
+// Solve runs the search and returns the complete timetable, or the largest
+// partial one found within the step budget along with the sessions that
+// could not be placed.
+func (s *timetableSolver) Solve() TimetableResult {
+	complete := s.search()
+	assignment := s.assignment
+	if !complete {
+		assignment = s.best
+		if assignment == nil {
+			assignment = make([]*placement, len(s.sessions))
+		}
+	}
+
+	result := TimetableResult{Entries: []TimetableEntry{}, Unplaced: []SessionRequirement{}, Complete: complete}
+	unplaced := map[int]int{}
+	for i, sess := range s.sessions {
+		p := assignment[i]
+		if p == nil {
+			unplaced[sess.req]++
+			continue
+		}
+		var room RoomSpec
+		if p.room >= 0 {
+			room = s.rooms[p.room]
+		}
+		result.Entries = append(result.Entries, TimetableEntry{
+			GroupID:    sess.groupID,
+			SubjectID:  sess.subjectID,
+			TeacherID:  sess.teacherID,
+			DayOfWeek:  s.days[p.cell.day],
+			TimeSlot:   s.slotNames[p.cell.slot],
+			RoomID:     room.RoomID,
+			RoomNumber: room.RoomNumber,
+		})
+	}
+	for i, req := range s.requirements {
+		if n := unplaced[i]; n > 0 {
+			req.SessionsPerWeek = n
+			result.Unplaced = append(result.Unplaced, req)
+		}
+	}
+
+	sort.SliceStable(result.Entries, func(i, j int) bool {
+		a, b := result.Entries[i], result.Entries[j]
+		if a.DayOfWeek != b.DayOfWeek {
+			return indexOf(s.days, a.DayOfWeek) < indexOf(s.days, b.DayOfWeek)
+		}
+		if a.TimeSlot != b.TimeSlot {
+			return a.TimeSlot < b.TimeSlot
+		}
+		return a.GroupID < b.GroupID
+	})
+	result.Score = s.score(result.Entries)
+	return result
+}
+
+func (s *timetableSolver) score(entries []TimetableEntry) TimetableScore {
+	var score TimetableScore
+	groups := map[int]map[gridCell]bool{}
+	teachers := map[int]map[gridCell]bool{}
+	perDay := map[[3]int]int{}
+	for _, e := range entries {
+		day := indexOf(s.days, e.DayOfWeek)
+		slot := indexOf(s.slotNames, e.TimeSlot)
+		cell := gridCell{day, slot}
+		mark(groups, e.GroupID, cell, true)
+		mark(teachers, e.TeacherID, cell, true)
+		if s.lateAfter > 0 && s.slots[slot].Start >= s.lateAfter {
+			score.LateSessions++
+		}
+		key := [3]int{e.GroupID, e.SubjectID, day}
+		if perDay[key] > 0 {
+			score.RepeatedDays++
+		}
+		perDay[key]++
+	}
+	for day := range s.days {
+		for _, busy := range groups {
+			score.GroupGaps += gapsIn(busy, day, len(s.slots))
+		}
+		for _, busy := range teachers {
+			score.TeacherGaps += gapsIn(busy, day, len(s.slots))
+		}
+	}
+	score.Total = score.LateSessions*latePenalty + score.RepeatedDays*repeatDayPenalty +
+		score.GroupGaps*groupGapPenalty + score.TeacherGaps*teacherGapPenalty
+	return score
+}
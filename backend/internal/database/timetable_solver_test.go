@@ -0,0 +1,277 @@
+package database
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+var (
+	testDays  = []string{"Monday", "Tuesday"}
+	testSlots = []string{"09:00-10:30", "10:40-12:10"}
+)
+
+// checkTimetable fails the test if the result double-books a teacher, group
+// or room, puts a group in a room that is too small, or loses sessions.
+func checkTimetable(t *testing.T, result TimetableResult, rooms []RoomSpec, requirements []SessionRequirement) {
+	t.Helper()
+
+	type key struct {
+		kind string
+		id   string
+		day  string
+		slot string
+	}
+	capacity := map[string]int{}
+	for _, r := range rooms {
+		capacity[r.RoomNumber] = r.Capacity
+	}
+	size := map[int]int{}
+	for _, req := range requirements {
+		size[req.GroupID] = req.GroupSize
+	}
+
+	busy := map[key]bool{}
+	book := func(k key) {
+		if busy[k] {
+			t.Errorf("%s %s is booked twice on %s %s", k.kind, k.id, k.day, k.slot)
+		}
+		busy[k] = true
+	}
+	placed := map[[3]int]int{}
+	for _, e := range result.Entries {
+		book(key{"teacher", strconv.Itoa(e.TeacherID), e.DayOfWeek, e.TimeSlot})
+		book(key{"group", strconv.Itoa(e.GroupID), e.DayOfWeek, e.TimeSlot})
+		if e.RoomNumber != "" {
+			book(key{"room", e.RoomNumber, e.DayOfWeek, e.TimeSlot})
+			if capacity[e.RoomNumber] < size[e.GroupID] {
+				t.Errorf("group %d of %d students placed in %s for %d", e.GroupID, size[e.GroupID], e.RoomNumber, capacity[e.RoomNumber])
+			}
+		}
+		placed[[3]int{e.GroupID, e.SubjectID, e.TeacherID}]++
+	}
+	for _, u := range result.Unplaced {
+		placed[[3]int{u.GroupID, u.SubjectID, u.TeacherID}] += u.SessionsPerWeek
+	}
+	for _, req := range requirements {
+		k := [3]int{req.GroupID, req.SubjectID, req.TeacherID}
+		if placed[k] != req.SessionsPerWeek {
+			t.Errorf("requirement %+v has %d placed or unplaced sessions, want %d", req, placed[k], req.SessionsPerWeek)
+		}
+	}
+}
+
+func TestTimetableSolverSolve(t *testing.T) {
+	tests := []struct {
+		name         string
+		days         []string
+		slots        []string
+		rooms        []RoomSpec
+		requirements []SessionRequirement
+		availability []TeacherAvailability
+		existing     []scheduleSlot
+		lateAfter    int
+
+		wantComplete bool
+		wantEntries  int
+		wantUnplaced []SessionRequirement
+		wantDays     []string
+		wantScore    *TimetableScore
+	}{
+		{
+			name:  "feasible",
+			days:  testDays,
+			slots: testSlots,
+			rooms: []RoomSpec{{RoomNumber: "A-101", Capacity: 30}, {RoomNumber: "B-201", Capacity: 60}},
+			requirements: []SessionRequirement{
+				{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2, GroupSize: 25},
+				{GroupID: 2, SubjectID: 2, TeacherID: 1, SessionsPerWeek: 1, GroupSize: 50},
+				{GroupID: 2, SubjectID: 3, TeacherID: 2, SessionsPerWeek: 2, GroupSize: 50},
+			},
+			wantComplete: true,
+			wantEntries:  5,
+			wantUnplaced: []SessionRequirement{},
+		},
+		{
+			name:         "feasible without rooms",
+			days:         testDays,
+			slots:        testSlots,
+			requirements: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 4}},
+			wantComplete: true,
+			wantEntries:  4,
+			wantUnplaced: []SessionRequirement{},
+		},
+		{
+			name:         "soft constraints spread sessions and avoid late slots",
+			days:         testDays,
+			slots:        testSlots,
+			requirements: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2}},
+			lateAfter:    10 * 60,
+			wantComplete: true,
+			wantEntries:  2,
+			wantUnplaced: []SessionRequirement{},
+			wantDays:     []string{"Monday", "Tuesday"},
+			wantScore:    &TimetableScore{},
+		},
+		{
+			name:         "teacher availability",
+			days:         testDays,
+			slots:        testSlots,
+			requirements: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2}},
+			availability: []TeacherAvailability{{TeacherID: 1, DayOfWeek: "Tuesday", TimeSlots: []string{"09:00-12:10"}}},
+			wantComplete: true,
+			wantEntries:  2,
+			wantUnplaced: []SessionRequirement{},
+			wantDays:     []string{"Tuesday", "Tuesday"},
+		},
+		{
+			name:         "existing lessons are kept free",
+			days:         testDays,
+			slots:        testSlots,
+			requirements: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2}},
+			existing: []scheduleSlot{
+				testSlot(1, 1, 9, 0, "", "Monday", "09:00-12:10"),
+				testSlot(2, 9, 1, 0, "", "Tuesday", "11:00-12:00"),
+			},
+			wantComplete: false,
+			wantEntries:  1,
+			wantUnplaced: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1}},
+			wantDays:     []string{"Tuesday"},
+		},
+		{
+			name:         "infeasible: more sessions than slots",
+			days:         []string{"Monday"},
+			slots:        []string{"09:00-10:30"},
+			requirements: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2}},
+			wantComplete: false,
+			wantEntries:  1,
+			wantUnplaced: []SessionRequirement{{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1}},
+		},
+		{
+			name:  "infeasible: no room is large enough for one group",
+			days:  testDays,
+			slots: testSlots,
+			rooms: []RoomSpec{{RoomNumber: "A-101", Capacity: 30}},
+			requirements: []SessionRequirement{
+				{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2, GroupSize: 25},
+				{GroupID: 2, SubjectID: 2, TeacherID: 2, SessionsPerWeek: 1, GroupSize: 100},
+				{GroupID: 3, SubjectID: 3, TeacherID: 3, SessionsPerWeek: 2, GroupSize: 30},
+			},
+			wantComplete: false,
+			wantEntries:  4,
+			wantUnplaced: []SessionRequirement{{GroupID: 2, SubjectID: 2, TeacherID: 2, SessionsPerWeek: 1, GroupSize: 100}},
+		},
+		{
+			name:  "infeasible: a teacher runs out of slots",
+			days:  []string{"Monday"},
+			slots: testSlots,
+			requirements: []SessionRequirement{
+				{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1},
+				{GroupID: 2, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1},
+				{GroupID: 3, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1},
+				{GroupID: 4, SubjectID: 2, TeacherID: 2, SessionsPerWeek: 2},
+			},
+			wantComplete: false,
+			wantEntries:  4,
+			wantUnplaced: []SessionRequirement{{GroupID: 3, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newTimetableSolver(tt.days, tt.slots, tt.rooms, tt.requirements, tt.availability, tt.lateAfter)
+			if err != nil {
+				t.Fatalf("newTimetableSolver error: %v", err)
+			}
+			for _, slot := range tt.existing {
+				s.blockExisting(slot)
+			}
+			result := s.Solve()
+
+			if result.Complete != tt.wantComplete {
+				t.Errorf("Complete = %v, want %v", result.Complete, tt.wantComplete)
+			}
+			if len(result.Entries) != tt.wantEntries {
+				t.Errorf("got %d entries, want %d: %+v", len(result.Entries), tt.wantEntries, result.Entries)
+			}
+			if !reflect.DeepEqual(result.Unplaced, tt.wantUnplaced) {
+				t.Errorf("Unplaced = %+v, want %+v", result.Unplaced, tt.wantUnplaced)
+			}
+			if tt.wantDays != nil {
+				var days []string
+				for _, e := range result.Entries {
+					days = append(days, e.DayOfWeek)
+				}
+				if !reflect.DeepEqual(days, tt.wantDays) {
+					t.Errorf("days = %v, want %v", days, tt.wantDays)
+				}
+			}
+			if tt.wantScore != nil && result.Score != *tt.wantScore {
+				t.Errorf("Score = %+v, want %+v", result.Score, *tt.wantScore)
+			}
+			checkTimetable(t, result, tt.rooms, tt.requirements)
+		})
+	}
+}
+
+func TestTimetableSolverBudget(t *testing.T) {
+	requirements := []SessionRequirement{
+		{GroupID: 1, SubjectID: 1, TeacherID: 1, SessionsPerWeek: 2},
+		{GroupID: 2, SubjectID: 2, TeacherID: 2, SessionsPerWeek: 2},
+	}
+	tests := []struct {
+		name         string
+		budget       int
+		wantComplete bool
+		wantEntries  int
+	}{
+		{name: "no steps", budget: 0, wantComplete: false, wantEntries: 0},
+		{name: "one step", budget: 1, wantComplete: false, wantEntries: 1},
+		{name: "three steps", budget: 3, wantComplete: false, wantEntries: 3},
+		{name: "enough steps", budget: 4, wantComplete: true, wantEntries: 4},
+		{name: "default", budget: defaultSolverBudget, wantComplete: true, wantEntries: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newTimetableSolver(testDays, testSlots, nil, requirements, nil, 0)
+			if err != nil {
+				t.Fatalf("newTimetableSolver error: %v", err)
+			}
+			s.budget = tt.budget
+			result := s.Solve()
+
+			if result.Complete != tt.wantComplete {
+				t.Errorf("Complete = %v, want %v", result.Complete, tt.wantComplete)
+			}
+			if len(result.Entries) != tt.wantEntries {
+				t.Errorf("got %d entries, want %d", len(result.Entries), tt.wantEntries)
+			}
+			if !tt.wantComplete && len(result.Unplaced) == 0 {
+				t.Errorf("incomplete result reports no unplaced sessions")
+			}
+			checkTimetable(t, result, nil, requirements)
+		})
+	}
+}
+
+func TestNewTimetableSolverErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		slots        []string
+		availability []TeacherAvailability
+	}{
+		{name: "invalid slot", slots: []string{"09:00-10:30", "late"}},
+		{name: "overlapping slots", slots: []string{"09:00-10:30", "10:00-11:30"}},
+		{
+			name:         "invalid availability slot",
+			slots:        testSlots,
+			availability: []TeacherAvailability{{TeacherID: 1, DayOfWeek: "Monday", TimeSlots: []string{"9-12"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newTimetableSolver(testDays, tt.slots, nil, nil, tt.availability, 0); err == nil {
+				t.Fatal("newTimetableSolver succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+)
+
+var validRoles = []string{"student", "teacher", "admin", "guardian"}
+
+func isValidRole(role string) bool {
+	for _, r := range validRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type UpdateUserRequest struct {
+	Role     *string `json:"role"`
+	FullName *string `json:"full_name"`
+	Phone    *string `json:"phone"`
+	IsActive *bool   `json:"is_active"`
+}
+
+type LinkStudentRequest struct {
+	StudentID int `json:"student_id"`
+}
+
+const userSelectQuery = `
+    SELECT id, email, COALESCE(role, 'student') as role, COALESCE(full_name, '') as full_name, COALESCE(phone, ''),
+        student_id, COALESCE(is_active, true), last_login, created_at
+    FROM users
+`
+
+func scanUser(row pgx.Row) (*User, error) {
+	user := &User{}
+	err := row.Scan(&user.ID, &user.Email, &user.Role, &user.FullName, &user.Phone, &user.StudentID, &user.IsActive, &user.LastLogin, &user.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func getUserById(id int) (*User, error) {
+	return scanUser(pool.QueryRow(context.Background(), userSelectQuery+` WHERE id = $1`, id))
+}
+
+// GetAllUsersHandler lists users, optionally filtered by role, is_active,
+// a search term over email and name, and last_login_after (YYYY-MM-DD).
+func GetAllUsersHandler(c echo.Context) error {
+	var conditions []string
+	var args []interface{}
+	where := func(expr string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(expr, len(args)))
+	}
+
+	if role := c.QueryParam("role"); role != "" {
+		if !isValidRole(role) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+		}
+		where("role = $%d", role)
+	}
+	if active := c.QueryParam("is_active"); active != "" {
+		isActive, err := strconv.ParseBool(active)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "is_active must be true or false"})
+		}
+		where("COALESCE(is_active, true) = $%d", isActive)
+	}
+	if q := strings.TrimSpace(c.QueryParam("q")); q != "" {
+		where("(email ILIKE '%%' || $%[1]d || '%%' OR full_name ILIKE '%%' || $%[1]d || '%%')", q)
+	}
+	if after := c.QueryParam("last_login_after"); after != "" {
+		date, err := time.Parse("2006-01-02", after)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "last_login_after must be YYYY-MM-DD"})
+		}
+		where("last_login >= $%d", date)
+	}
+
+	query := userSelectQuery
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		fmt.Printf("Database query error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			fmt.Printf("Row scan error: %v\n", err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		users = append(users, *user)
+	}
+
+	if err = rows.Err(); err != nil {
+		fmt.Printf("Rows iteration error: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, users)
+}
+
+func GetUserHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	user, err := getUserById(id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func UpdateUserHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	var req UpdateUserRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+
+	if req.Role != nil && !isValidRole(*req.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role. Must be " + strings.Join(validRoles, ", ")})
+	}
+
+	callerID := c.Get("user_id").(int)
+	if id == callerID && ((req.Role != nil && *req.Role != "admin") || (req.IsActive != nil && !*req.IsActive)) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot demote or deactivate your own account"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanUser(tx.QueryRow(ctx, userSelectQuery+` WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if req.Role != nil && *req.Role != "student" && before.StudentID != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Unlink the student profile before changing the role"})
+	}
+	if req.Role != nil && *req.Role != "guardian" && before.Role == "guardian" {
+		var linked bool
+		if err := tx.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM guardian_students WHERE guardian_user_id = $1)", id).Scan(&linked); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+		}
+		if linked {
+			return c.JSON(http.StatusConflict, map[string]string{"error": "Unlink the guardian's students before changing the role"})
+		}
+	}
+
+	var sets []string
+	var args []interface{}
+	set := func(expr string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf(expr, len(args)))
+	}
+	if req.Role != nil {
+		set("role = $%d", *req.Role)
+	}
+	if req.FullName != nil {
+		set("full_name = $%d", strings.TrimSpace(*req.FullName))
+	}
+	if req.Phone != nil {
+		set("phone = NULLIF($%d, '')", *req.Phone)
+	}
+	if req.IsActive != nil {
+		set("is_active = $%d", *req.IsActive)
+	}
+	if len(sets) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Nothing to update"})
+	}
+
+	args = append(args, id)
+	query := fmt.Sprintf("UPDATE users SET %s, updated_at = CURRENT_TIMESTAMP WHERE id = $%d", strings.Join(sets, ", "), len(args))
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		fmt.Printf("Failed to update user: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	}
+
+	after, err := scanUser(tx.QueryRow(ctx, userSelectQuery+` WHERE id = $1`, id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if err := writeAuditLog(ctx, tx, c, "update_user", "users", id, before, after); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update user"})
+	}
+
+	return c.JSON(http.StatusOK, after)
+}
+
+// LinkUserStudentHandler sets users.student_id, which is what gives a student
+// account access to its own profile, attendance and grades.
+func LinkUserStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	var req LinkStudentRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request body"})
+	}
+	if req.StudentID <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "student_id is required"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanUser(tx.QueryRow(ctx, userSelectQuery+` WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if before.Role != "student" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is not a student"})
+	}
+
+	var otherUserID int
+	err = tx.QueryRow(ctx, "SELECT id FROM users WHERE student_id = $1 AND id <> $2", req.StudentID, id).Scan(&otherUserID)
+	if err == nil {
+		return c.JSON(http.StatusConflict, map[string]interface{}{
+			"error":   "Student profile is already linked to another user",
+			"user_id": otherUserID,
+		})
+	}
+	if err != pgx.ErrNoRows {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE users SET student_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2", req.StudentID, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "Student not found"})
+		}
+		fmt.Printf("Failed to link student: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	err = writeAuditLog(ctx, tx, c, "link_student", "users", id,
+		map[string]interface{}{"student_id": before.StudentID}, map[string]interface{}{"student_id": req.StudentID})
+	if err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to link student"})
+	}
+
+	user, err := getUserById(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+func UnlinkUserStudentHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	var studentID *int
+	err = tx.QueryRow(ctx, "SELECT student_id FROM users WHERE id = $1 FOR UPDATE", id).Scan(&studentID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	if studentID == nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User is not linked to a student"})
+	}
+
+	if _, err := tx.Exec(ctx, "UPDATE users SET student_id = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = $1", id); err != nil {
+		fmt.Printf("Failed to unlink student: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	err = writeAuditLog(ctx, tx, c, "unlink_student", "users", id,
+		map[string]interface{}{"student_id": *studentID}, map[string]interface{}{"student_id": nil})
+	if err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to unlink student"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func DeleteUserHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+	if id == c.Get("user_id").(int) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot delete your own account"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanUser(tx.QueryRow(ctx, userSelectQuery+` WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM users WHERE id = $1", id); err != nil {
+		fmt.Printf("Failed to delete user: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete user"})
+	}
+
+	if err := writeAuditLog(ctx, tx, c, "delete_user", "users", id, before, nil); err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete user"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete user"})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUserAccess returns the current role of a user and whether the account
+// is active. Deleted users count as inactive.
+func GetUserAccess(userID int) (string, bool, error) {
+	var role string
+	var active bool
+	err := pool.QueryRow(context.Background(), "SELECT role, COALESCE(is_active, true) FROM users WHERE id = $1", userID).Scan(&role, &active)
+	if err == pgx.ErrNoRows {
+		return "", false, nil
+	}
+	return role, active, err
+}
+
+// AnonymizeUserHandler keeps the users row, so references from attendance and
+// audit logs stay intact, but strips personal data and disables login.
+func AnonymizeUserHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid user ID"})
+	}
+	if id == c.Get("user_id").(int) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "You cannot anonymize your own account"})
+	}
+
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+	defer tx.Rollback(ctx)
+
+	before, err := scanUser(tx.QueryRow(ctx, userSelectQuery+` WHERE id = $1 FOR UPDATE`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	query := `
+        UPDATE users
+        SET email = $1, full_name = 'Deleted user', phone = NULL, password = '!', student_id = NULL,
+            is_active = false, updated_at = CURRENT_TIMESTAMP
+        WHERE id = $2
+    `
+	if _, err := tx.Exec(ctx, query, fmt.Sprintf("deleted-user-%d@anonymized.invalid", id), id); err != nil {
+		fmt.Printf("Failed to anonymize user: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to anonymize user"})
+	}
+
+	// Earlier audit entries about the user keep their shape but lose the
+	// personal data.
+	_, err = tx.Exec(ctx, `
+        UPDATE audit_logs
+        SET old_values = old_values - ARRAY['email', 'full_name', 'phone'],
+            new_values = new_values - ARRAY['email', 'full_name', 'phone']
+        WHERE table_name = 'users' AND record_id = $1
+    `, id)
+	if err != nil {
+		fmt.Printf("Failed to scrub audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to anonymize user"})
+	}
+	if _, err := tx.Exec(ctx, "UPDATE audit_logs SET ip_address = NULL, user_agent = NULL WHERE user_id = $1", id); err != nil {
+		fmt.Printf("Failed to scrub audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to anonymize user"})
+	}
+
+	// Only the id and role are kept in the audit trail, not the personal data.
+	err = writeAuditLog(ctx, tx, c, "anonymize_user", "users", id, map[string]interface{}{"role": before.Role}, nil)
+	if err != nil {
+		fmt.Printf("Failed to write audit log: %v\n", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to anonymize user"})
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to anonymize user"})
+	}
+
+	user, err := getUserById(id)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
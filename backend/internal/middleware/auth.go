@@ -18,6 +18,12 @@ type JWTClaims struct {
 
 var jwtSecret []byte
 
+// UserAccess returns an account's current role and whether it may still use
+// the API. It is set by the server at startup; tokens outlive role changes
+// and deactivation, so AuthMiddleware asks it on every request and trusts
+// its role over the token's.
+var UserAccess func(userID int) (role string, active bool, err error)
+
 func init() {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
@@ -59,9 +65,21 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid token "})
 		}
 
+		role := claims.Role
+		if UserAccess != nil {
+			current, active, err := UserAccess(claims.UserID)
+			if err != nil {
+				return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Database error"})
+			}
+			if !active {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Account is deactivated"})
+			}
+			role = current
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
-		c.Set("user_role", claims.Role)
+		c.Set("user_role", role)
 
 		return next(c)
 	}
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS student_group_history (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL,
+    from_group_id INTEGER,
+    to_group_id INTEGER,
+    reason TEXT,
+    moved_by INTEGER,
+    moved_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_group_history_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    CONSTRAINT fk_group_history_from FOREIGN KEY (from_group_id) REFERENCES student_groups(id) ON DELETE SET NULL,
+    CONSTRAINT fk_group_history_to FOREIGN KEY (to_group_id) REFERENCES student_groups(id) ON DELETE SET NULL,
+    CONSTRAINT fk_group_history_mover FOREIGN KEY (moved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_history_student ON student_group_history(student_id);
+CREATE INDEX IF NOT EXISTS idx_group_history_to ON student_group_history(to_group_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS subject_prerequisites (
+    subject_id INTEGER NOT NULL,
+    prerequisite_id INTEGER NOT NULL,
+    min_grade DECIMAL(5,2) NOT NULL DEFAULT 50 CHECK (min_grade >= 0 AND min_grade <= 100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (subject_id, prerequisite_id),
+    CONSTRAINT fk_prereq_subject FOREIGN KEY (subject_id) REFERENCES subjects(id) ON DELETE CASCADE,
+    CONSTRAINT fk_prereq_prerequisite FOREIGN KEY (prerequisite_id) REFERENCES subjects(id) ON DELETE CASCADE,
+    CONSTRAINT chk_prereq_not_self CHECK (subject_id <> prerequisite_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_prereq_prerequisite ON subject_prerequisites(prerequisite_id);
+
+INSERT INTO subject_prerequisites (subject_id, prerequisite_id)
+SELECT s.id, p.id FROM subjects s, subjects p
+WHERE s.subject_code = 'MATH231' AND p.subject_code = 'MATH162'
+ON CONFLICT DO NOTHING;
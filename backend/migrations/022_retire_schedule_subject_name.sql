@@ -0,0 +1,9 @@
+-- schedule.subject_name duplicated subjects.subject_name; responses now join subjects instead.
+UPDATE schedule s
+SET subject_id = sub.id
+FROM subjects sub
+WHERE s.subject_id IS NULL AND s.subject_name = sub.subject_name;
+
+ALTER TABLE schedule DROP COLUMN IF EXISTS subject_name;
+
+CREATE INDEX IF NOT EXISTS idx_schedule_room ON schedule(room_number);
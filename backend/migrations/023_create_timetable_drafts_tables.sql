@@ -0,0 +1,32 @@
+CREATE TABLE IF NOT EXISTS timetable_drafts (
+    id SERIAL PRIMARY KEY,
+    semester VARCHAR(20) NOT NULL,
+    academic_year VARCHAR(20) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'committed')),
+    complete BOOLEAN NOT NULL DEFAULT false,
+    score JSONB,
+    unplaced JSONB,
+    request JSONB,
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    committed_at TIMESTAMP,
+    CONSTRAINT fk_timetable_draft_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS timetable_draft_entries (
+    id SERIAL PRIMARY KEY,
+    draft_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    subject_id INTEGER NOT NULL,
+    teacher_id INTEGER NOT NULL,
+    day_of_week VARCHAR(20) NOT NULL,
+    time_slot VARCHAR(50) NOT NULL,
+    room_number VARCHAR(50),
+    CONSTRAINT fk_draft_entry_draft FOREIGN KEY (draft_id) REFERENCES timetable_drafts(id) ON DELETE CASCADE,
+    CONSTRAINT fk_draft_entry_group FOREIGN KEY (group_id) REFERENCES student_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_draft_entry_subject FOREIGN KEY (subject_id) REFERENCES subjects(id) ON DELETE CASCADE,
+    CONSTRAINT fk_draft_entry_teacher FOREIGN KEY (teacher_id) REFERENCES teachers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timetable_drafts_semester ON timetable_drafts(semester);
+CREATE INDEX IF NOT EXISTS idx_draft_entries_draft ON timetable_draft_entries(draft_id);
@@ -0,0 +1,82 @@
+CREATE TABLE IF NOT EXISTS buildings (
+    id SERIAL PRIMARY KEY,
+    building_name VARCHAR(255) NOT NULL UNIQUE,
+    address TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rooms (
+    id SERIAL PRIMARY KEY,
+    building_id INTEGER NOT NULL,
+    room_number VARCHAR(50) NOT NULL,
+    capacity INTEGER NOT NULL DEFAULT 30 CHECK (capacity > 0),
+    equipment TEXT[] NOT NULL DEFAULT '{}',
+    wheelchair_accessible BOOLEAN NOT NULL DEFAULT false,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_room_building FOREIGN KEY (building_id) REFERENCES buildings(id) ON DELETE RESTRICT,
+    CONSTRAINT unique_room_in_building UNIQUE (building_id, room_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_rooms_building ON rooms(building_id);
+CREATE INDEX IF NOT EXISTS idx_rooms_capacity ON rooms(capacity);
+
+CREATE TABLE IF NOT EXISTS room_bookings (
+    id SERIAL PRIMARY KEY,
+    room_id INTEGER NOT NULL,
+    booking_date DATE NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    purpose TEXT NOT NULL,
+    booked_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_booking_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT fk_booking_user FOREIGN KEY (booked_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT chk_booking_times CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_room_bookings_room_date ON room_bookings(room_id, booking_date);
+
+ALTER TABLE schedule ADD COLUMN IF NOT EXISTS room_id INTEGER;
+ALTER TABLE timetable_draft_entries ADD COLUMN IF NOT EXISTS room_id INTEGER;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_schedule_room' AND table_name = 'schedule'
+    ) THEN
+        ALTER TABLE schedule
+        ADD CONSTRAINT fk_schedule_room
+        FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE SET NULL;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_draft_entry_room' AND table_name = 'timetable_draft_entries'
+    ) THEN
+        ALTER TABLE timetable_draft_entries
+        ADD CONSTRAINT fk_draft_entry_room
+        FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_schedule_room_id ON schedule(room_id);
+
+-- Turn the free-text rooms already used by schedule into room records.
+INSERT INTO buildings (building_name, address) VALUES ('Main Building', NULL)
+ON CONFLICT (building_name) DO NOTHING;
+
+INSERT INTO rooms (building_id, room_number)
+SELECT DISTINCT (SELECT id FROM buildings WHERE building_name = 'Main Building'), TRIM(room_number)
+FROM schedule
+WHERE room_number IS NOT NULL AND TRIM(room_number) <> ''
+ON CONFLICT (building_id, room_number) DO NOTHING;
+
+UPDATE schedule s
+SET room_id = r.id
+FROM rooms r
+JOIN buildings b ON r.building_id = b.id
+WHERE s.room_id IS NULL AND b.building_name = 'Main Building' AND r.room_number = TRIM(s.room_number);
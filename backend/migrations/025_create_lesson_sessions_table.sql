@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS lesson_sessions (
+    id SERIAL PRIMARY KEY,
+    schedule_id INTEGER NOT NULL,
+    session_date DATE NOT NULL,
+    subject_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    teacher_id INTEGER NOT NULL,
+    time_slot VARCHAR(50) NOT NULL,
+    room_id INTEGER,
+    room_number VARCHAR(50),
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'cancelled')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_session_schedule FOREIGN KEY (schedule_id) REFERENCES schedule(id) ON DELETE CASCADE,
+    CONSTRAINT fk_session_subject FOREIGN KEY (subject_id) REFERENCES subjects(id) ON DELETE CASCADE,
+    CONSTRAINT fk_session_group FOREIGN KEY (group_id) REFERENCES student_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_session_teacher FOREIGN KEY (teacher_id) REFERENCES teachers(id) ON DELETE CASCADE,
+    CONSTRAINT fk_session_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE SET NULL,
+    CONSTRAINT unique_session_per_schedule_day UNIQUE (schedule_id, session_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_lesson_sessions_date ON lesson_sessions(session_date);
+CREATE INDEX IF NOT EXISTS idx_lesson_sessions_group_subject ON lesson_sessions(group_id, subject_id, session_date);
+CREATE INDEX IF NOT EXISTS idx_lesson_sessions_teacher ON lesson_sessions(teacher_id, session_date);
+
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS session_id INTEGER;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_attendance_session' AND table_name = 'attendance'
+    ) THEN
+        ALTER TABLE attendance
+        ADD CONSTRAINT fk_attendance_session
+        FOREIGN KEY (session_id) REFERENCES lesson_sessions(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_session ON attendance(session_id);
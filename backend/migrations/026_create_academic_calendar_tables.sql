@@ -0,0 +1,138 @@
+CREATE TABLE IF NOT EXISTS academic_years (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(20) NOT NULL UNIQUE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_academic_year_dates CHECK (end_date > start_date)
+);
+
+CREATE TABLE IF NOT EXISTS semesters (
+    id SERIAL PRIMARY KEY,
+    academic_year_id INTEGER NOT NULL,
+    name VARCHAR(20) NOT NULL UNIQUE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_semester_academic_year FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE RESTRICT,
+    CONSTRAINT chk_semester_dates CHECK (end_date > start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_semesters_dates ON semesters(start_date, end_date);
+
+CREATE TABLE IF NOT EXISTS holidays (
+    id SERIAL PRIMARY KEY,
+    holiday_date DATE NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS exam_periods (
+    id SERIAL PRIMARY KEY,
+    semester_id INTEGER NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_exam_period_semester FOREIGN KEY (semester_id) REFERENCES semesters(id) ON DELETE CASCADE,
+    CONSTRAINT chk_exam_period_dates CHECK (end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_periods_semester ON exam_periods(semester_id);
+
+-- Build the calendar from the semester and academic year labels already in use.
+WITH labels AS (
+    SELECT semester AS label FROM schedule
+    UNION SELECT semester FROM grades
+    UNION SELECT semester FROM timetable_drafts
+    UNION SELECT 'Fall 2025'
+    UNION SELECT 'Spring 2026'
+),
+parsed AS (
+    SELECT label, split_part(label, ' ', 1) AS term, split_part(label, ' ', 2)::int AS yr
+    FROM labels
+    WHERE label ~ '^(Fall|Spring|Summer) \d{4}$'
+),
+years AS (
+    SELECT CASE WHEN term = 'Fall' THEN yr ELSE yr - 1 END AS first_year FROM parsed
+    UNION SELECT split_part(academic_year, '-', 1)::int FROM schedule WHERE academic_year ~ '^\d{4}-\d{4}$'
+    UNION SELECT split_part(academic_year, '-', 1)::int FROM student_groups WHERE academic_year ~ '^\d{4}-\d{4}$'
+)
+INSERT INTO academic_years (name, start_date, end_date)
+SELECT first_year || '-' || (first_year + 1), make_date(first_year, 9, 1), make_date(first_year + 1, 8, 31)
+FROM years
+ON CONFLICT (name) DO NOTHING;
+
+WITH labels AS (
+    SELECT semester AS label FROM schedule
+    UNION SELECT semester FROM grades
+    UNION SELECT semester FROM timetable_drafts
+    UNION SELECT 'Fall 2025'
+    UNION SELECT 'Spring 2026'
+),
+parsed AS (
+    SELECT label, split_part(label, ' ', 1) AS term, split_part(label, ' ', 2)::int AS yr
+    FROM labels
+    WHERE label ~ '^(Fall|Spring|Summer) \d{4}$'
+)
+INSERT INTO semesters (academic_year_id, name, start_date, end_date)
+SELECT ay.id, p.label,
+    CASE p.term WHEN 'Fall' THEN make_date(p.yr, 9, 1) WHEN 'Spring' THEN make_date(p.yr, 1, 15) ELSE make_date(p.yr, 6, 1) END,
+    CASE p.term WHEN 'Fall' THEN make_date(p.yr, 12, 31) WHEN 'Spring' THEN make_date(p.yr, 5, 31) ELSE make_date(p.yr, 8, 15) END
+FROM parsed p
+JOIN academic_years ay ON ay.name = CASE WHEN p.term = 'Fall' THEN p.yr || '-' || (p.yr + 1) ELSE (p.yr - 1) || '-' || p.yr END
+ON CONFLICT (name) DO NOTHING;
+
+ALTER TABLE schedule ADD COLUMN IF NOT EXISTS semester_id INTEGER;
+ALTER TABLE grades ADD COLUMN IF NOT EXISTS semester_id INTEGER;
+ALTER TABLE timetable_drafts ADD COLUMN IF NOT EXISTS semester_id INTEGER;
+ALTER TABLE student_groups ADD COLUMN IF NOT EXISTS academic_year_id INTEGER;
+
+UPDATE schedule s SET semester_id = sem.id FROM semesters sem WHERE s.semester_id IS NULL AND sem.name = s.semester;
+UPDATE grades g SET semester_id = sem.id FROM semesters sem WHERE g.semester_id IS NULL AND sem.name = g.semester;
+UPDATE timetable_drafts d SET semester_id = sem.id FROM semesters sem WHERE d.semester_id IS NULL AND sem.name = d.semester;
+UPDATE student_groups sg SET academic_year_id = ay.id FROM academic_years ay WHERE sg.academic_year_id IS NULL AND ay.name = sg.academic_year;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_schedule_semester' AND table_name = 'schedule'
+    ) THEN
+        ALTER TABLE schedule
+        ADD CONSTRAINT fk_schedule_semester
+        FOREIGN KEY (semester_id) REFERENCES semesters(id) ON DELETE RESTRICT;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_grades_semester' AND table_name = 'grades'
+    ) THEN
+        ALTER TABLE grades
+        ADD CONSTRAINT fk_grades_semester
+        FOREIGN KEY (semester_id) REFERENCES semesters(id) ON DELETE RESTRICT;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_timetable_draft_semester' AND table_name = 'timetable_drafts'
+    ) THEN
+        ALTER TABLE timetable_drafts
+        ADD CONSTRAINT fk_timetable_draft_semester
+        FOREIGN KEY (semester_id) REFERENCES semesters(id) ON DELETE RESTRICT;
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_student_groups_academic_year' AND table_name = 'student_groups'
+    ) THEN
+        ALTER TABLE student_groups
+        ADD CONSTRAINT fk_student_groups_academic_year
+        FOREIGN KEY (academic_year_id) REFERENCES academic_years(id) ON DELETE RESTRICT;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_schedule_semester_id ON schedule(semester_id);
+CREATE INDEX IF NOT EXISTS idx_grades_semester_id ON grades(semester_id);
+CREATE INDEX IF NOT EXISTS idx_student_groups_academic_year_id ON student_groups(academic_year_id);
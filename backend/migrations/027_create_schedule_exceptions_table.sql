@@ -0,0 +1,42 @@
+-- A moved session keeps the date it was generated for, so regenerating
+-- sessions from the schedule does not recreate it on the original day.
+ALTER TABLE lesson_sessions ADD COLUMN IF NOT EXISTS original_date DATE;
+UPDATE lesson_sessions SET original_date = session_date WHERE original_date IS NULL;
+ALTER TABLE lesson_sessions ALTER COLUMN original_date SET NOT NULL;
+
+ALTER TABLE lesson_sessions DROP CONSTRAINT IF EXISTS unique_session_per_schedule_day;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'unique_session_per_schedule_original_day' AND table_name = 'lesson_sessions'
+    ) THEN
+        ALTER TABLE lesson_sessions
+        ADD CONSTRAINT unique_session_per_schedule_original_day UNIQUE (schedule_id, original_date);
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS schedule_exceptions (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL,
+    exception_type VARCHAR(20) NOT NULL CHECK (exception_type IN ('cancel', 'move', 'substitute', 'restore')),
+    reason TEXT NOT NULL,
+    old_date DATE,
+    old_time_slot VARCHAR(50),
+    old_room_number VARCHAR(50),
+    old_teacher_id INTEGER,
+    new_date DATE,
+    new_time_slot VARCHAR(50),
+    new_room_number VARCHAR(50),
+    new_teacher_id INTEGER,
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_exception_session FOREIGN KEY (session_id) REFERENCES lesson_sessions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_exception_old_teacher FOREIGN KEY (old_teacher_id) REFERENCES teachers(id) ON DELETE SET NULL,
+    CONSTRAINT fk_exception_new_teacher FOREIGN KEY (new_teacher_id) REFERENCES teachers(id) ON DELETE SET NULL,
+    CONSTRAINT fk_exception_user FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_exceptions_session ON schedule_exceptions(session_id);
+CREATE INDEX IF NOT EXISTS idx_schedule_exceptions_created ON schedule_exceptions(created_at);
@@ -0,0 +1,5 @@
+-- Calendar apps cannot send a JWT, so feeds are authorized by a secret
+-- token in the URL. Only its SHA-256 hash is stored.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS calendar_token_hash VARCHAR(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_calendar_token_hash ON users(calendar_token_hash) WHERE calendar_token_hash IS NOT NULL;
@@ -0,0 +1,73 @@
+CREATE TABLE IF NOT EXISTS exams (
+    id SERIAL PRIMARY KEY,
+    exam_period_id INTEGER NOT NULL,
+    subject_id INTEGER NOT NULL,
+    group_id INTEGER NOT NULL,
+    exam_type VARCHAR(20) NOT NULL CHECK (exam_type IN ('Midterm', 'Final')),
+    exam_date DATE NOT NULL,
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    notes TEXT,
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_exam_period FOREIGN KEY (exam_period_id) REFERENCES exam_periods(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_exam_subject FOREIGN KEY (subject_id) REFERENCES subjects(id) ON DELETE CASCADE,
+    CONSTRAINT fk_exam_group FOREIGN KEY (group_id) REFERENCES student_groups(id) ON DELETE CASCADE,
+    CONSTRAINT fk_exam_creator FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT chk_exam_times CHECK (end_time > start_time),
+    CONSTRAINT unique_exam_per_group UNIQUE (exam_period_id, subject_id, group_id, exam_type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exams_date ON exams(exam_date);
+CREATE INDEX IF NOT EXISTS idx_exams_group ON exams(group_id);
+
+-- A large group may sit its exam in several rooms.
+CREATE TABLE IF NOT EXISTS exam_rooms (
+    exam_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    PRIMARY KEY (exam_id, room_id),
+    CONSTRAINT fk_exam_room_exam FOREIGN KEY (exam_id) REFERENCES exams(id) ON DELETE CASCADE,
+    CONSTRAINT fk_exam_room_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE RESTRICT
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_rooms_room ON exam_rooms(room_id);
+
+CREATE TABLE IF NOT EXISTS exam_invigilators (
+    exam_id INTEGER NOT NULL,
+    teacher_id INTEGER NOT NULL,
+    PRIMARY KEY (exam_id, teacher_id),
+    CONSTRAINT fk_invigilator_exam FOREIGN KEY (exam_id) REFERENCES exams(id) ON DELETE CASCADE,
+    CONSTRAINT fk_invigilator_teacher FOREIGN KEY (teacher_id) REFERENCES teachers(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_invigilators_teacher ON exam_invigilators(teacher_id);
+
+CREATE TABLE IF NOT EXISTS exam_seats (
+    exam_id INTEGER NOT NULL,
+    student_id INTEGER NOT NULL,
+    room_id INTEGER NOT NULL,
+    seat_number INTEGER NOT NULL CHECK (seat_number > 0),
+    PRIMARY KEY (exam_id, student_id),
+    CONSTRAINT fk_seat_exam FOREIGN KEY (exam_id) REFERENCES exams(id) ON DELETE CASCADE,
+    CONSTRAINT fk_seat_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    CONSTRAINT fk_seat_room FOREIGN KEY (room_id) REFERENCES rooms(id) ON DELETE CASCADE,
+    CONSTRAINT unique_exam_seat UNIQUE (exam_id, room_id, seat_number)
+);
+
+-- Marks entered for an exam are kept as grades linked back to it.
+ALTER TABLE grades ADD COLUMN IF NOT EXISTS exam_id INTEGER;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_grades_exam' AND table_name = 'grades'
+    ) THEN
+        ALTER TABLE grades
+        ADD CONSTRAINT fk_grades_exam
+        FOREIGN KEY (exam_id) REFERENCES exams(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_grades_exam_student ON grades(exam_id, student_id) WHERE exam_id IS NOT NULL;
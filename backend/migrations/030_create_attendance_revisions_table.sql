@@ -0,0 +1,15 @@
+-- Every write to an attendance row is kept here. attendance_id has no foreign
+-- key so the history of deleted rows survives.
+CREATE TABLE IF NOT EXISTS attendance_revisions (
+    id SERIAL PRIMARY KEY,
+    attendance_id INTEGER NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'update', 'delete')),
+    old_values JSONB,
+    new_values JSONB,
+    reason TEXT,
+    changed_by INTEGER,
+    changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_attendance_revision_user FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_attendance_revisions_attendance ON attendance_revisions(attendance_id, changed_at);
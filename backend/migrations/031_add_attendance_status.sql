@@ -0,0 +1,49 @@
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS status VARCHAR(20);
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS minutes_late INTEGER;
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS status_reason TEXT;
+
+UPDATE attendance SET status = CASE WHEN visited THEN 'present' ELSE 'absent' END WHERE status IS NULL;
+
+ALTER TABLE attendance ALTER COLUMN status SET DEFAULT 'present';
+ALTER TABLE attendance ALTER COLUMN status SET NOT NULL;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'chk_attendance_status' AND table_name = 'attendance'
+    ) THEN
+        ALTER TABLE attendance
+        ADD CONSTRAINT chk_attendance_status
+        CHECK (status IN ('present', 'absent', 'late', 'excused', 'remote'));
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'chk_attendance_minutes_late' AND table_name = 'attendance'
+    ) THEN
+        ALTER TABLE attendance
+        ADD CONSTRAINT chk_attendance_minutes_late
+        CHECK (minutes_late IS NULL OR (status = 'late' AND minutes_late >= 0));
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_status ON attendance(status);
+
+-- How each status counts in attendance statistics. credit is the share of a
+-- lesson the status earns; statuses that do not count toward the total are
+-- left out of the denominator entirely.
+CREATE TABLE IF NOT EXISTS attendance_status_policy (
+    status VARCHAR(20) PRIMARY KEY CHECK (status IN ('present', 'absent', 'late', 'excused', 'remote')),
+    credit DECIMAL(3,2) NOT NULL CHECK (credit >= 0 AND credit <= 1),
+    counts_toward_total BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO attendance_status_policy (status, credit, counts_toward_total) VALUES
+('present', 1, true),
+('late', 1, true),
+('remote', 1, true),
+('excused', 0, false),
+('absent', 0, true)
+ON CONFLICT (status) DO NOTHING;
@@ -0,0 +1,55 @@
+-- The dean of a faculty is one of its teachers and may review excuses of
+-- the faculty's students.
+ALTER TABLE faculties ADD COLUMN IF NOT EXISTS dean_teacher_id INTEGER;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_faculty_dean' AND table_name = 'faculties'
+    ) THEN
+        ALTER TABLE faculties
+        ADD CONSTRAINT fk_faculty_dean
+        FOREIGN KEY (dean_teacher_id) REFERENCES teachers(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS absence_excuses (
+    id SERIAL PRIMARY KEY,
+    student_id INTEGER NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    document_name VARCHAR(255),
+    document_type VARCHAR(100),
+    document BYTEA,
+    submitted_by INTEGER,
+    reviewed_by INTEGER,
+    review_comment TEXT,
+    reviewed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_excuse_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    CONSTRAINT fk_excuse_submitter FOREIGN KEY (submitted_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_excuse_reviewer FOREIGN KEY (reviewed_by) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT chk_excuse_dates CHECK (end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_absence_excuses_student ON absence_excuses(student_id, start_date, end_date);
+CREATE INDEX IF NOT EXISTS idx_absence_excuses_status ON absence_excuses(status);
+
+-- Attendance converted to excused remembers which excuse did it.
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS excuse_id INTEGER;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE constraint_name = 'fk_attendance_excuse' AND table_name = 'attendance'
+    ) THEN
+        ALTER TABLE attendance
+        ADD CONSTRAINT fk_attendance_excuse
+        FOREIGN KEY (excuse_id) REFERENCES absence_excuses(id) ON DELETE SET NULL;
+    END IF;
+END $$;
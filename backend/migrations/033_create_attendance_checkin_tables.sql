@@ -0,0 +1,35 @@
+-- A check-in window is opened by the teacher for one lesson session. While it
+-- is open the teacher's screen shows a QR code signed with the window secret
+-- that changes every few seconds.
+CREATE TABLE IF NOT EXISTS attendance_checkin_windows (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    opened_by INTEGER,
+    opened_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    closed_at TIMESTAMP,
+    CONSTRAINT fk_checkin_window_session FOREIGN KEY (session_id) REFERENCES lesson_sessions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_checkin_window_user FOREIGN KEY (opened_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_checkin_windows_session ON attendance_checkin_windows(session_id);
+
+-- Every accepted check-in. A student checks in once per window, and a device
+-- may only be used by one student per window.
+CREATE TABLE IF NOT EXISTS attendance_checkins (
+    id SERIAL PRIMARY KEY,
+    window_id INTEGER NOT NULL,
+    student_id INTEGER NOT NULL,
+    attendance_id INTEGER,
+    code_step BIGINT NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(50),
+    user_agent TEXT,
+    checked_in_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_checkin_window FOREIGN KEY (window_id) REFERENCES attendance_checkin_windows(id) ON DELETE CASCADE,
+    CONSTRAINT fk_checkin_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    CONSTRAINT fk_checkin_attendance FOREIGN KEY (attendance_id) REFERENCES attendance(id) ON DELETE SET NULL,
+    CONSTRAINT unique_checkin_student UNIQUE (window_id, student_id),
+    CONSTRAINT unique_checkin_device UNIQUE (window_id, device_id)
+);
@@ -0,0 +1,83 @@
+-- Rules decide which attendance events notify whom and how. threshold is the
+-- streak length for consecutive_absences and the rate in percent for
+-- below_threshold; it is unused for absence.
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    event VARCHAR(50) NOT NULL CHECK (event IN ('absence', 'consecutive_absences', 'below_threshold')),
+    threshold DECIMAL(5,2),
+    channels TEXT[] NOT NULL CHECK (channels <@ ARRAY['email', 'in_app', 'webhook'] AND cardinality(channels) > 0),
+    recipients TEXT[] NOT NULL DEFAULT ARRAY['student'] CHECK (recipients <@ ARRAY['student', 'teacher', 'admin']),
+    webhook_url TEXT,
+    subject_template TEXT NOT NULL,
+    body_template TEXT NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_rule_threshold CHECK (event = 'absence' OR threshold IS NOT NULL),
+    CONSTRAINT chk_rule_webhook CHECK (NOT ('webhook' = ANY(channels)) OR webhook_url IS NOT NULL)
+);
+
+-- Users opt out of an event on a channel; no row means enabled.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL CHECK (event IN ('absence', 'consecutive_absences', 'below_threshold')),
+    channel VARCHAR(20) NOT NULL CHECK (channel IN ('email', 'in_app')),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, event, channel),
+    CONSTRAINT fk_notification_preference_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Messages shown inside the application.
+CREATE TABLE IF NOT EXISTS notifications (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    data JSONB,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_notification_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+
+-- Every attempt to deliver a notification, successful or not.
+CREATE TABLE IF NOT EXISTS notification_deliveries (
+    id SERIAL PRIMARY KEY,
+    rule_id INTEGER,
+    event VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    user_id INTEGER,
+    recipient TEXT,
+    student_id INTEGER,
+    attendance_id INTEGER,
+    subject TEXT,
+    body TEXT,
+    status VARCHAR(20) NOT NULL CHECK (status IN ('sent', 'failed', 'skipped')),
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_delivery_rule FOREIGN KEY (rule_id) REFERENCES notification_rules(id) ON DELETE SET NULL,
+    CONSTRAINT fk_delivery_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_delivery_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE SET NULL,
+    CONSTRAINT fk_delivery_attendance FOREIGN KEY (attendance_id) REFERENCES attendance(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_created ON notification_deliveries(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_notification_deliveries_rule ON notification_deliveries(rule_id);
+
+INSERT INTO notification_rules (name, event, threshold, channels, recipients, subject_template, body_template)
+SELECT * FROM (VALUES
+    ('Absence', 'absence', NULL::DECIMAL, ARRAY['in_app'], ARRAY['student'],
+        'Absent from {{.SubjectName}}',
+        '{{.StudentName}} was marked absent from {{.SubjectName}} on {{.VisitDay}}.'),
+    ('Three absences in a row', 'consecutive_absences', 3, ARRAY['in_app', 'email'], ARRAY['student', 'teacher'],
+        '{{.Streak}} absences in a row in {{.SubjectName}}',
+        '{{.StudentName}} has missed the last {{.Streak}} lessons of {{.SubjectName}} (latest {{.VisitDay}}).'),
+    ('Attendance below 70%', 'below_threshold', 70, ARRAY['in_app', 'email'], ARRAY['student', 'teacher'],
+        'Attendance in {{.SubjectName}} below {{.Threshold}}%',
+        'The attendance rate of {{.StudentName}} in {{.SubjectName}} has fallen to {{.Rate}}%, below {{.Threshold}}%.')
+) AS defaults
+WHERE NOT EXISTS (SELECT 1 FROM notification_rules);
@@ -0,0 +1,18 @@
+-- Guardians are parents or carers with read-only access to the students they
+-- are linked to.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('student', 'teacher', 'admin', 'guardian'));
+
+CREATE TABLE IF NOT EXISTS guardian_students (
+    guardian_user_id INTEGER NOT NULL,
+    student_id INTEGER NOT NULL,
+    relationship VARCHAR(50),
+    created_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (guardian_user_id, student_id),
+    CONSTRAINT fk_guardian_user FOREIGN KEY (guardian_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_guardian_student FOREIGN KEY (student_id) REFERENCES students(id) ON DELETE CASCADE,
+    CONSTRAINT fk_guardian_created_by FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_students_student ON guardian_students(student_id);
@@ -0,0 +1,7 @@
+-- Grades, schedule changes and excuse decisions notify users in the app
+-- directly, without a rule; users can still opt out of them.
+ALTER TABLE notification_preferences DROP CONSTRAINT IF EXISTS notification_preferences_event_check;
+ALTER TABLE notification_preferences ADD CONSTRAINT notification_preferences_event_check
+    CHECK (event IN ('absence', 'consecutive_absences', 'below_threshold', 'grade', 'schedule_change', 'excuse_approved'));
+
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE read_at IS NULL;
@@ -0,0 +1,4 @@
+-- Soft-deleted students are detached from a group when it is deleted, so
+-- group_id may be empty for them. Active students still need a group; one is
+-- required when a detached student is restored.
+ALTER TABLE students ALTER COLUMN group_id DROP NOT NULL;
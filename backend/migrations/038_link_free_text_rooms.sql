@@ -0,0 +1,28 @@
+-- Link schedule rows and lesson sessions that only name their room to the
+-- room it names, when exactly one active room matches, so conflict checks
+-- compare them with rows that reference the room by id.
+WITH matches AS (
+    SELECT lower(regexp_replace(trim(room_number), '\s+', ' ', 'g')) AS name, MIN(id) AS room_id
+    FROM rooms
+    WHERE is_active
+    GROUP BY 1
+    HAVING COUNT(*) = 1
+)
+UPDATE schedule s
+SET room_id = m.room_id
+FROM matches m
+WHERE s.room_id IS NULL AND s.room_number IS NOT NULL
+    AND lower(regexp_replace(trim(s.room_number), '\s+', ' ', 'g')) = m.name;
+
+WITH matches AS (
+    SELECT lower(regexp_replace(trim(room_number), '\s+', ' ', 'g')) AS name, MIN(id) AS room_id
+    FROM rooms
+    WHERE is_active
+    GROUP BY 1
+    HAVING COUNT(*) = 1
+)
+UPDATE lesson_sessions ls
+SET room_id = m.room_id
+FROM matches m
+WHERE ls.room_id IS NULL AND ls.room_number IS NOT NULL
+    AND lower(regexp_replace(trim(ls.room_number), '\s+', ' ', 'g')) = m.name;
@@ -0,0 +1,52 @@
+-- semester_id replaces the free-text semester labels. Rows whose label did
+-- not name a calendar semester are assigned by date: grades by exam date or
+-- creation, drafts by creation, and schedule rows to the current semester,
+-- or the latest one when no semester is current.
+UPDATE schedule s SET semester_id = sem.id FROM semesters sem WHERE s.semester_id IS NULL AND sem.name = s.semester;
+UPDATE grades g SET semester_id = sem.id FROM semesters sem WHERE g.semester_id IS NULL AND sem.name = g.semester;
+UPDATE timetable_drafts d SET semester_id = sem.id FROM semesters sem WHERE d.semester_id IS NULL AND sem.name = d.semester;
+
+UPDATE grades g SET semester_id = (
+    SELECT sem.id FROM semesters sem
+    WHERE COALESCE(g.exam_date, g.created_at::date) BETWEEN sem.start_date AND sem.end_date
+    ORDER BY sem.start_date LIMIT 1
+)
+WHERE g.semester_id IS NULL;
+
+UPDATE timetable_drafts d SET semester_id = (
+    SELECT sem.id FROM semesters sem
+    WHERE d.created_at::date BETWEEN sem.start_date AND sem.end_date
+    ORDER BY sem.start_date LIMIT 1
+)
+WHERE d.semester_id IS NULL;
+
+WITH fallback AS (
+    SELECT id FROM semesters
+    ORDER BY (CURRENT_DATE BETWEEN start_date AND end_date) DESC, start_date DESC
+    LIMIT 1
+)
+UPDATE grades SET semester_id = (SELECT id FROM fallback) WHERE semester_id IS NULL;
+
+WITH fallback AS (
+    SELECT id FROM semesters
+    ORDER BY (CURRENT_DATE BETWEEN start_date AND end_date) DESC, start_date DESC
+    LIMIT 1
+)
+UPDATE timetable_drafts SET semester_id = (SELECT id FROM fallback) WHERE semester_id IS NULL;
+
+WITH fallback AS (
+    SELECT id FROM semesters
+    ORDER BY (CURRENT_DATE BETWEEN start_date AND end_date) DESC, start_date DESC
+    LIMIT 1
+)
+UPDATE schedule SET semester_id = (SELECT id FROM fallback) WHERE semester_id IS NULL;
+
+ALTER TABLE schedule ALTER COLUMN semester_id SET NOT NULL;
+ALTER TABLE grades ALTER COLUMN semester_id SET NOT NULL;
+ALTER TABLE timetable_drafts ALTER COLUMN semester_id SET NOT NULL;
+
+ALTER TABLE schedule DROP COLUMN IF EXISTS semester;
+ALTER TABLE grades DROP COLUMN IF EXISTS semester;
+ALTER TABLE timetable_drafts DROP COLUMN IF EXISTS semester;
+
+CREATE INDEX IF NOT EXISTS idx_timetable_drafts_semester_id ON timetable_drafts(semester_id);
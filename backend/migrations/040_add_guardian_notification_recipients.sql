@@ -0,0 +1,9 @@
+-- Guardians can be notified about their children's attendance. The default
+-- rules now include them.
+ALTER TABLE notification_rules DROP CONSTRAINT IF EXISTS notification_rules_recipients_check;
+ALTER TABLE notification_rules ADD CONSTRAINT notification_rules_recipients_check
+    CHECK (recipients <@ ARRAY['student', 'guardian', 'teacher', 'admin']);
+
+UPDATE notification_rules SET recipients = array_append(recipients, 'guardian'), updated_at = CURRENT_TIMESTAMP
+WHERE name IN ('Absence', 'Three absences in a row', 'Attendance below 70%')
+    AND NOT ('guardian' = ANY(recipients));
@@ -0,0 +1,10 @@
+-- The device each account checks in from. It is registered by the first
+-- successful QR check-in; later check-ins must come from the same device
+-- until an admin resets it.
+CREATE TABLE IF NOT EXISTS checkin_devices (
+    user_id INTEGER PRIMARY KEY,
+    device_id VARCHAR(64) NOT NULL,
+    registered_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_checkin_device_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT unique_checkin_device_id UNIQUE (device_id)
+);
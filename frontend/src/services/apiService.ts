@@ -79,7 +79,7 @@ class ApiService {
         headers: getAuthHeaders(),
       },
     );
-    return response.data;
+    return response.data.items;
   }
 
   async getAttendanceBySubject(subjectId: number): Promise<Attendance[]> {
@@ -89,7 +89,7 @@ class ApiService {
         headers: getAuthHeaders(),
       },
     );
-    return response.data;
+    return response.data.items;
   }
 }
 